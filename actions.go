@@ -1,11 +1,48 @@
 // actions.go
 package taskwrappr
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type Action struct {
-    Block        *Block
-	arguments    []*Action
-	executeFunc  func(s *Script, args ...*Variable) ([]*Variable, error)
-    validateFunc func(s *Script, a *Action) error
+    Name          string
+    Block         *Block
+    Signature     *Signature
+    Statement     Statement
+	Pure          bool
+	arguments     []*Action
+	argumentNames []string
+	executeFunc   func(s *Script, args ...*Variable) ([]*Variable, error)
+    validateFunc  func(s *Script, a *Action) error
+	function      *Function
+	closure       *MemoryMap
+	requirement   *requirement
+	internal      bool
+}
+
+// Parameter describes a single declared argument of an action. Omitted
+// arguments fall back to Value when it is set, otherwise Default is
+// evaluated by the action itself when it runs.
+type Parameter struct {
+	Name     string
+	Type     VariableType
+	Default  *Action
+	Value    *Variable
+	Optional bool
+	Variadic bool
+}
+
+// Signature describes how call arguments bind to parameters. Bound
+// arguments are laid out with every non-variadic parameter first, in
+// declaration order, followed by the values collected by the variadic
+// parameter. Parameters declared after the variadic one can only be
+// passed by name.
+type Signature struct {
+	Parameters []*Parameter
+	Returns    VariableType
 }
 
 func NewAction(executeFunc func(s *Script, args ...*Variable) ([]*Variable, error), validateFunc func(s *Script, a *Action) error) *Action {
@@ -15,37 +52,230 @@ func NewAction(executeFunc func(s *Script, args ...*Variable) ([]*Variable, erro
     }
 }
 
+func NewParameter(name string, parameterType VariableType) *Parameter {
+	return &Parameter{
+		Name: name,
+		Type: parameterType,
+	}
+}
+
+func NewDefaultParameter(name string, parameterType VariableType, value *Variable) *Parameter {
+	parameter := NewParameter(name, parameterType)
+	parameter.Value = value
+	parameter.Optional = true
+	return parameter
+}
+
+func NewVariadicParameter(name string, parameterType VariableType) *Parameter {
+	parameter := NewParameter(name, parameterType)
+	parameter.Variadic = true
+	return parameter
+}
+
+func NewSignature(returns VariableType, parameters ...*Parameter) *Signature {
+	return &Signature{
+		Parameters: parameters,
+		Returns:    returns,
+	}
+}
+
+func NewVariadicSignature(returns VariableType, parameters ...*Parameter) *Signature {
+	signature := NewSignature(returns, parameters...)
+	if len(parameters) > 0 {
+		parameters[len(parameters)-1].Variadic = true
+	}
+	return signature
+}
+
+func (sig *Signature) VariadicParameter() *Parameter {
+	for _, parameter := range sig.Parameters {
+		if parameter.Variadic {
+			return parameter
+		}
+	}
+	return nil
+}
+
+func (sig *Signature) FixedParameters() []*Parameter {
+	fixed := make([]*Parameter, 0, len(sig.Parameters))
+	for _, parameter := range sig.Parameters {
+		if !parameter.Variadic {
+			fixed = append(fixed, parameter)
+		}
+	}
+	return fixed
+}
+
+// String renders the signature the way parameters are declared in a
+// script, followed by the type of the result.
+func (sig *Signature) String() string {
+	parameters := make([]string, len(sig.Parameters))
+	for i, parameter := range sig.Parameters {
+		var text strings.Builder
+		if parameter.Variadic {
+			text.WriteString(VariadicString)
+		}
+		text.WriteString(parameter.Name)
+		if parameter.Type != AnyType {
+			text.WriteString(string(DeclarationSymbol) + " " + parameter.Type.String())
+		}
+		switch {
+		case parameter.Value != nil:
+			text.WriteString(" " + string(AssignmentSymbol) + " " + formatLiteral(parameter.Value))
+		case parameter.Optional:
+			text.WriteString(" " + string(AssignmentSymbol) + " " + VariadicString)
+		}
+		parameters[i] = text.String()
+	}
+
+	return string(ParenOpenSymbol) + strings.Join(parameters, string(DelimiterSymbol)+" ") + string(ParenCloseSymbol) + " -> " + sig.Returns.String()
+}
+
+func (sig *Signature) positionalCount() int {
+	for i, parameter := range sig.Parameters {
+		if parameter.Variadic {
+			return i
+		}
+	}
+	return len(sig.Parameters)
+}
+
+// Bind matches positional and named arguments against the signature.
+// Omitted parameters with an expression default are left nil for the
+// action to fill in.
+func (sig *Signature) Bind(name string, args []*Variable, named map[string]*Variable) ([]*Variable, error) {
+	fixed := sig.FixedParameters()
+	bound := make([]*Variable, len(fixed))
+	var rest []*Variable
+
+	positional := sig.positionalCount()
+	for i, arg := range args {
+		switch {
+		case i < positional:
+			bound[i] = arg
+		case sig.VariadicParameter() != nil:
+			rest = append(rest, arg)
+		default:
+			return nil, fmt.Errorf("'%s' action accepts at most %d positional argument(s), got %d", name, positional, len(args))
+		}
+	}
+
+	names := make([]string, 0, len(named))
+	for argName := range named {
+		names = append(names, argName)
+	}
+	sort.Strings(names)
+
+	for _, argName := range names {
+		index := -1
+		for i, parameter := range fixed {
+			if parameter.Name == argName {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("'%s' action has no parameter named '%s'", name, argName)
+		}
+		if bound[index] != nil {
+			return nil, fmt.Errorf("'%s' action got multiple values for parameter '%s'", name, argName)
+		}
+		bound[index] = named[argName]
+	}
+
+	var missing []string
+	for i, parameter := range fixed {
+		switch {
+		case bound[i] != nil:
+		case parameter.Value != nil:
+			bound[i] = NewVariable(parameter.Value.Value, parameter.Value.Type)
+		case !parameter.Optional:
+			missing = append(missing, parameter.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("'%s' action is missing required argument(s): %s", name, strings.Join(missing, ", "))
+	}
+
+	return append(bound, rest...), nil
+}
+
 func CloneAction(a *Action) *Action {
 	return &Action{
-		Block:        a.Block,
-		arguments:    a.arguments,
-		executeFunc:  a.executeFunc,
-		validateFunc: a.validateFunc,
+		Name:          a.Name,
+		Block:         a.Block,
+		Signature:     a.Signature,
+		Statement:     a.Statement,
+		Pure:          a.Pure,
+		arguments:     a.arguments,
+		argumentNames: a.argumentNames,
+		executeFunc:   a.executeFunc,
+		validateFunc:  a.validateFunc,
+		function:      a.function,
+		closure:       a.closure,
+		requirement:   a.requirement,
+		internal:      a.internal,
 	}
 }
 
-func (a *Action) ProcessArgs(s *Script) ([]*Variable, error) {
+func (a *Action) String() string {
+	if a.Name == "" {
+		return "<action>"
+	}
+	return fmt.Sprintf("<action %s>", a.Name)
+}
+
+func (a *Action) WithSignature(signature *Signature) *Action {
+	a.Signature = signature
+	return a
+}
+
+// AsPure marks the action as free of side effects, so calls to it with
+// constant arguments can be folded before the script runs.
+func (a *Action) AsPure() *Action {
+	a.Pure = true
+	return a
+}
+
+func (a *Action) ProcessArgs(s *Script) ([]*Variable, map[string]*Variable, error) {
 	args := a.GetArguments()
-    processedArgs := make([]*Variable, len(args))
+    var processedArgs []*Variable
+    var namedArgs map[string]*Variable
 
     for i, arg := range args {
         processedArg, err := arg.Execute(s)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
+		var value *Variable
 		if len(processedArg) == 1 {
-			processedArgs[i] = processedArg[0]
+			value = processedArg[0]
+		} else {
+			value = NewVariable(processedArg, ArrayType)
+		}
+
+		if i < len(a.argumentNames) && a.argumentNames[i] != "" {
+			if namedArgs == nil {
+				namedArgs = make(map[string]*Variable)
+			}
+			namedArgs[a.argumentNames[i]] = value
 		} else {
-			processedArgs[i] = NewVariable(processedArg, ArrayType)
+			processedArgs = append(processedArgs, value)
 		}
     }
 
-    return processedArgs, nil
+    return processedArgs, namedArgs, nil
 }
 
 func (a *Action) SetArguments(args []*Action) {
 	a.arguments = args
+	a.argumentNames = nil
+}
+
+func (a *Action) SetNamedArguments(args []*Action, names []string) {
+	a.arguments = args
+	a.argumentNames = names
 }
 
 func (a *Action) GetArguments() ([]*Action) {
@@ -53,11 +283,69 @@ func (a *Action) GetArguments() ([]*Action) {
 }
 
 func (a *Action) Execute(s *Script) ([]*Variable, error) {
-    processedArgs, err := a.ProcessArgs(s)
+    processedArgs, namedArgs, err := a.ProcessArgs(s)
     if err != nil {
         return nil, err
     }
-    return a.executeFunc(s, processedArgs...)
+
+    target := a
+    if target.executeFunc == nil {
+        if target = s.CurrentBlock.Memory.ResolveAction(a.Name); target == nil {
+            return nil, fmt.Errorf("undefined action: %s", a.Name)
+        }
+    }
+    return target.invoke(s, a.Name, processedArgs, namedArgs)
+}
+
+func (a *Action) Invoke(s *Script, args []*Variable, named map[string]*Variable) ([]*Variable, error) {
+    return a.invoke(s, a.Name, args, named)
+}
+
+// invoke calls the action under the name the script called it by, which
+// is the name of the action itself unless the call site knows better, as
+// it does for host actions and actions held by variables.
+func (a *Action) invoke(s *Script, name string, args []*Variable, named map[string]*Variable) ([]*Variable, error) {
+    if name == "" {
+        name = a.Name
+    }
+    if a.Signature != nil {
+        bound, err := a.Signature.Bind(name, args, named)
+        if err != nil {
+            return nil, err
+        }
+        args = bound
+    } else if len(named) > 0 {
+        return nil, fmt.Errorf("'%s' action does not accept named arguments", name)
+    }
+
+    if !a.internal {
+        if err := s.step(); err != nil {
+            return nil, err
+        }
+    }
+    if a.requirement != nil && s.Policy != nil {
+        if err := s.Policy.check(a, args); err != nil {
+            return nil, err
+        }
+    }
+
+    var results []*Variable
+    var err error
+    if len(s.interceptors) > 0 && !a.internal {
+        results, err = s.intercept(a, name, args)
+    } else {
+        results, err = a.executeFunc(s, args...)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    for _, result := range results {
+        if err := s.checkSize(result); err != nil {
+            return nil, err
+        }
+    }
+    return results, nil
 }
 
 func (a *Action) Validate(s *Script) (error) {
@@ -0,0 +1,165 @@
+// analysis.go
+package taskwrappr
+
+// symbol is a name a script can refer to. Symbols declared by the script
+// have a position, the ones provided by the host memory have none.
+type symbol struct {
+	Name        string
+	Pos         Position
+	Declaration *ActionDeclarationNode
+	Action      *Action
+	IsAction    bool
+}
+
+// reference is one use of a symbol in the source, definitions included.
+// Type is what the checker knew about the name at that point.
+type reference struct {
+	Pos    Position
+	Symbol *symbol
+	Type   VariableType
+}
+
+type symbolIndex struct {
+	scopes     map[*typeScope]map[string]*symbol
+	references []*reference
+}
+
+// analysis is everything the language server needs to know about a
+// single source, collected in one pass of the parser and type checker.
+type analysis struct {
+	Program     *BlockNode
+	Diagnostics Diagnostics
+	References  []*reference
+	Symbols     []*symbol
+}
+
+// Check parses and type checks the script without running it and returns
+// every problem it finds. The error is only set when the script cannot be
+// read.
+func (s *Script) Check() (Diagnostics, error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s.analyze().Diagnostics, nil
+}
+
+// analyze parses and type checks the script content without running it.
+// Unlike load it keeps going past errors and reports them all.
+func (s *Script) analyze() *analysis {
+	program, diagnostics := s.Parse()
+	index := &symbolIndex{scopes: make(map[*typeScope]map[string]*symbol)}
+
+	checker := &typeChecker{script: s, symbols: index}
+	checker.checkBlock(program, newTypeScope(nil, s.MainBlock.Memory))
+	diagnostics = append(diagnostics, checker.diagnostics...)
+	diagnostics.Sort()
+
+	result := &analysis{Program: program, Diagnostics: diagnostics.compact(), References: index.references}
+	for _, names := range index.scopes {
+		for _, symbol := range names {
+			result.Symbols = append(result.Symbols, symbol)
+		}
+	}
+	return result
+}
+
+// define records that name is declared at pos in scope. Action
+// declarations are kept so their parameters can be shown.
+func (c *typeChecker) define(scope *typeScope, name string, pos Position, declaration *ActionDeclarationNode) {
+	if c.symbols == nil {
+		return
+	}
+
+	names := c.symbols.scopes[scope]
+	if names == nil {
+		names = make(map[string]*symbol)
+		c.symbols.scopes[scope] = names
+	}
+	names[name] = &symbol{Name: name, Pos: pos, Declaration: declaration, IsAction: declaration != nil}
+	c.refer(scope, name, pos)
+}
+
+// refer records a use of name at pos, resolved the same way the checker
+// resolves it. Unknown names are skipped.
+func (c *typeChecker) refer(scope *typeScope, name string, pos Position) {
+	if c.symbols == nil {
+		return
+	}
+
+	target := c.symbols.resolve(scope, name)
+	if target == nil {
+		return
+	}
+
+	referenceType := AnyType
+	if binding, _ := scope.lookupVariable(name); binding != nil {
+		referenceType = binding.Type
+	} else if target.IsAction {
+		referenceType = ActionType
+	}
+	c.symbols.references = append(c.symbols.references, &reference{Pos: pos, Symbol: target, Type: referenceType})
+}
+
+// referCallee records the identifier a call by name starts with, which
+// the checker resolves through the call name instead of the expression.
+func (c *typeChecker) referCallee(callee Expression, scope *typeScope) {
+	for {
+		switch node := callee.(type) {
+		case *FieldNode:
+			callee = node.Target
+			continue
+		case *IdentifierNode:
+			c.refer(scope, node.Name, node.Pos)
+		}
+		return
+	}
+}
+
+func (index *symbolIndex) resolve(scope *typeScope, name string) *symbol {
+	for ; scope != nil; scope = scope.parent {
+		if symbol, ok := index.scopes[scope][name]; ok {
+			return symbol
+		}
+		if scope.memory == nil {
+			continue
+		}
+		if action := scope.memory.GetAction(name); action != nil {
+			return &symbol{Name: name, Action: action, IsAction: true}
+		}
+		if variable := scope.memory.GetVariable(name); variable != nil {
+			return &symbol{Name: name, IsAction: variable.Type == ActionType}
+		}
+	}
+	return nil
+}
+
+// referenceAt finds the reference whose name covers pos.
+func (a *analysis) referenceAt(pos Position) *reference {
+	for _, reference := range a.References {
+		start := reference.Pos
+		if start.Line != pos.Line || start.File != pos.File {
+			continue
+		}
+		if pos.Column >= start.Column && pos.Column <= start.Column+len([]rune(reference.Symbol.Name)) {
+			return reference
+		}
+	}
+	return nil
+}
+
+// describe renders what hovering over the reference shows: the signature
+// of an action or the type of a variable.
+func (r *reference) describe() string {
+	switch {
+	case r.Symbol.Declaration != nil:
+		f := &formatter{indexes: make(map[Position]int)}
+		f.write(r.Symbol.Name + " " + DeclarationString + " " + ActionString)
+		f.parameters(r.Symbol.Declaration.Parameters)
+		return f.out.String()
+	case r.Symbol.Action != nil && r.Symbol.Action.Signature != nil:
+		return r.Symbol.Name + r.Symbol.Action.Signature.String()
+	case r.Symbol.Action != nil:
+		return r.Symbol.Name + "(...)"
+	}
+	return r.Symbol.Name + string(DeclarationSymbol) + " " + r.Type.String()
+}
@@ -0,0 +1,227 @@
+// ast.go
+package taskwrappr
+
+type Node interface {
+	Position() Position
+}
+
+type Expression interface {
+	Node
+	expressionNode()
+}
+
+type Statement interface {
+	Node
+	statementNode()
+}
+
+type BlockNode struct {
+	Pos        Position
+	Statements []Statement
+}
+
+type LiteralNode struct {
+	Pos   Position
+	Raw   string
+	Value *Variable
+}
+
+type IdentifierNode struct {
+	Pos  Position
+	Name string
+}
+
+type UnaryNode struct {
+	Pos      Position
+	Operator TokenType
+	Symbol   string
+	Operand  Expression
+}
+
+type BinaryNode struct {
+	Pos      Position
+	Operator TokenType
+	Symbol   string
+	Left     Expression
+	Right    Expression
+}
+
+type ArgumentNode struct {
+	Pos   Position
+	Name  string
+	Value Expression
+}
+
+// CallNode carries the qualified Name of its callee when the callee is
+// a plain or dotted identifier, so the action can be resolved by name.
+type CallNode struct {
+	Pos       Position
+	Callee    Expression
+	Name      string
+	Arguments []*ArgumentNode
+}
+
+type IndexNode struct {
+	Pos    Position
+	Target Expression
+	Index  Expression
+}
+
+type FieldNode struct {
+	Pos    Position
+	Target Expression
+	Name   string
+}
+
+type ParameterNode struct {
+	Pos      Position
+	Name     string
+	TypeName string
+	Type     VariableType
+	Default  Expression
+	Variadic bool
+}
+
+// LambdaNode keeps the original expression of an expression-bodied
+// lambda in Result, Body then holds the equivalent return statement.
+type LambdaNode struct {
+	Pos        Position
+	Parameters []*ParameterNode
+	Body       *BlockNode
+	Result     Expression
+}
+
+type CallStatementNode struct {
+	Pos  Position
+	Call *CallNode
+	Body *BlockNode
+}
+
+type AssignmentNode struct {
+	Pos   Position
+	Name  string
+	Value Expression
+}
+
+type DeclarationNode struct {
+	Pos      Position
+	Name     string
+	TypeName string
+	Type     VariableType
+	Value    Expression
+}
+
+type AugmentedAssignmentNode struct {
+	Pos      Position
+	Name     string
+	Operator string
+	Value    Expression
+}
+
+type ActionDeclarationNode struct {
+	Pos        Position
+	Name       string
+	Parameters []*ParameterNode
+	Body       *BlockNode
+}
+
+type ImportNode struct {
+	Pos   Position
+	Path  Expression
+	Alias string
+}
+
+func (n *BlockNode) Position() Position               { return n.Pos }
+func (n *LiteralNode) Position() Position             { return n.Pos }
+func (n *IdentifierNode) Position() Position          { return n.Pos }
+func (n *UnaryNode) Position() Position               { return n.Pos }
+func (n *BinaryNode) Position() Position              { return n.Pos }
+func (n *ArgumentNode) Position() Position            { return n.Pos }
+func (n *CallNode) Position() Position                { return n.Pos }
+func (n *IndexNode) Position() Position               { return n.Pos }
+func (n *FieldNode) Position() Position               { return n.Pos }
+func (n *ParameterNode) Position() Position           { return n.Pos }
+func (n *LambdaNode) Position() Position              { return n.Pos }
+func (n *CallStatementNode) Position() Position       { return n.Pos }
+func (n *AssignmentNode) Position() Position          { return n.Pos }
+func (n *DeclarationNode) Position() Position         { return n.Pos }
+func (n *AugmentedAssignmentNode) Position() Position { return n.Pos }
+func (n *ActionDeclarationNode) Position() Position   { return n.Pos }
+func (n *ImportNode) Position() Position              { return n.Pos }
+
+func (n *LiteralNode) expressionNode()    {}
+func (n *IdentifierNode) expressionNode() {}
+func (n *UnaryNode) expressionNode()      {}
+func (n *BinaryNode) expressionNode()     {}
+func (n *CallNode) expressionNode()       {}
+func (n *IndexNode) expressionNode()      {}
+func (n *FieldNode) expressionNode()      {}
+func (n *LambdaNode) expressionNode()     {}
+
+func (n *CallStatementNode) statementNode()       {}
+func (n *AssignmentNode) statementNode()          {}
+func (n *DeclarationNode) statementNode()         {}
+func (n *AugmentedAssignmentNode) statementNode() {}
+func (n *ActionDeclarationNode) statementNode()   {}
+func (n *ImportNode) statementNode()              {}
+
+// Walk visits node and then its children depth first, in source order.
+// The children of a node are skipped when visit returns false.
+func Walk(node Node, visit func(Node) bool) {
+	if !visit(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *BlockNode:
+		for _, statement := range n.Statements {
+			Walk(statement, visit)
+		}
+	case *UnaryNode:
+		Walk(n.Operand, visit)
+	case *BinaryNode:
+		Walk(n.Left, visit)
+		Walk(n.Right, visit)
+	case *ArgumentNode:
+		Walk(n.Value, visit)
+	case *CallNode:
+		Walk(n.Callee, visit)
+		for _, argument := range n.Arguments {
+			Walk(argument, visit)
+		}
+	case *IndexNode:
+		Walk(n.Target, visit)
+		Walk(n.Index, visit)
+	case *FieldNode:
+		Walk(n.Target, visit)
+	case *ParameterNode:
+		if n.Default != nil {
+			Walk(n.Default, visit)
+		}
+	case *LambdaNode:
+		for _, parameter := range n.Parameters {
+			Walk(parameter, visit)
+		}
+		Walk(n.Body, visit)
+	case *CallStatementNode:
+		Walk(n.Call, visit)
+		if n.Body != nil {
+			Walk(n.Body, visit)
+		}
+	case *AssignmentNode:
+		Walk(n.Value, visit)
+	case *DeclarationNode:
+		Walk(n.Value, visit)
+	case *AugmentedAssignmentNode:
+		Walk(n.Value, visit)
+	case *ActionDeclarationNode:
+		for _, parameter := range n.Parameters {
+			Walk(parameter, visit)
+		}
+		if n.Body != nil {
+			Walk(n.Body, visit)
+		}
+	case *ImportNode:
+		Walk(n.Path, visit)
+	}
+}
@@ -2,22 +2,25 @@
 package taskwrappr
 
 import (
+	"bytes"
 	"testing"
 )
 
 func TestConditionals(t *testing.T) {
 	s, err := NewScript("scripts/basics.tw", GetBuiltIn())
 	if err != nil {
-		t.Errorf("NewScript returned an error: %s", err)
+		t.Fatalf("NewScript returned an error: %s", err)
 	}
 
-	//var buf bytes.Buffer
-
-    // mw := io.MultiWriter(os.Stdout, &buf)
+	var buf bytes.Buffer
+	s.Stdout = &buf
 
 	if err := s.Run(); err != nil {
 		t.Errorf("run returned an error: %s", err)
 	}
 
-	//fmt.Printf("Captured logs: %s", buf.String())
-}
\ No newline at end of file
+	expected := "8\n3\n8\n3\n2\n23\n0\n7.2\n9\n14.300650348695292\n21\n10\n11\n10 10\n"
+	if buf.String() != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -3,48 +3,124 @@
 package taskwrappr
 
 import (
+    "errors"
     "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "sort"
+    "strings"
     "time"
 )
 
-func printVariable(v *Variable) {
+func printVariable(w io.Writer, v *Variable) {
+    fmt.Fprint(w, formatVariable(v))
+}
+
+func formatVariable(v *Variable) string {
+    var out strings.Builder
     switch v.Type {
     case StringType, IntegerType, FloatType, BooleanType:
-        fmt.Print(v.Value)
+        fmt.Fprint(&out, v.Value)
     case ArrayType:
         array := v.Value.([]*Variable)
-        fmt.Printf("%c", BracketOpenSymbol)
+        out.WriteRune(BracketOpenSymbol)
         for i, elem := range array {
-            printVariable(elem)
+            out.WriteString(formatVariable(elem))
             if i != len(array)-1 {
-                fmt.Printf("%c", SpaceSymbol)
+                out.WriteRune(SpaceSymbol)
+            }
+        }
+        out.WriteRune(BracketCloseSymbol)
+    case MapType:
+        entries := v.Value.(map[string]*Variable)
+        keys := make([]string, 0, len(entries))
+        for key := range entries {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        fmt.Fprintf(&out, "%s%c", MapString, BracketOpenSymbol)
+        for i, key := range keys {
+            fmt.Fprintf(&out, "%s%c", key, DeclarationSymbol)
+            out.WriteString(formatVariable(entries[key]))
+            if i != len(keys)-1 {
+                out.WriteRune(SpaceSymbol)
             }
         }
-        fmt.Printf("%c", BracketCloseSymbol)
+        out.WriteRune(BracketCloseSymbol)
+    case ActionType:
+        out.WriteString(v.Value.(*Action).String())
     case NilType:
-        fmt.Print("nil")
+        out.WriteString("nil")
     default:
-        fmt.Printf("unsupported argument type: %v\n", v.Type)
+        fmt.Fprintf(&out, "unsupported argument type: %v\n", v.Type)
     }
+    return out.String()
 }
 
 func GetBuiltIn() *MemoryMap {
     actions := make(map[string]*Action)
     variables := make(map[string]*Variable)
 
-    actions["delete"] = NewAction(DeleteAction, nil)
-    actions["if"]     = NewAction(IfAction, IfActionValidator)
-    actions["elseIf"] = NewAction(ElseIfAction, ElseIfActionValidator)
-    actions["else"]   = NewAction(ElseAction, ElseActionValidator)
-    actions["for"]    = NewAction(ForAction, ForActionValidator)
-    actions["print"]  = NewAction(PrintAction, nil)
-    actions["wait"]   = NewAction(WaitAction, nil)
-    actions["pass"]   = NewAction(PassAction, nil)
-    actions["type"]   = NewAction(TypeAction, nil)
-    actions["bool"]   = NewAction(BoolAction, nil)
-    actions["int"]    = NewAction(IntAction, nil)
-    actions["float"]  = NewAction(FloatAction, nil)
-    actions["string"] = NewAction(StringAction, nil)
+    actions["delete"] = NewAction(DeleteAction, nil).WithSignature(NewSignature(NilType, NewParameter("variable", AnyType)))
+    actions["if"]     = NewAction(IfAction, IfActionValidator).WithSignature(NewSignature(BooleanType, NewParameter("condition", BooleanType)))
+    actions["elseIf"] = NewAction(ElseIfAction, ElseIfActionValidator).WithSignature(NewSignature(BooleanType, NewParameter("condition", BooleanType)))
+    actions["else"]   = NewAction(ElseAction, ElseActionValidator).WithSignature(NewSignature(BooleanType, NewDefaultParameter("condition", AnyType, NewVariable(nil, NilType))))
+    actions["for"]    = NewAction(ForAction, ForActionValidator).WithSignature(NewSignature(BooleanType, NewParameter("condition", AnyType)))
+    actions["print"]  = NewAction(PrintAction, nil).WithSignature(NewSignature(NilType,
+        NewVariadicParameter("values", AnyType),
+        NewDefaultParameter("sep", StringType, NewVariable(string(SpaceSymbol), StringType)),
+        NewDefaultParameter("end", StringType, NewVariable(string(NewLineSymbol), StringType)),
+    ))
+    actions["eprint"] = NewAction(EprintAction, nil).WithSignature(NewSignature(NilType,
+        NewVariadicParameter("values", AnyType),
+        NewDefaultParameter("sep", StringType, NewVariable(string(SpaceSymbol), StringType)),
+        NewDefaultParameter("end", StringType, NewVariable(string(NewLineSymbol), StringType)),
+    ))
+    actions["input"]  = NewAction(InputAction, nil).WithSignature(NewSignature(AnyType, NewDefaultParameter("prompt", StringType, NewVariable("", StringType))))
+    actions["wait"]   = NewAction(WaitAction, nil).WithSignature(NewSignature(NilType, NewParameter("milliseconds", AnyType)))
+    actions["pass"]   = NewAction(PassAction, nil).WithSignature(NewVariadicSignature(AnyType, NewParameter("values", AnyType))).AsPure()
+    actions["type"]   = NewAction(TypeAction, nil).WithSignature(NewSignature(StringType, NewParameter("value", AnyType))).AsPure()
+    actions["bool"]   = NewAction(BoolAction, nil).WithSignature(NewSignature(BooleanType, NewParameter("value", AnyType))).AsPure()
+    actions["int"]    = NewAction(IntAction, nil).WithSignature(NewSignature(IntegerType, NewParameter("value", AnyType))).AsPure()
+    actions["float"]  = NewAction(FloatAction, nil).WithSignature(NewSignature(FloatType, NewParameter("value", AnyType))).AsPure()
+    actions["string"] = NewAction(StringAction, nil).WithSignature(NewSignature(StringType, NewParameter("value", AnyType))).AsPure()
+    actions["array"]  = NewAction(ArrayAction, nil).WithSignature(NewVariadicSignature(ArrayType, NewParameter("values", AnyType)))
+    actions["map"]    = NewAction(MapAction, nil).WithSignature(NewVariadicSignature(MapType, NewParameter("entries", AnyType)))
+    actions["get"]    = NewAction(GetAction, nil).WithSignature(NewSignature(AnyType, NewParameter("collection", AnyType), NewParameter("key", AnyType)))
+    actions["set"]    = NewAction(SetAction, nil).WithSignature(NewSignature(NilType, NewParameter("collection", AnyType), NewParameter("key", AnyType), NewParameter("value", AnyType)))
+    actions["len"]    = NewAction(LenAction, nil).WithSignature(NewSignature(IntegerType, NewParameter("collection", AnyType))).AsPure()
+    actions["call"]   = NewAction(CallAction, nil).WithSignature(NewVariadicSignature(AnyType, NewParameter("action", ActionType), NewParameter("args", AnyType)))
+    actions["import"] = NewAction(ImportAction, nil).WithSignature(NewSignature(MapType, NewParameter("path", StringType)))
+    actions["return"] = NewAction(ReturnAction, nil).WithSignature(NewVariadicSignature(NilType, NewParameter("values", AnyType)))
+    actions["param"]  = NewAction(ParamAction, nil).WithSignature(NewSignature(AnyType,
+        NewParameter("name", StringType),
+        NewParameter("type", StringType),
+        NewDefaultParameter("default", AnyType, NewVariable(nil, NilType)),
+        NewDefaultParameter("description", StringType, NewVariable("", StringType)),
+    ))
+    actions["args"]   = NewAction(ArgsAction, nil).WithSignature(NewSignature(ArrayType))
+    actions["readFile"]  = NewAction(ReadFileAction, nil).WithSignature(NewSignature(StringType, NewParameter("path", StringType))).Requires(CapabilityFSRead, pathScope)
+    actions["writeFile"] = NewAction(WriteFileAction, nil).WithSignature(NewSignature(NilType, NewParameter("path", StringType), NewParameter("content", StringType))).Requires(CapabilityFSWrite, pathScope)
+    actions["exec"]      = NewAction(ExecAction, nil).WithSignature(NewVariadicSignature(StringType, NewParameter("command", StringType), NewParameter("args", AnyType))).Requires(CapabilityExec, commandScope)
+    actions["fetch"]     = NewAction(FetchAction, nil).WithSignature(NewSignature(StringType, NewParameter("url", StringType))).Requires(CapabilityNet, hostScope)
+    actions["test"]   = NewAction(TestAction, TestActionValidator).WithSignature(NewSignature(BooleanType, NewParameter("name", StringType)))
+    actions["assert"] = NewAction(AssertAction, nil).WithSignature(NewSignature(NilType,
+        NewParameter("condition", BooleanType),
+        NewDefaultParameter("message", StringType, NewVariable("", StringType)),
+    ))
+    actions["assertEqual"] = NewAction(AssertEqualAction, nil).WithSignature(NewSignature(NilType,
+        NewParameter("actual", AnyType),
+        NewParameter("expected", AnyType),
+        NewDefaultParameter("message", StringType, NewVariable("", StringType)),
+    ))
+    actions["assertError"] = NewAction(AssertErrorAction, nil).WithSignature(NewVariadicSignature(StringType, NewParameter("action", ActionType), NewParameter("args", AnyType)))
+
+    for name, action := range actions {
+        action.Name = name
+    }
 
     variables[TrueString] = NewVariable(true, BooleanType)
     variables[FalseString] = NewVariable(false, BooleanType)
@@ -63,10 +139,10 @@ func DeleteAction(s *Script, args ...*Variable) ([]*Variable, error) {
 
     arg := args[0]
     for key, variable := range s.CurrentBlock.Memory.Variables {
-        fmt.Println("Key:", key, "Variable:", variable)
+        s.logf("delete: checking %s (%v)", key, variable)
         if variable == arg {
             delete(s.CurrentBlock.Memory.Variables, key)
-            fmt.Println("Deleted variable:", key)
+            s.logf("delete: deleted %s", key)
             break
         }
     }
@@ -176,17 +252,63 @@ func ForActionValidator(s *Script, a *Action) error {
 }
 
 func PrintAction(s *Script, args ...*Variable) ([]*Variable, error) {
-    for i, arg := range args {
-        printVariable(arg)
-        if i != len(args)-1 {
-            fmt.Print(" ")
+    return printValues(s.stdout(), "print", args)
+}
+
+// EprintAction is print for the standard error of the script.
+func EprintAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    return printValues(s.stderr(), "eprint", args)
+}
+
+func printValues(w io.Writer, name string, args []*Variable) ([]*Variable, error) {
+    if len(args) < 2 {
+        return nil, fmt.Errorf("'%s' action requires its separator and terminator arguments", name)
+    }
+
+    sep, err := args[0].toString()
+    if err != nil {
+        return nil, fmt.Errorf("invalid separator: %v", err)
+    }
+    end, err := args[1].toString()
+    if err != nil {
+        return nil, fmt.Errorf("invalid terminator: %v", err)
+    }
+
+    values := args[2:]
+    for i, arg := range values {
+        printVariable(w, arg)
+        if i != len(values)-1 {
+            fmt.Fprint(w, sep)
         }
     }
-    fmt.Println()
+    fmt.Fprint(w, end)
 
     return nil, nil
 }
 
+// InputAction writes the prompt and reads a line from the standard input
+// of the script, without the line break. It returns nil at the end of the
+// input.
+func InputAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) == 1 {
+        prompt, err := args[0].toString()
+        if err != nil {
+            return nil, fmt.Errorf("invalid prompt: %v", err)
+        }
+        fmt.Fprint(s.stdout(), prompt)
+    }
+
+    line, err := s.stdin().ReadString(byte(NewLineSymbol))
+    if err == io.EOF && line == "" {
+        return []*Variable{NewVariable(nil, NilType)}, nil
+    }
+    if err != nil && err != io.EOF {
+        return nil, err
+    }
+    line = strings.TrimSuffix(strings.TrimSuffix(line, string(NewLineSymbol)), string(ReturnSymbol))
+    return []*Variable{NewVariable(line, StringType)}, nil
+}
+
 func WaitAction(s *Script, args ...*Variable) ([]*Variable, error) {
     if len(args) < 1 {
         return nil, fmt.Errorf("'wait' action requires at least 1 argument")
@@ -196,7 +318,23 @@ func WaitAction(s *Script, args ...*Variable) ([]*Variable, error) {
     if err != nil {
         return nil, err
     }
-    time.Sleep(duration)
+    start := time.Now()
+    timer := time.NewTimer(duration)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+    case <-s.Context().Done():
+        err = contextError(s.Context())
+    }
+    if s.Profiler != nil {
+        s.Profiler.waited(time.Since(start))
+    }
+    return nil, err
+}
+
+func ReturnAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    s.returning = true
+    s.returnValues = args
     return nil, nil
 }
 
@@ -266,4 +404,325 @@ func StringAction(s *Script, args ...*Variable) ([]*Variable, error) {
     }
 
     return []*Variable{NewVariable(value, StringType)}, nil
-}
\ No newline at end of file
+}
+
+func ArrayAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    elements := make([]*Variable, len(args))
+    for i, arg := range args {
+        elements[i] = NewVariable(arg.Value, arg.Type)
+    }
+
+    return []*Variable{NewVariable(elements, ArrayType)}, nil
+}
+
+func MapAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args)%2 != 0 {
+        return nil, fmt.Errorf("'map' action requires key and value pairs")
+    }
+
+    entries := make(map[string]*Variable, len(args)/2)
+    for i := 0; i < len(args); i += 2 {
+        key, err := args[i].toString()
+        if err != nil {
+            return nil, fmt.Errorf("invalid map key: %v", err)
+        }
+        entries[key] = NewVariable(args[i+1].Value, args[i+1].Type)
+    }
+
+    return []*Variable{NewVariable(entries, MapType)}, nil
+}
+
+func GetAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 2 {
+        return nil, fmt.Errorf("'get' action requires exactly 2 arguments")
+    }
+
+    switch collection := args[0]; collection.Type {
+    case ArrayType:
+        elements := collection.Value.([]*Variable)
+        index, err := args[1].toInt()
+        if err != nil {
+            return nil, err
+        }
+        if index < 0 || index >= len(elements) {
+            return nil, fmt.Errorf("index %d out of range for array of length %d", index, len(elements))
+        }
+        return []*Variable{elements[index]}, nil
+    case MapType:
+        key, err := args[1].toString()
+        if err != nil {
+            return nil, err
+        }
+        if value, ok := collection.Value.(map[string]*Variable)[key]; ok {
+            return []*Variable{value}, nil
+        }
+        return []*Variable{NewVariable(nil, NilType)}, nil
+    default:
+        return nil, fmt.Errorf("'get' action requires an array or a map, got %v", collection.Type)
+    }
+}
+
+func SetAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 3 {
+        return nil, fmt.Errorf("'set' action requires exactly 3 arguments")
+    }
+
+    value := NewVariable(args[2].Value, args[2].Type)
+    switch collection := args[0]; collection.Type {
+    case ArrayType:
+        elements := collection.Value.([]*Variable)
+        index, err := args[1].toInt()
+        if err != nil {
+            return nil, err
+        }
+        switch {
+        case index == len(elements):
+            collection.Value = append(elements, value)
+        case index >= 0 && index < len(elements):
+            elements[index] = value
+        default:
+            return nil, fmt.Errorf("index %d out of range for array of length %d", index, len(elements))
+        }
+    case MapType:
+        key, err := args[1].toString()
+        if err != nil {
+            return nil, err
+        }
+        collection.Value.(map[string]*Variable)[key] = value
+    default:
+        return nil, fmt.Errorf("'set' action requires an array or a map, got %v", collection.Type)
+    }
+
+    return nil, s.checkSize(args[0])
+}
+
+func LenAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 1 {
+        return nil, fmt.Errorf("'len' action requires exactly 1 argument")
+    }
+
+    switch arg := args[0]; arg.Type {
+    case ArrayType:
+        return []*Variable{NewVariable(len(arg.Value.([]*Variable)), IntegerType)}, nil
+    case MapType:
+        return []*Variable{NewVariable(len(arg.Value.(map[string]*Variable)), IntegerType)}, nil
+    case StringType:
+        return []*Variable{NewVariable(len([]rune(arg.Value.(string))), IntegerType)}, nil
+    default:
+        return nil, fmt.Errorf("'len' action does not support %v", arg.Type)
+    }
+}
+
+func CallAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) < 1 {
+        return nil, fmt.Errorf("'call' action requires at least 1 argument")
+    }
+    if args[0].Type != ActionType {
+        return nil, fmt.Errorf("'call' action requires an action, got %v", args[0].Type)
+    }
+
+    return args[0].Value.(*Action).Invoke(s, args[1:], nil)
+}
+
+// ParamAction returns the value a param declared at the top level of the
+// script was given, which is bound before the script starts.
+func ParamAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) < 1 || args[0].Type != StringType {
+        return nil, fmt.Errorf("'param' action requires a name")
+    }
+
+    value, ok := s.params[args[0].Value.(string)]
+    if !ok {
+        return nil, fmt.Errorf("param '%s' must be declared at the top level of the script", args[0].Value)
+    }
+    return []*Variable{value}, nil
+}
+
+// ArgsAction returns the positional arguments the script was run with.
+func ArgsAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    elements := make([]*Variable, len(s.Args))
+    for i, arg := range s.Args {
+        elements[i] = NewVariable(arg, StringType)
+    }
+    return []*Variable{NewVariable(elements, ArrayType)}, nil
+}
+
+// TestAction declares a test. Its code block never runs as part of the
+// script, only when the script is run with RunTests.
+func TestAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 1 || args[0].Type != StringType {
+        return nil, fmt.Errorf("'test' action requires a name")
+    }
+    return []*Variable{NewVariable(false, BooleanType)}, nil
+}
+
+func TestActionValidator(s *Script, a *Action) error {
+    if a.Block == nil {
+        return fmt.Errorf("'test' action must have a code block")
+    }
+    return nil
+}
+
+func AssertAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) < 1 || args[0].Type != BooleanType {
+        return nil, fmt.Errorf("'assert' action requires a boolean argument")
+    }
+
+    if !args[0].Value.(bool) {
+        return nil, assertionError("assertion failed", args[1:])
+    }
+    return nil, nil
+}
+
+func AssertEqualAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) < 2 {
+        return nil, fmt.Errorf("'assertEqual' action requires 2 arguments")
+    }
+
+    actual, expected := args[0], args[1]
+    if difference := valuesDiffer(actual, expected, ""); difference != "" {
+        message := fmt.Sprintf("values differ%s\n    actual:   %s\n    expected: %s", difference, formatValue(actual), formatValue(expected))
+        return nil, assertionError(message, args[2:])
+    }
+    return nil, nil
+}
+
+// AssertErrorAction calls an action and fails unless the call fails. It
+// returns the message of the error, so it can be checked in turn.
+func AssertErrorAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) < 1 || args[0].Type != ActionType {
+        return nil, fmt.Errorf("'assertError' action requires an action")
+    }
+
+    action := args[0].Value.(*Action)
+    returning, returnValues := s.returning, s.returnValues
+    _, err := action.Invoke(s, args[1:], nil)
+    s.returning, s.returnValues = returning, returnValues
+    if err == nil {
+        return nil, fmt.Errorf("expected %s to fail", action)
+    }
+
+    message := err.Error()
+    var sourceErr *SourceError
+    if errors.As(err, &sourceErr) {
+        message = sourceErr.Message
+    }
+    return []*Variable{NewVariable(message, StringType)}, nil
+}
+
+func ReadFileAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 1 || args[0].Type != StringType {
+        return nil, fmt.Errorf("'readFile' action requires a path")
+    }
+
+    content, err := os.ReadFile(args[0].Value.(string))
+    if err != nil {
+        return nil, err
+    }
+    return []*Variable{NewVariable(string(content), StringType)}, nil
+}
+
+func WriteFileAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 2 || args[0].Type != StringType {
+        return nil, fmt.Errorf("'writeFile' action requires a path and the content")
+    }
+
+    content, err := args[1].toString()
+    if err != nil {
+        return nil, err
+    }
+    return nil, os.WriteFile(args[0].Value.(string), []byte(content), 0644)
+}
+
+// ExecAction runs a command and returns its output without the trailing
+// newline. The command is stopped when the script's context is done.
+func ExecAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) < 1 || args[0].Type != StringType {
+        return nil, fmt.Errorf("'exec' action requires a command")
+    }
+
+    command := args[0].Value.(string)
+    commandArgs := make([]string, len(args)-1)
+    for i, arg := range args[1:] {
+        value, err := arg.toString()
+        if err != nil {
+            return nil, err
+        }
+        commandArgs[i] = value
+    }
+
+    output, err := exec.CommandContext(s.Context(), command, commandArgs...).Output()
+    if err != nil {
+        var exitErr *exec.ExitError
+        if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+            return nil, fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(exitErr.Stderr)))
+        }
+        return nil, fmt.Errorf("%s: %w", command, err)
+    }
+    return []*Variable{NewVariable(strings.TrimSuffix(string(output), "\n"), StringType)}, nil
+}
+
+// FetchAction gets a URL and returns the body of the response.
+func FetchAction(s *Script, args ...*Variable) ([]*Variable, error) {
+    if len(args) != 1 || args[0].Type != StringType {
+        return nil, fmt.Errorf("'fetch' action requires a URL")
+    }
+
+    request, err := http.NewRequestWithContext(s.Context(), http.MethodGet, args[0].Value.(string), nil)
+    if err != nil {
+        return nil, err
+    }
+    response, err := fetchClient(s).Do(request)
+    if err != nil {
+        return nil, err
+    }
+    defer response.Body.Close()
+
+    body, err := io.ReadAll(response.Body)
+    if err != nil {
+        return nil, err
+    }
+    if response.StatusCode >= http.StatusBadRequest {
+        return nil, fmt.Errorf("fetching %s: %s", args[0].Value, response.Status)
+    }
+    return []*Variable{NewVariable(string(body), StringType)}, nil
+}
+
+// fetchClient follows redirects only to hosts the policy of the script
+// grants.
+func fetchClient(s *Script) *http.Client {
+    return &http.Client{
+        CheckRedirect: func(request *http.Request, via []*http.Request) error {
+            if len(via) >= 10 {
+                return fmt.Errorf("stopped after %d redirects", len(via))
+            }
+            if s.Policy == nil {
+                return nil
+            }
+            return s.Policy.checkCapability("fetch", Capability{Group: CapabilityNet, Scope: request.URL.Host})
+        },
+    }
+}
+
+func pathScope(args []*Variable) (string, error) {
+    return args[0].toString()
+}
+
+func commandScope(args []*Variable) (string, error) {
+    return args[0].toString()
+}
+
+func hostScope(args []*Variable) (string, error) {
+    address, err := args[0].toString()
+    if err != nil {
+        return "", err
+    }
+    parsed, err := url.Parse(address)
+    if err != nil {
+        return "", err
+    }
+    if parsed.Host == "" {
+        return "", fmt.Errorf("URL %s has no host", address)
+    }
+    return parsed.Host, nil
+}
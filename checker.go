@@ -0,0 +1,430 @@
+// checker.go
+package taskwrappr
+
+import (
+	"errors"
+	"fmt"
+)
+
+type typeBinding struct {
+	Type     VariableType
+	Declared bool
+}
+
+type typeScope struct {
+	parent    *typeScope
+	memory    *MemoryMap
+	variables map[string]*typeBinding
+	actions   map[string]*Signature
+}
+
+type typeChecker struct {
+	script      *Script
+	diagnostics Diagnostics
+	symbols     *symbolIndex
+}
+
+func newTypeScope(parent *typeScope, memory *MemoryMap) *typeScope {
+	return &typeScope{
+		parent:    parent,
+		memory:    memory,
+		variables: make(map[string]*typeBinding),
+		actions:   make(map[string]*Signature),
+	}
+}
+
+func (ts *typeScope) lookupVariable(name string) (*typeBinding, *typeScope) {
+	for scope := ts; scope != nil; scope = scope.parent {
+		if binding, ok := scope.variables[name]; ok {
+			return binding, scope
+		}
+		if scope.memory == nil {
+			continue
+		}
+		if variable := scope.memory.GetVariable(name); variable != nil {
+			declaredType, declared := scope.memory.GetVariableType(name)
+			if !declared {
+				declaredType = variable.Type
+			}
+			return &typeBinding{Type: declaredType, Declared: declared}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (ts *typeScope) lookupAction(name string) *Signature {
+	for scope := ts; scope != nil; scope = scope.parent {
+		if signature, ok := scope.actions[name]; ok {
+			return signature
+		}
+		if scope.memory == nil {
+			continue
+		}
+		if action := scope.memory.GetAction(name); action != nil {
+			return action.Signature
+		}
+	}
+	return nil
+}
+
+// lookupHostAction finds the action name refers to when the host provides
+// it, rather than the script declaring it.
+func (ts *typeScope) lookupHostAction(name string) *Action {
+	for scope := ts; scope != nil; scope = scope.parent {
+		if _, ok := scope.actions[name]; ok {
+			return nil
+		}
+		if _, ok := scope.variables[name]; ok {
+			return nil
+		}
+		if scope.memory == nil {
+			continue
+		}
+		if action := scope.memory.GetAction(name); action != nil {
+			return action
+		}
+	}
+	return nil
+}
+
+func (ts *typeScope) isAction(name string) bool {
+	for scope := ts; scope != nil; scope = scope.parent {
+		if _, ok := scope.actions[name]; ok {
+			return true
+		}
+		if scope.memory != nil && scope.memory.GetAction(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Script) checkTypes(program *BlockNode) error {
+	checker := &typeChecker{script: s}
+	checker.checkBlock(program, newTypeScope(nil, s.MainBlock.Memory))
+
+	if len(checker.diagnostics) > 0 {
+		return fmt.Errorf("type check failed:\n%w", checker.diagnostics)
+	}
+	return nil
+}
+
+func (c *typeChecker) report(pos Position, format string, args ...interface{}) {
+	c.diagnostics.add(SeverityError, c.script.errorfAt(pos, format, args...))
+}
+
+func (c *typeChecker) checkBlock(b *BlockNode, scope *typeScope) {
+	for _, statement := range b.Statements {
+		switch node := statement.(type) {
+		case *DeclarationNode:
+			c.checkDeclaration(node, scope)
+		case *ActionDeclarationNode:
+			c.checkActionDeclaration(node, scope)
+		case *AssignmentNode:
+			c.checkAssignment(node, scope)
+		case *AugmentedAssignmentNode:
+			c.checkAugmentedAssignment(node, scope)
+		case *ImportNode:
+			c.checkImport(node, scope)
+		case *CallStatementNode:
+			c.checkCall(node.Call, scope)
+			if scope.parent == nil {
+				c.checkParam(node.Call, scope)
+			}
+			if node.Body != nil {
+				c.checkBlock(node.Body, newTypeScope(scope, nil))
+			}
+		}
+	}
+}
+
+func (c *typeChecker) checkDeclaration(node *DeclarationNode, scope *typeScope) {
+	valueType := c.inferType(node.Value, scope)
+	binding := &typeBinding{Type: valueType}
+	if node.TypeName != "" {
+		if !IsAssignable(node.Type, valueType) {
+			c.report(node.Pos, "cannot use %v as %v in declaration of '%s'", valueType, node.Type, node.Name)
+		}
+		binding = &typeBinding{Type: node.Type, Declared: true}
+	}
+
+	scope.variables[node.Name] = binding
+	c.define(scope, node.Name, node.Pos, nil)
+}
+
+func (c *typeChecker) checkParameters(nodes []*ParameterNode, scope, bodyScope *typeScope) *Signature {
+	signature := NewSignature(AnyType)
+
+	for _, node := range nodes {
+		parameter := NewParameter(node.Name, node.Type)
+		if node.Default != nil {
+			parameter.Optional = true
+			if defaultType := c.inferType(node.Default, scope); !IsAssignable(parameter.Type, defaultType) {
+				c.report(node.Pos, "cannot use %v as %v for default of parameter '%s'", defaultType, parameter.Type, parameter.Name)
+			}
+		}
+
+		signature.Parameters = append(signature.Parameters, parameter)
+		if node.Variadic {
+			parameter.Variadic = true
+			bodyScope.variables[parameter.Name] = &typeBinding{Type: ArrayType}
+		} else {
+			bodyScope.variables[parameter.Name] = &typeBinding{Type: parameter.Type, Declared: parameter.Type != AnyType}
+		}
+		c.define(bodyScope, parameter.Name, node.Pos, nil)
+	}
+
+	return signature
+}
+
+func (c *typeChecker) checkActionDeclaration(node *ActionDeclarationNode, scope *typeScope) {
+	bodyScope := newTypeScope(scope, nil)
+	scope.actions[node.Name] = c.checkParameters(node.Parameters, scope, bodyScope)
+	c.define(scope, node.Name, node.Pos, node)
+	if node.Body != nil {
+		c.checkBlock(node.Body, bodyScope)
+	}
+}
+
+func (c *typeChecker) checkImport(node *ImportNode, scope *typeScope) {
+	if pathType := c.inferType(node.Path, scope); !IsAssignable(StringType, pathType) {
+		c.report(node.Path.Position(), "cannot use %v as module path", pathType)
+	}
+
+	name := node.Alias
+	if name == "" {
+		literal, ok := node.Path.(*LiteralNode)
+		if !ok || literal.Value.Type != StringType {
+			return
+		}
+		var err error
+		if name, err = moduleName(literal.Value.Value.(string)); err != nil {
+			c.report(node.Pos, "%v", err)
+			return
+		}
+	}
+	scope.variables[name] = &typeBinding{Type: MapType}
+	c.define(scope, name, node.Pos, nil)
+}
+
+func (c *typeChecker) checkAssignment(node *AssignmentNode, scope *typeScope) {
+	name := node.Name
+	valueType := c.inferType(node.Value, scope)
+
+	binding, owner := scope.lookupVariable(name)
+	switch {
+	case binding == nil:
+		scope.variables[name] = &typeBinding{Type: valueType}
+	case binding.Declared:
+		if !IsAssignable(binding.Type, valueType) {
+			c.report(node.Pos, "cannot assign %v to '%s' of type %v", valueType, name, binding.Type)
+		}
+	case owner == scope:
+		binding.Type = valueType
+	case owner != nil:
+		binding.Type = AnyType
+	}
+
+	if binding == nil {
+		c.define(scope, name, node.Pos, nil)
+	} else {
+		c.refer(scope, name, node.Pos)
+	}
+}
+
+func (c *typeChecker) checkAugmentedAssignment(node *AugmentedAssignmentNode, scope *typeScope) {
+	name, operator := node.Name, node.Operator
+	valueType := c.inferType(node.Value, scope)
+	c.refer(scope, name, node.Pos)
+
+	if binding, _ := scope.lookupVariable(name); binding != nil && binding.Declared && !isNumericType(binding.Type) {
+		c.report(node.Pos, "operator %s is not supported for '%s' of type %v", operator, name, binding.Type)
+	}
+	if valueType == StringType {
+		c.report(node.Value.Position(), "operator %s requires a number, got %v", operator, valueType)
+	}
+}
+
+func (c *typeChecker) checkCall(node *CallNode, scope *typeScope) VariableType {
+	var args []*Variable
+	named := make(map[string]*Variable)
+	for _, argument := range node.Arguments {
+		value := NewVariable(nil, c.inferType(argument.Value, scope))
+		if argument.Name != "" {
+			named[argument.Name] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+
+	if node.Name == "" {
+		if calleeType := c.inferType(node.Callee, scope); calleeType != ActionType && calleeType != AnyType {
+			c.report(node.Pos, "cannot call %v", calleeType)
+		}
+		return AnyType
+	}
+
+	c.referCallee(node.Callee, scope)
+	signature := scope.lookupAction(node.Name)
+	if signature == nil {
+		return AnyType
+	}
+
+	bound, err := signature.Bind(node.Name, args, named)
+	if err != nil {
+		c.report(node.Pos, "%v", err)
+		return signature.Returns
+	}
+	if c.script.Policy != nil {
+		c.checkPolicy(node, scope)
+	}
+
+	fixed := signature.FixedParameters()
+	for i, arg := range bound {
+		parameter := signature.VariadicParameter()
+		if i < len(fixed) {
+			parameter = fixed[i]
+		}
+		if arg != nil && !IsAssignable(parameter.Type, arg.Type) {
+			c.report(node.Pos, "cannot use %v as %v for parameter '%s' of '%s' action", arg.Type, parameter.Type, parameter.Name, node.Name)
+		}
+	}
+
+	return signature.Returns
+}
+
+// checkPolicy reports calls of host actions the policy does not allow. The
+// scope of a call is only known when its arguments are constants.
+func (c *typeChecker) checkPolicy(node *CallNode, scope *typeScope) {
+	action := scope.lookupHostAction(node.Name)
+	if action == nil || action.requirement == nil {
+		return
+	}
+
+	var args []*Variable
+	named := make(map[string]*Variable)
+	for _, argument := range node.Arguments {
+		value, ok := foldConstant(argument.Value)
+		if !ok {
+			if err := c.script.Policy.checkGroup(action); err != nil {
+				c.report(node.Pos, "%v", err)
+			}
+			return
+		}
+		if argument.Name != "" {
+			named[argument.Name] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+
+	if action.Signature != nil {
+		bound, err := action.Signature.Bind(node.Name, args, named)
+		if err != nil {
+			return
+		}
+		args = bound
+	}
+	var policyErr *PolicyError
+	if err := c.script.Policy.check(action, args); errors.As(err, &policyErr) {
+		c.report(node.Pos, "%v", err)
+	}
+}
+
+// checkParam declares the variable a param call at the top level binds.
+func (c *typeChecker) checkParam(node *CallNode, scope *typeScope) {
+	if node.Name != "param" || len(node.Arguments) < 2 || node.Arguments[0].Name != "" || node.Arguments[1].Name != "" {
+		return
+	}
+	name, ok := foldConstant(node.Arguments[0].Value)
+	if !ok || name.Type != StringType {
+		return
+	}
+	typeName, ok := foldConstant(node.Arguments[1].Value)
+	if !ok || typeName.Type != StringType {
+		return
+	}
+	paramType, err := ParseVariableType(typeName.Value.(string))
+	if err != nil {
+		return
+	}
+
+	scope.variables[name.Value.(string)] = &typeBinding{Type: paramType, Declared: true}
+	c.define(scope, name.Value.(string), node.Pos, nil)
+}
+
+func (c *typeChecker) inferType(expr Expression, scope *typeScope) VariableType {
+	switch node := expr.(type) {
+	case *LiteralNode:
+		return node.Value.Type
+	case *IdentifierNode:
+		c.refer(scope, node.Name, node.Pos)
+		if binding, _ := scope.lookupVariable(node.Name); binding != nil {
+			return binding.Type
+		}
+		if scope.isAction(node.Name) {
+			return ActionType
+		}
+		return AnyType
+	case *CallNode:
+		return c.checkCall(node, scope)
+	case *IndexNode:
+		targetType := c.inferType(node.Target, scope)
+		c.inferType(node.Index, scope)
+		switch targetType {
+		case StringType:
+			return StringType
+		case ArrayType, MapType, AnyType:
+		default:
+			c.report(node.Pos, "cannot index %v", targetType)
+		}
+		return AnyType
+	case *FieldNode:
+		if targetType := c.inferType(node.Target, scope); targetType != MapType && targetType != AnyType {
+			c.report(node.Pos, "cannot access field '%s' of %v", node.Name, targetType)
+		}
+		return AnyType
+	case *LambdaNode:
+		bodyScope := newTypeScope(scope, nil)
+		c.checkParameters(node.Parameters, scope, bodyScope)
+		c.checkBlock(node.Body, bodyScope)
+		return ActionType
+	case *UnaryNode:
+		operand := c.inferType(node.Operand, scope)
+		if node.Operator == LogicalNotToken {
+			return BooleanType
+		}
+		if operand != AnyType && !isNumericType(operand) {
+			c.report(node.Pos, "unary minus requires a number, got %v", operand)
+		}
+		return FloatType
+	case *BinaryNode:
+		a, b := c.inferType(node.Left, scope), c.inferType(node.Right, scope)
+		switch node.Operator {
+		case OperatorAddToken:
+			switch {
+			case a == NilType || b == NilType:
+				c.report(node.Pos, "operands of + cannot be nil")
+				return AnyType
+			case a == StringType || b == StringType:
+				return StringType
+			case a == AnyType || b == AnyType:
+				return AnyType
+			}
+			return FloatType
+		case OperatorSubtractToken, OperatorMultiplyToken, OperatorDivideToken, OperatorModuloToken, OperatorExponentToken:
+			if a == NilType || b == NilType {
+				c.report(node.Pos, "operands of %s cannot be nil", node.Symbol)
+			} else if (a == StringType || b == StringType) && node.Operator != OperatorModuloToken && node.Operator != OperatorExponentToken {
+				c.report(node.Pos, "operator %s is not supported for strings", node.Symbol)
+			}
+			return FloatType
+		}
+		return BooleanType
+	}
+	return AnyType
+}
+
+func isNumericType(t VariableType) bool {
+	return t == IntegerType || t == FloatType || t == AnyType
+}
@@ -0,0 +1,73 @@
+// checker_test.go
+package taskwrappr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTypeAnnotations(t *testing.T) {
+	s, err := NewScript("scripts/types.tw", GetBuiltIn())
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+
+	if err := s.Run(); err != nil {
+		t.Errorf("run returned an error: %s", err)
+	}
+}
+
+func TestTypeCheckRunsBeforeExecution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mismatch.tw")
+	content := "marker = 1\ncount: int := \"zero\"\nif(count) {\n\tprint(count)\n}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	memory := GetBuiltIn()
+	memory.Variables["marker"] = NewVariable(0, IntegerType)
+
+	s, err := NewScript(path, memory)
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+
+	err = s.Run()
+	if err == nil {
+		t.Fatalf("run should have failed the type check")
+	}
+	for _, expected := range []string{"declaration of 'count'", "parameter 'condition' of 'if'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to mention %q, got: %s", expected, err)
+		}
+	}
+	if marker := memory.Variables["marker"].Value; marker != 0 {
+		t.Errorf("script executed before the type check, marker is %v", marker)
+	}
+}
+
+func TestCheckSource(t *testing.T) {
+	memory := GetBuiltIn()
+	memory.Variables["name"] = NewVariable("api", StringType)
+
+	s, err := NewScriptFromSource("<stdin>", "count: int := name\nprint(count +)\n", memory)
+	if err != nil {
+		t.Fatalf("NewScriptFromSource returned an error: %s", err)
+	}
+
+	diagnostics, err := s.Check()
+	if err != nil {
+		t.Fatalf("Check returned an error: %s", err)
+	}
+	if len(diagnostics) != 2 || diagnostics[0].Pos.Line != 1 || diagnostics[1].Pos.Line != 2 {
+		t.Errorf("expected an error on each line, got:\n%s", diagnostics)
+	}
+
+	var runDiagnostics Diagnostics
+	if err := s.Run(); !errors.As(err, &runDiagnostics) {
+		t.Errorf("expected Run to fail with diagnostics, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// cover.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// coverCommand runs scripts with coverage enabled and adds their counts to
+// an LCOV file, so coverage builds up across invocations. It can also
+// write an HTML report of the combined counts.
+func coverCommand(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	output := flags.String("o", "coverage.lcov", "LCOV file to merge the coverage into")
+	report := flags.String("html", "", "file to write an HTML report to")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: taskwrappr cover [-o coverage.lcov] [-html report.html] script.tw...")
+		return exitUsage
+	}
+
+	coverage := taskwrappr.NewCoverage()
+	if file, err := os.Open(*output); err == nil {
+		err = coverage.ReadLCOV(file)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *output, err)
+			return exitFailure
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	status := exitOK
+	for _, path := range flags.Args() {
+		script, err := openScript(path, memory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitNoInput
+			continue
+		}
+		script.Coverage = coverage
+		if err := script.Run(); err != nil {
+			status = failure(err)
+		}
+	}
+
+	if err := writeFile(*output, coverage.WriteLCOV); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if *report != "" {
+		if err := writeFile(*report, coverage.WriteHTML); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+
+	for _, file := range coverage.Files() {
+		lines, linesHit, branches, branchesHit := file.Summary()
+		fmt.Fprintf(os.Stderr, "%s: %d/%d lines, %d/%d branches\n", file.Path, linesHit, lines, branchesHit, branches)
+	}
+	return status
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
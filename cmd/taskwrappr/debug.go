@@ -0,0 +1,50 @@
+// debug.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// debugCommand runs a script under the terminal debugger, or serves the
+// Debug Adapter Protocol over stdio with -dap so an editor can drive it.
+func debugCommand(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	dap := flags.Bool("dap", false, "speak the Debug Adapter Protocol over stdio")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if *dap {
+		if err := taskwrappr.ServeDebugAdapter(os.Stdin, os.Stdout, memory); err != nil {
+			return failure(err)
+		}
+		return exitOK
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: taskwrappr debug [-dap] [script.tw]")
+		return exitUsage
+	}
+	script, err := openScript(flags.Arg(0), memory)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitNoInput
+	}
+	script.Debugger = taskwrappr.NewTerminalDebugger(os.Stdin, os.Stdout)
+
+	if err := script.Run(); err != nil && !errors.Is(err, taskwrappr.ErrDebugAborted) {
+		return failure(err)
+	}
+	return exitOK
+}
@@ -0,0 +1,111 @@
+// fmt.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// formatCommand formats the given files, or every .tw file under the
+// given directories, in place. With no paths it formats stdin to stdout.
+// -check lists the files that are not formatted and fails when there are
+// any.
+func formatCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list files that are not formatted instead of rewriting them")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitNoInput
+		}
+		formatted, err := taskwrappr.Format("<stdin>", string(source))
+		if err != nil {
+			return failure(err)
+		}
+		if *check {
+			if formatted != string(source) {
+				fmt.Println("<stdin>")
+				return exitFailure
+			}
+			return exitOK
+		}
+		fmt.Print(formatted)
+		return exitOK
+	}
+
+	paths, err := scriptPaths(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitNoInput
+	}
+
+	status := exitOK
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitNoInput
+			continue
+		}
+		formatted, err := taskwrappr.Format(path, string(source))
+		if err != nil {
+			status = failure(err)
+			continue
+		}
+		if formatted == string(source) {
+			continue
+		}
+
+		if *check {
+			fmt.Println(path)
+			if status == exitOK {
+				status = exitFailure
+			}
+			continue
+		}
+		if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitFailure
+		}
+	}
+	return status
+}
+
+func scriptPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && filepath.Ext(path) == taskwrappr.ModuleExtension {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,30 @@
+// lsp.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// lspCommand serves the Language Server Protocol over stdio. The variables
+// given with --var and --vars-file are known to the type checker.
+func lspCommand(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err := taskwrappr.ServeLanguageServer(os.Stdin, os.Stdout, memory); err != nil {
+		return failure(err)
+	}
+	return exitOK
+}
@@ -0,0 +1,101 @@
+// main.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// Exit codes of the taskwrappr command.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the script failed while running, or tests failed
+	exitUsage   = 2 // the command line is wrong
+	exitInvalid = 3 // the script does not parse or type check
+	exitNoInput = 4 // the script cannot be read
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "run [flags] file|- [--] [args...]", "run a script", runCommand},
+		{"check", "check [flags] file...", "parse and type check scripts without running them", checkCommand},
+		{"fmt", "fmt [-check] [path...]", "format scripts in place, or stdin to stdout", formatCommand},
+		{"test", "test [flags] [path...]", "run the tests of *_test.tw files", testCommand},
+		{"cover", "cover [flags] file...", "run scripts and record their coverage", coverCommand},
+		{"profile", "profile [flags] file", "run a script under the profiler", profileCommand},
+		{"debug", "debug [flags] [file]", "run a script under the debugger", debugCommand},
+		{"repl", "repl [flags]", "start an interactive session", replCommand},
+		{"lsp", "lsp [flags]", "serve the Language Server Protocol over stdio", lspCommand},
+		{"version", "version", "print the version", versionCommand},
+	}
+}
+
+// main runs a subcommand. A first argument that is no subcommand is taken
+// as a script to run, which is what executing a script starting with
+// #!/usr/bin/env taskwrappr comes down to.
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name := os.Args[1]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		usage()
+		os.Exit(exitOK)
+	}
+	for _, command := range commands {
+		if command.name == name {
+			os.Exit(command.run(os.Args[2:]))
+		}
+	}
+	if name == "-" || !strings.HasPrefix(name, "-") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: taskwrappr <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "       taskwrappr file [args...]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", command.name, command.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run 'taskwrappr <command> -h' for the flags of a command")
+}
+
+// failure reports err and returns the exit code it maps to.
+func failure(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+
+	var diagnostics taskwrappr.Diagnostics
+	if errors.As(err, &diagnostics) {
+		return exitInvalid
+	}
+	return exitFailure
+}
+
+func versionCommand(args []string) int {
+	fmt.Printf("taskwrappr %s\n", version())
+	return exitOK
+}
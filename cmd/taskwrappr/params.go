@@ -0,0 +1,82 @@
+// params.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+var errMissingParam = errors.New("missing required param")
+
+// paramFlag sets a script param from the command line. The value is
+// converted to the type of the param as soon as it is parsed.
+type paramFlag struct {
+	param  *taskwrappr.Param
+	values map[string]*taskwrappr.Variable
+}
+
+func (f *paramFlag) String() string {
+	if f == nil || f.param == nil {
+		return ""
+	}
+	if value, ok := f.values[f.param.Name]; ok {
+		return fmt.Sprint(value.Value)
+	}
+	if f.param.Default != nil {
+		return fmt.Sprint(f.param.Default.Value)
+	}
+	return ""
+}
+
+func (f *paramFlag) Set(value string) error {
+	converted, err := taskwrappr.NewVariable(value, taskwrappr.StringType).CastTo(f.param.Type)
+	if err != nil {
+		return err
+	}
+	f.values[f.param.Name] = taskwrappr.NewVariable(converted, f.param.Type)
+	return nil
+}
+
+func (f *paramFlag) IsBoolFlag() bool {
+	return f.param.Type == taskwrappr.BooleanType
+}
+
+// parseParams parses the arguments that follow a script with flags made
+// of the params it declares, and leaves the positional ones in
+// script.Args. -help lists the params.
+func parseParams(script *taskwrappr.Script, params []*taskwrappr.Param, args []string) error {
+	flags := flag.NewFlagSet(script.Path, flag.ContinueOnError)
+	values := make(map[string]*taskwrappr.Variable)
+	for _, param := range params {
+		usage := param.Description
+		if param.Required() {
+			usage += " (required)"
+		}
+		flags.Var(&paramFlag{param: param, values: values}, param.Name, usage)
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: taskwrappr run %s [params] [--] [args...]\n", script.Path)
+		if len(params) > 0 {
+			fmt.Fprintln(flags.Output(), "\nparams:")
+			flags.PrintDefaults()
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	for _, param := range params {
+		if _, ok := values[param.Name]; !ok && param.Required() {
+			fmt.Fprintf(flags.Output(), "missing required param -%s\n", param.Name)
+			flags.Usage()
+			return errMissingParam
+		}
+	}
+
+	script.ParamValues = values
+	script.Args = flags.Args()
+	return nil
+}
@@ -0,0 +1,39 @@
+// policy.go
+package main
+
+import (
+	"flag"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// policyFlags are the flags that sandbox a script: -allow grants a
+// capability and may be repeated, -sandbox grants nothing but what -allow
+// does even when it is not given.
+type policyFlags struct {
+	allowed []string
+	sandbox bool
+}
+
+func addPolicyFlags(flags *flag.FlagSet) *policyFlags {
+	p := &policyFlags{}
+	flags.Func("allow", "grant a `capability` such as fs.read, fs.write:/tmp/work, exec:git or net:localhost", func(value string) error {
+		if _, err := taskwrappr.ParseCapability(value); err != nil {
+			return err
+		}
+		p.allowed = append(p.allowed, value)
+		return nil
+	})
+	flags.BoolVar(&p.sandbox, "sandbox", false, "deny every capability that is not granted with -allow")
+	return p
+}
+
+// policy returns the policy the flags describe, or nil when scripts may
+// do anything.
+func (p *policyFlags) policy() *taskwrappr.Policy {
+	if !p.sandbox && len(p.allowed) == 0 {
+		return nil
+	}
+	policy, _ := taskwrappr.NewPolicy(p.allowed...)
+	return policy
+}
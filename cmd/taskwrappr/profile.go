@@ -0,0 +1,51 @@
+// profile.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// profileCommand runs a script under the profiler, writes a profile go tool
+// pprof can read and prints the most expensive actions and lines.
+func profileCommand(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	output := flags.String("o", "taskwrappr.pprof", "file to write the pprof profile to")
+	top := flags.Int("top", 10, "number of actions and lines to summarize")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: taskwrappr profile [-o file] [-top n] script.tw")
+		return exitUsage
+	}
+
+	script, err := openScript(flags.Arg(0), memory)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitNoInput
+	}
+	profiler := taskwrappr.NewProfiler()
+	script.Profiler = profiler
+
+	status := exitOK
+	if err := script.Run(); err != nil {
+		status = failure(err)
+	}
+
+	if err := writeFile(*output, profiler.WritePprof); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	profiler.WriteSummary(os.Stderr, *top)
+	return status
+}
@@ -0,0 +1,38 @@
+// repl.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// replCommand starts an interactive session, keeping its history in the
+// home directory.
+func replCommand(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	repl, err := taskwrappr.NewREPL(memory)
+	if err != nil {
+		return failure(err)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		repl.HistoryFile = filepath.Join(home, ".taskwrappr_history")
+	}
+	if err := repl.Run(os.Stdin, os.Stdout); err != nil {
+		return failure(err)
+	}
+	return exitOK
+}
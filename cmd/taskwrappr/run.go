@@ -0,0 +1,154 @@
+// run.go
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+const stdinPath = "-"
+
+// buildVersion is set with -ldflags "-X main.buildVersion=..." on release
+// builds.
+var buildVersion string
+
+// runCommand runs a script file, or the script read from stdin when the
+// file is -. The arguments after the file set the params the script
+// declares, the rest are left to the script. An interrupt or -timeout
+// stops the script.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	policyFlags := addPolicyFlags(flags)
+	engine := taskwrappr.BytecodeEngine
+	flags.Func("engine", "run the script on the `engine` named tree or bytecode (default bytecode)", func(value string) error {
+		var err error
+		engine, err = taskwrappr.ParseEngine(value)
+		return err
+	})
+	timeout := flags.Duration("timeout", 0, "stop the script after this long")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: taskwrappr run [flags] file|- [--] [args...]")
+		return exitUsage
+	}
+
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	script, err := openScript(flags.Arg(0), memory)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitNoInput
+	}
+	script.Policy = policyFlags.policy()
+	script.Engine = engine
+
+	params, err := script.Params()
+	if err != nil {
+		return failure(err)
+	}
+	if err := parseParams(script, params, flags.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	if err := script.RunContext(ctx); err != nil {
+		return failure(err)
+	}
+	return exitOK
+}
+
+// checkCommand reports every syntax and type error of the given scripts.
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	policyFlags := addPolicyFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: taskwrappr check [flags] file...")
+		return exitUsage
+	}
+
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	status := exitOK
+	for _, path := range flags.Args() {
+		script, err := openScript(path, memory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitNoInput
+			continue
+		}
+		script.Policy = policyFlags.policy()
+		diagnostics, err := script.Check()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitNoInput
+			continue
+		}
+		if len(diagnostics) > 0 {
+			fmt.Fprintln(os.Stderr, diagnostics)
+		}
+		if diagnostics.HasErrors() && status == exitOK {
+			status = exitInvalid
+		}
+	}
+	return status
+}
+
+// openScript makes a script of a file, or of stdin for -.
+func openScript(path string, memory *taskwrappr.MemoryMap) (*taskwrappr.Script, error) {
+	if path == stdinPath {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return taskwrappr.NewScriptFromSource("<stdin>", string(source), memory)
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return taskwrappr.NewScriptFromSource(path, string(source), memory)
+}
+
+func version() string {
+	version := buildVersion
+	if version == "" {
+		version = "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			version = info.Main.Version
+		}
+	}
+	return fmt.Sprintf("%s %s/%s %s", version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
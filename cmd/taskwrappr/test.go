@@ -0,0 +1,112 @@
+// test.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+const testFileSuffix = "_test.tw"
+
+// testCommand runs the test blocks of every *_test.tw file found in the
+// given files and directories, the current directory by default.
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	memoryFlags := addMemoryFlags(flags)
+	pattern := flags.String("run", "", "only run tests whose name matches the regular expression")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	memory, err := memoryFlags.memory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	var filter func(name string) bool
+	if *pattern != "" {
+		expression, err := regexp.Compile(*pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		filter = expression.MatchString
+	}
+
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	files, err := findTestFiles(roots)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitNoInput
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files found")
+		return exitNoInput
+	}
+
+	status := exitOK
+	for _, path := range files {
+		start := time.Now()
+		script, err := openScript(path, memory)
+		var results []*taskwrappr.TestResult
+		if err == nil {
+			results, err = script.RunTests(filter)
+		}
+
+		failed := err != nil
+		for _, result := range results {
+			outcome := "PASS"
+			if !result.Passed() {
+				outcome, failed = "FAIL", true
+			}
+			fmt.Printf("--- %s: %s (%.3fs)\n", outcome, result.Name, result.Duration.Seconds())
+			if !result.Passed() {
+				fmt.Println(indent(result.Err.Error()))
+			}
+		}
+		if err != nil {
+			fmt.Println(indent(err.Error()))
+		}
+
+		outcome := "ok  "
+		if failed {
+			outcome, status = "FAIL", exitFailure
+		}
+		fmt.Printf("%s %s (%.3fs)\n", outcome, path, time.Since(start).Seconds())
+	}
+	return status
+}
+
+func findTestFiles(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == root && !entry.IsDir() || !entry.IsDir() && strings.HasSuffix(path, testFileSuffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(strings.TrimRight(text, "\n"), "\n", "\n    ")
+}
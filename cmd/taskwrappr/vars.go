@@ -0,0 +1,108 @@
+// vars.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"smuggr.xyz/taskwrappr"
+)
+
+// memoryFlags are the flags that seed the memory scripts run against:
+// --var name=value, which may be repeated, and --vars-file with a JSON
+// object of variables. Variables given with --var win over the file's.
+type memoryFlags struct {
+	vars  []string
+	files []string
+}
+
+func addMemoryFlags(flags *flag.FlagSet) *memoryFlags {
+	m := &memoryFlags{}
+	flags.Func("var", "set a host variable, as `name=value`", func(value string) error {
+		if name, _, ok := strings.Cut(value, "="); !ok || name == "" {
+			return fmt.Errorf("expected name=value, got %q", value)
+		}
+		m.vars = append(m.vars, value)
+		return nil
+	})
+	flags.Func("vars-file", "set host variables from a JSON object in `file`", func(path string) error {
+		m.files = append(m.files, path)
+		return nil
+	})
+	return m
+}
+
+// memory returns the builtins with the variables given on the command line.
+func (m *memoryFlags) memory() (*taskwrappr.MemoryMap, error) {
+	memory := taskwrappr.GetBuiltIn()
+	for _, path := range m.files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		var values map[string]interface{}
+		if err := decoder.Decode(&values); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for name, value := range values {
+			memory.Variables[name] = jsonVariable(value)
+		}
+	}
+
+	for _, assignment := range m.vars {
+		name, value, _ := strings.Cut(assignment, "=")
+		memory.Variables[name] = literalVariable(value)
+	}
+	return memory, nil
+}
+
+// literalVariable reads a value given on the command line as a boolean or
+// a number when it looks like one, and as a string otherwise.
+func literalVariable(value string) *taskwrappr.Variable {
+	if value == "true" || value == "false" {
+		return taskwrappr.NewVariable(value == "true", taskwrappr.BooleanType)
+	}
+	if number, err := strconv.Atoi(value); err == nil {
+		return taskwrappr.NewVariable(number, taskwrappr.IntegerType)
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return taskwrappr.NewVariable(number, taskwrappr.FloatType)
+	}
+	return taskwrappr.NewVariable(value, taskwrappr.StringType)
+}
+
+func jsonVariable(value interface{}) *taskwrappr.Variable {
+	switch value := value.(type) {
+	case bool:
+		return taskwrappr.NewVariable(value, taskwrappr.BooleanType)
+	case string:
+		return taskwrappr.NewVariable(value, taskwrappr.StringType)
+	case json.Number:
+		if number, err := strconv.Atoi(value.String()); err == nil {
+			return taskwrappr.NewVariable(number, taskwrappr.IntegerType)
+		}
+		number, _ := value.Float64()
+		return taskwrappr.NewVariable(number, taskwrappr.FloatType)
+	case []interface{}:
+		elements := make([]*taskwrappr.Variable, len(value))
+		for i, element := range value {
+			elements[i] = jsonVariable(element)
+		}
+		return taskwrappr.NewVariable(elements, taskwrappr.ArrayType)
+	case map[string]interface{}:
+		entries := make(map[string]*taskwrappr.Variable, len(value))
+		for key, entry := range value {
+			entries[key] = jsonVariable(entry)
+		}
+		return taskwrappr.NewVariable(entries, taskwrappr.MapType)
+	}
+	return taskwrappr.NewVariable(nil, taskwrappr.NilType)
+}
@@ -0,0 +1,618 @@
+// compiler.go
+package taskwrappr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type OpCode byte
+
+// Every operand is a two byte big-endian index into one of the chunk
+// tables, a local slot, a type, an operator or a forward jump offset.
+const (
+	OpConstant        OpCode = iota // constant: push a constant
+	OpGetLocal                      // slot, name: push a local
+	OpGetName                       // name: push a variable or action from memory
+	OpGetVariable                   // name: push a variable from memory, actions excluded
+	OpIndex                         // pop index and target, push target[index]
+	OpField                         // name: pop a map, push its field
+	OpUnary                         // operator: pop one operand, push the result
+	OpBinary                        // operator: pop two operands, push the result
+	OpClosure                       // function: push an action closing over the current scope
+	OpCall                          // site: call an action, the site says where the results go
+	OpDeclareLocal                  // slot: create a nil local before its value is evaluated
+	OpDefineLocal                   // slot, name, type: pop the declared value into a local
+	OpSetLocal                      // slot, name, type: pop a value into a local
+	OpDeclareName                   // name, typed, type: create a nil variable in the current scope
+	OpDefineName                    // name, type: pop the declared value into the variable
+	OpSetName                       // name: pop a value into a variable
+	OpAugmentLocal                  // name, operator, type: pop a value and apply it to the variable below it
+	OpAugmentName                   // name, operator: like OpAugmentLocal with the type looked up in memory
+	OpImport                        // alias: pop a module path and bind the module
+	OpDefineAction                  // function, name: declare an action in the current scope
+	OpTestResult                    // jump: skip a code block unless the statement result is true
+	OpEnterScope                    // open a nested scope
+	OpExitScope                     // close the innermost scope
+	OpEndStatement                  // leave the function when an action returned
+	OpParameter                     // index, jump: push a bound argument and skip its default
+	OpMissingArgument               // index: fail on an omitted required argument
+	OpBindLocal                     // index, slot: pop an argument into a local
+	OpBindName                      // index: pop an argument into the call scope
+	OpVariadic                      // index: push the arguments collected by the variadic parameter
+	OpReturn                        // leave the function
+)
+
+var opCodes = [...]struct {
+	name     string
+	operands int
+}{
+	OpConstant:        {"CONSTANT", 1},
+	OpGetLocal:        {"GET_LOCAL", 2},
+	OpGetName:         {"GET_NAME", 1},
+	OpGetVariable:     {"GET_VARIABLE", 1},
+	OpIndex:           {"INDEX", 0},
+	OpField:           {"FIELD", 1},
+	OpUnary:           {"UNARY", 1},
+	OpBinary:          {"BINARY", 1},
+	OpClosure:         {"CLOSURE", 1},
+	OpCall:            {"CALL", 1},
+	OpDeclareLocal:    {"DECLARE_LOCAL", 1},
+	OpDefineLocal:     {"DEFINE_LOCAL", 3},
+	OpSetLocal:        {"SET_LOCAL", 3},
+	OpDeclareName:     {"DECLARE_NAME", 3},
+	OpDefineName:      {"DEFINE_NAME", 2},
+	OpSetName:         {"SET_NAME", 1},
+	OpAugmentLocal:    {"AUGMENT_LOCAL", 3},
+	OpAugmentName:     {"AUGMENT_NAME", 2},
+	OpImport:          {"IMPORT", 1},
+	OpDefineAction:    {"DEFINE_ACTION", 2},
+	OpTestResult:      {"TEST_RESULT", 1},
+	OpEnterScope:      {"ENTER_SCOPE", 0},
+	OpExitScope:       {"EXIT_SCOPE", 0},
+	OpEndStatement:    {"END_STATEMENT", 0},
+	OpParameter:       {"PARAMETER", 2},
+	OpMissingArgument: {"MISSING_ARGUMENT", 1},
+	OpBindLocal:       {"BIND_LOCAL", 2},
+	OpBindName:        {"BIND_NAME", 1},
+	OpVariadic:        {"VARIADIC", 1},
+	OpReturn:          {"RETURN", 0},
+}
+
+const maxOperand = 1<<16 - 1
+
+func (op OpCode) String() string {
+	if int(op) < len(opCodes) {
+		return opCodes[op].name
+	}
+	return fmt.Sprintf("OP_%d", op)
+}
+
+type callMode int
+
+const (
+	expressionResult callMode = iota
+	argumentResult
+	statementResult
+)
+
+// callSite describes a call instruction. The callee is either bound when
+// the script is compiled, taken from the stack, or resolved by name (from
+// a local slot when slot is not negative) when the call runs.
+type callSite struct {
+	name      string
+	path      []string
+	names     []string
+	arguments int
+	slot      int
+	callee    bool
+	action    *Action
+	mode      callMode
+}
+
+type codePosition struct {
+	offset int
+	pos    Position
+}
+
+// Chunk holds the bytecode of one function together with the tables its
+// operands index into.
+type Chunk struct {
+	Code      []byte
+	Constants []value
+	Names     []string
+	Functions []*Function
+	sites     []*callSite
+	positions []codePosition
+}
+
+// Function is a compiled action body, or the body of a whole script.
+// Parameters and variables declared in an action body live in Slots
+// numbered local slots of its call frame unless a nested action or
+// lambda refers to them, those stay in the memory the closure captures.
+type Function struct {
+	Name      string
+	Signature *Signature
+	Chunk     *Chunk
+	Slots     int
+}
+
+func (c *Chunk) operand(offset int) int {
+	return int(c.Code[offset])<<8 | int(c.Code[offset+1])
+}
+
+// position returns the source position of the instruction at offset,
+// instructions without one are reported at their call site.
+func (c *Chunk) position(offset int) Position {
+	i := sort.Search(len(c.positions), func(i int) bool {
+		return c.positions[i].offset > offset
+	})
+	if i == 0 {
+		return Position{}
+	}
+	return c.positions[i-1].pos
+}
+
+func (c *Chunk) String() string {
+	var out strings.Builder
+	for offset := 0; offset < len(c.Code); {
+		op := OpCode(c.Code[offset])
+		fmt.Fprintf(&out, "%04d %s", offset, op)
+		offset++
+		if int(op) < len(opCodes) {
+			for i := 0; i < opCodes[op].operands; i++ {
+				fmt.Fprintf(&out, " %d", c.operand(offset))
+				offset += 2
+			}
+		}
+		out.WriteRune(NewLineSymbol)
+	}
+	return out.String()
+}
+
+type local struct {
+	slot int
+	Type VariableType
+}
+
+type constantKey struct {
+	Type  VariableType
+	Value interface{}
+}
+
+type compiler struct {
+	script    *Script
+	function  *Function
+	chunk     *Chunk
+	slots     bool
+	captured  map[string]bool
+	scopes    []map[string]*local
+	starts    []int
+	nextSlot  int
+	position  Position
+	constants map[constantKey]int
+	names     map[string]int
+	err       error
+}
+
+func newCompiler(s *Script, function *Function) *compiler {
+	function.Chunk = &Chunk{}
+	return &compiler{
+		script:    s,
+		function:  function,
+		chunk:     function.Chunk,
+		constants: make(map[constantKey]int),
+		names:     make(map[string]int),
+	}
+}
+
+func (s *Script) compile(program *BlockNode) (*Function, error) {
+	c := newCompiler(s, &Function{Name: s.Path})
+	c.beginScope()
+	c.compileStatements(program.Statements)
+	c.emit(OpReturn)
+	return c.function, c.err
+}
+
+func (c *compiler) fail(pos Position, format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = c.script.errorfAt(pos, format, args...)
+	}
+}
+
+func (c *compiler) emit(op OpCode, operands ...int) int {
+	if n := len(c.chunk.positions); n == 0 || c.chunk.positions[n-1].pos != c.position {
+		c.chunk.positions = append(c.chunk.positions, codePosition{offset: len(c.chunk.Code), pos: c.position})
+	}
+
+	c.chunk.Code = append(c.chunk.Code, byte(op))
+	for _, operand := range operands {
+		if operand < 0 || operand > maxOperand {
+			c.fail(c.position, "'%s' is too large to compile", c.function.Name)
+		}
+		c.chunk.Code = append(c.chunk.Code, byte(operand>>8), byte(operand))
+	}
+	return len(c.chunk.Code) - 2
+}
+
+func (c *compiler) patchJump(operand int) {
+	jump := len(c.chunk.Code) - operand - 2
+	if jump > maxOperand {
+		c.fail(c.position, "'%s' is too large to compile", c.function.Name)
+	}
+	c.chunk.Code[operand] = byte(jump >> 8)
+	c.chunk.Code[operand+1] = byte(jump)
+}
+
+func (c *compiler) constant(v *Variable) int {
+	key := constantKey{v.Type, v.Value}
+	if index, ok := c.constants[key]; ok {
+		return index
+	}
+	c.chunk.Constants = append(c.chunk.Constants, constantValue(v))
+	c.constants[key] = len(c.chunk.Constants) - 1
+	return len(c.chunk.Constants) - 1
+}
+
+func (c *compiler) name(name string) int {
+	if index, ok := c.names[name]; ok {
+		return index
+	}
+	c.chunk.Names = append(c.chunk.Names, name)
+	c.names[name] = len(c.chunk.Names) - 1
+	return len(c.chunk.Names) - 1
+}
+
+func (c *compiler) beginScope() {
+	c.scopes = append(c.scopes, make(map[string]*local))
+	c.starts = append(c.starts, c.nextSlot)
+}
+
+func (c *compiler) endScope() {
+	c.nextSlot = c.starts[len(c.starts)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.starts = c.starts[:len(c.starts)-1]
+}
+
+func (c *compiler) resolve(name string) *local {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if l, ok := c.scopes[i][name]; ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// declareLocal gives name a slot in the innermost scope, or returns nil
+// when the variable has to stay in memory.
+func (c *compiler) declareLocal(name string, variableType VariableType) *local {
+	if !c.slots || c.captured[name] {
+		return nil
+	}
+
+	scope := c.scopes[len(c.scopes)-1]
+	if l, ok := scope[name]; ok {
+		l.Type = variableType
+		return l
+	}
+
+	l := &local{slot: c.nextSlot, Type: variableType}
+	scope[name] = l
+	c.nextSlot++
+	if c.nextSlot > c.function.Slots {
+		c.function.Slots = c.nextSlot
+	}
+	return l
+}
+
+func (c *compiler) compileStatements(statements []Statement) {
+	for _, statement := range statements {
+		c.compileStatement(statement)
+	}
+}
+
+func (c *compiler) compileStatement(statement Statement) {
+	c.position = statement.Position()
+
+	switch node := statement.(type) {
+	case *CallStatementNode:
+		action := c.validateCall(node)
+		c.compileCall(node.Call, statementResult, action)
+		if node.Body != nil {
+			c.position = node.Pos
+			jump := c.emit(OpTestResult, maxOperand)
+			c.emit(OpEnterScope)
+			c.beginScope()
+			c.compileStatements(node.Body.Statements)
+			c.endScope()
+			c.emit(OpExitScope)
+			c.patchJump(jump)
+		}
+	case *AssignmentNode:
+		c.compileExpression(node.Value)
+		c.position = node.Pos
+		if l := c.resolve(node.Name); l != nil {
+			c.emit(OpSetLocal, l.slot, c.name(node.Name), int(l.Type))
+		} else {
+			c.emit(OpSetName, c.name(node.Name))
+		}
+	case *DeclarationNode:
+		variableType := node.Type
+		if node.TypeName == "" {
+			variableType = AnyType
+		}
+		if l := c.declareLocal(node.Name, variableType); l != nil {
+			c.emit(OpDeclareLocal, l.slot)
+			c.compileExpression(node.Value)
+			c.position = node.Pos
+			c.emit(OpDefineLocal, l.slot, c.name(node.Name), int(node.Type))
+		} else {
+			typed := 0
+			if node.TypeName != "" {
+				typed = 1
+			}
+			c.emit(OpDeclareName, c.name(node.Name), typed, int(node.Type))
+			c.compileExpression(node.Value)
+			c.position = node.Pos
+			c.emit(OpDefineName, c.name(node.Name), int(node.Type))
+		}
+	case *AugmentedAssignmentNode:
+		l := c.resolve(node.Name)
+		if l != nil {
+			c.emit(OpGetLocal, l.slot, c.name(node.Name))
+		} else {
+			c.emit(OpGetVariable, c.name(node.Name))
+		}
+		c.compileExpression(node.Value)
+		c.position = node.Pos
+		if l != nil {
+			c.emit(OpAugmentLocal, c.name(node.Name), c.name(node.Operator), int(l.Type))
+		} else {
+			c.emit(OpAugmentName, c.name(node.Name), c.name(node.Operator))
+		}
+	case *ImportNode:
+		c.compileExpression(node.Path)
+		c.position = node.Pos
+		c.emit(OpImport, c.name(node.Alias))
+	case *ActionDeclarationNode:
+		declaration := NewAction(nil, ActionDeclarationValidator)
+		if node.Body != nil {
+			declaration.Block = &Block{}
+		}
+		if err := declaration.Validate(c.script); err != nil {
+			c.fail(node.Pos, "%v", err)
+			return
+		}
+		function := c.compileFunction(node.Name, node.Parameters, node.Body)
+		c.position = node.Pos
+		c.emit(OpDefineAction, function, c.name(node.Name))
+	default:
+		c.fail(statement.Position(), "unknown statement node: %T", statement)
+	}
+
+	c.emit(OpEndStatement)
+}
+
+// validateCall runs the validator of an action known when the script is
+// compiled and returns the action, the statement is then bound to it.
+func (c *compiler) validateCall(node *CallStatementNode) *Action {
+	if node.Call.Name == "" {
+		return nil
+	}
+	found := c.script.MainBlock.Memory.GetAction(node.Call.Name)
+	if found == nil {
+		return nil
+	}
+
+	action := CloneAction(found)
+	if node.Body != nil {
+		action.Block = &Block{}
+	}
+	if err := action.Validate(c.script); err != nil {
+		c.fail(node.Pos, "%v", err)
+	}
+	return found
+}
+
+func (c *compiler) compileCall(node *CallNode, mode callMode, action *Action) {
+	site := &callSite{name: node.Name, arguments: len(node.Arguments), slot: -1, action: action, mode: mode}
+
+	for i, argument := range node.Arguments {
+		if call, ok := argument.Value.(*CallNode); ok {
+			c.compileCall(call, argumentResult, nil)
+		} else {
+			c.compileExpression(argument.Value)
+		}
+		if argument.Name != "" {
+			if site.names == nil {
+				site.names = make([]string, len(node.Arguments))
+			}
+			site.names[i] = argument.Name
+		}
+	}
+
+	switch {
+	case action != nil:
+	case node.Name == "":
+		c.compileExpression(node.Callee)
+		site.callee = true
+	default:
+		head := node.Name
+		if strings.ContainsRune(node.Name, DecimalSymbol) {
+			site.path = strings.Split(node.Name, string(DecimalSymbol))
+			head = site.path[0]
+		}
+		if l := c.resolve(head); l != nil {
+			site.slot = l.slot
+		}
+	}
+
+	c.position = node.Pos
+	c.chunk.sites = append(c.chunk.sites, site)
+	c.emit(OpCall, len(c.chunk.sites)-1)
+}
+
+func (c *compiler) compileExpression(expr Expression) {
+	switch node := expr.(type) {
+	case *LiteralNode:
+		c.position = node.Pos
+		c.emit(OpConstant, c.constant(node.Value))
+	case *IdentifierNode:
+		c.position = node.Pos
+		if l := c.resolve(node.Name); l != nil {
+			c.emit(OpGetLocal, l.slot, c.name(node.Name))
+		} else {
+			c.emit(OpGetName, c.name(node.Name))
+		}
+	case *CallNode:
+		c.compileCall(node, expressionResult, nil)
+	case *LambdaNode:
+		function := c.compileFunction(LambdaString, node.Parameters, node.Body)
+		c.position = node.Pos
+		c.emit(OpClosure, function)
+	case *IndexNode:
+		c.compileExpression(node.Target)
+		c.compileExpression(node.Index)
+		c.position = node.Pos
+		c.emit(OpIndex)
+	case *FieldNode:
+		c.compileExpression(node.Target)
+		c.position = node.Pos
+		c.emit(OpField, c.name(node.Name))
+	case *UnaryNode:
+		c.compileExpression(node.Operand)
+		c.position = node.Pos
+		c.emit(OpUnary, int(node.Operator))
+	case *BinaryNode:
+		c.compileExpression(node.Left)
+		c.compileExpression(node.Right)
+		c.position = node.Pos
+		c.emit(OpBinary, int(node.Operator))
+	default:
+		c.fail(c.position, "unknown expression node: %T", expr)
+	}
+}
+
+// compileFunction compiles an action or lambda body into a nested
+// function of the chunk. Its prologue binds the arguments the same way
+// newUserAction does, without source positions so that binding errors
+// are reported at the call site.
+func (c *compiler) compileFunction(name string, parameters []*ParameterNode, body *BlockNode) int {
+	function := &Function{Name: name, Signature: NewSignature(AnyType)}
+	fc := newCompiler(c.script, function)
+	fc.slots = usesSlots(parameters, body)
+	fc.captured = capturedNames(parameters, body)
+	fc.beginScope()
+
+	fixed := 0
+	for _, node := range parameters {
+		parameter := NewParameter(node.Name, node.Type)
+		parameter.Variadic = node.Variadic
+		parameter.Optional = node.Default != nil
+		function.Signature.Parameters = append(function.Signature.Parameters, parameter)
+	}
+
+	for i, parameter := range function.Signature.Parameters {
+		if parameter.Variadic {
+			continue
+		}
+
+		jump := fc.emit(OpParameter, fixed, maxOperand)
+		if node := parameters[i]; node.Default != nil {
+			fc.compileExpression(node.Default)
+			fc.position = Position{}
+		} else {
+			fc.emit(OpMissingArgument, i)
+		}
+		fc.patchJump(jump)
+		fc.bindParameter(i, parameter.Type)
+		fixed++
+	}
+	for i, parameter := range function.Signature.Parameters {
+		if parameter.Variadic {
+			fc.emit(OpVariadic, i)
+			fc.bindParameter(i, AnyType)
+		}
+	}
+
+	fc.compileStatements(body.Statements)
+	fc.emit(OpReturn)
+
+	if fc.err != nil && c.err == nil {
+		c.err = fc.err
+	}
+	c.chunk.Functions = append(c.chunk.Functions, function)
+	return len(c.chunk.Functions) - 1
+}
+
+func (c *compiler) bindParameter(index int, variableType VariableType) {
+	if l := c.declareLocal(c.function.Signature.Parameters[index].Name, variableType); l != nil {
+		c.emit(OpBindLocal, index, l.slot)
+	} else {
+		c.emit(OpBindName, index)
+	}
+}
+
+// usesSlots reports whether the locals of a body can live in slots. Imports
+// bind names only known when they run and delete looks variables up in
+// memory, so bodies using either keep every variable in memory.
+func usesSlots(parameters []*ParameterNode, body *BlockNode) bool {
+	slots := true
+	visit := func(n Node) bool {
+		switch node := n.(type) {
+		case *LambdaNode, *ActionDeclarationNode:
+			return false
+		case *ImportNode:
+			slots = false
+		case *CallNode:
+			if node.Name == DeleteString {
+				slots = false
+			}
+		}
+		return slots
+	}
+
+	for _, parameter := range parameters {
+		Walk(parameter, visit)
+	}
+	Walk(body, visit)
+	return slots
+}
+
+// capturedNames collects every name used inside the lambdas and actions
+// nested in a body, the body keeps variables with these names in memory.
+func capturedNames(parameters []*ParameterNode, body *BlockNode) map[string]bool {
+	captured := make(map[string]bool)
+	collect := func(n Node) bool {
+		switch node := n.(type) {
+		case *IdentifierNode:
+			captured[node.Name] = true
+		case *AssignmentNode:
+			captured[node.Name] = true
+		case *DeclarationNode:
+			captured[node.Name] = true
+		case *AugmentedAssignmentNode:
+			captured[node.Name] = true
+		case *CallNode:
+			if node.Name != "" {
+				captured[strings.Split(node.Name, string(DecimalSymbol))[0]] = true
+			}
+		}
+		return true
+	}
+	visit := func(n Node) bool {
+		switch n.(type) {
+		case *LambdaNode, *ActionDeclarationNode:
+			Walk(n, collect)
+			return false
+		}
+		return true
+	}
+
+	for _, parameter := range parameters {
+		Walk(parameter, visit)
+	}
+	Walk(body, visit)
+	return captured
+}
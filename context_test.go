@@ -0,0 +1,57 @@
+// context_test.go
+package taskwrappr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunContext(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		s, _ := NewScriptFromSource("wait.tw", "wait(10000)\n", GetBuiltIn())
+		s.Engine = engine
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := s.RunContext(ctx)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("wait did not return promptly, took %s", elapsed)
+		}
+		if !errors.Is(err, ErrDeadlineExceeded) || !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCanceled) {
+			t.Errorf("expected a deadline error, got %v", err)
+		}
+		var sourceErr *SourceError
+		if !errors.As(err, &sourceErr) || sourceErr.Pos.Line != 1 {
+			t.Errorf("expected the error to point at the wait, got %v", err)
+		}
+	})
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		memory.Actions["stop"] = NewAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+			cancel()
+			return nil, nil
+		}, nil)
+
+		source := "check := action() {\n\tstop()\n\tresult = 1\n}\ncheck()\nresult = 2\n"
+		s, _ := NewScriptFromSource("cancel.tw", source, memory)
+		s.Engine = engine
+
+		err := s.RunContext(ctx)
+		if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancellation error, got %v", err)
+		}
+		if result := memory.Variables["result"]; result.Type != NilType {
+			t.Errorf("expected the script to stop after stop(), result is %v", result.Value)
+		}
+	})
+}
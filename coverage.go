@@ -0,0 +1,398 @@
+// coverage.go
+package taskwrappr
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Coverage records which statements of the scripts it is attached to ran
+// and which way their code blocks went. Scripts being covered run on the
+// tree engine and are not optimized, so every statement in the source is
+// there to be counted. A Coverage can be shared by several scripts and
+// runs, their counts add up.
+type Coverage struct {
+	mutex sync.Mutex
+	files map[string]*FileCoverage
+}
+
+// FileCoverage holds the counts of one source file. Lines maps every line
+// a statement starts on to the number of times such statements ran.
+// Branches lists, per line, the statements with a code block in source
+// order.
+type FileCoverage struct {
+	Path     string
+	Source   string
+	Lines    map[int]int
+	Branches map[int][]*Branch
+}
+
+// Branch counts how often the code block of a statement ran and how often
+// it was skipped.
+type Branch struct {
+	Column  int
+	Taken   int
+	Skipped int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{files: make(map[string]*FileCoverage)}
+}
+
+// Files returns the coverage of every file seen, sorted by path.
+func (c *Coverage) Files() []*FileCoverage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	files := make([]*FileCoverage, 0, len(c.files))
+	for _, file := range c.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+func (c *Coverage) file(path string) *FileCoverage {
+	file := c.files[path]
+	if file == nil {
+		file = &FileCoverage{Path: path, Lines: make(map[int]int), Branches: make(map[int][]*Branch)}
+		c.files[path] = file
+	}
+	return file
+}
+
+// register adds the statements of a program with no runs yet, so the ones
+// that never run show up.
+func (c *Coverage) register(path, source string, program *BlockNode) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	file := c.file(path)
+	file.Source = source
+	columns := make(map[int][]int)
+	walkStatements(program, func(statement Statement) {
+		pos := statement.Position()
+		file.Lines[pos.Line] += 0
+		if call, ok := statement.(*CallStatementNode); ok && call.Body != nil {
+			columns[pos.Line] = append(columns[pos.Line], pos.Column)
+		}
+	})
+
+	for line, columns := range columns {
+		sort.Ints(columns)
+		// Branches read from a tracefile only know their order on the line.
+		for i, branch := range file.Branches[line] {
+			if branch.Column == 0 && i < len(columns) {
+				branch.Column = columns[i]
+			}
+		}
+		for _, column := range columns {
+			file.branch(Position{File: path, Line: line, Column: column})
+		}
+	}
+}
+
+func (c *Coverage) statement(pos Position) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.file(pos.File).Lines[pos.Line]++
+}
+
+func (c *Coverage) branch(pos Position, taken bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	branch := c.file(pos.File).branch(pos)
+	if taken {
+		branch.Taken++
+	} else {
+		branch.Skipped++
+	}
+}
+
+func (f *FileCoverage) branch(pos Position) *Branch {
+	branches := f.Branches[pos.Line]
+	for _, branch := range branches {
+		if branch.Column == pos.Column {
+			return branch
+		}
+	}
+	branch := &Branch{Column: pos.Column}
+	branches = append(branches, branch)
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Column < branches[j].Column })
+	f.Branches[pos.Line] = branches
+	return branch
+}
+
+// Summary counts the lines with statements and the branches, two per code
+// block, and how many of them were hit.
+func (f *FileCoverage) Summary() (lines, linesHit, branches, branchesHit int) {
+	for _, hits := range f.Lines {
+		lines++
+		if hits > 0 {
+			linesHit++
+		}
+	}
+	for _, points := range f.Branches {
+		for _, branch := range points {
+			branches += 2
+			if branch.Taken > 0 {
+				branchesHit++
+			}
+			if branch.Skipped > 0 {
+				branchesHit++
+			}
+		}
+	}
+	return lines, linesHit, branches, branchesHit
+}
+
+func (f *FileCoverage) sortedLines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for line := range f.Lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for _, file := range c.Files() {
+		c.mutex.Lock()
+		lines, linesHit, branches, branchesHit := file.Summary()
+		fmt.Fprintf(writer, "TN:\nSF:%s\n", file.Path)
+		for _, line := range file.sortedLines() {
+			for block, branch := range file.Branches[line] {
+				for i, count := range []int{branch.Taken, branch.Skipped} {
+					taken := "-"
+					if branch.Taken+branch.Skipped > 0 {
+						taken = strconv.Itoa(count)
+					}
+					fmt.Fprintf(writer, "BRDA:%d,%d,%d,%s\n", line, block, i, taken)
+				}
+			}
+		}
+		fmt.Fprintf(writer, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+		for _, line := range file.sortedLines() {
+			fmt.Fprintf(writer, "DA:%d,%d\n", line, file.Lines[line])
+		}
+		fmt.Fprintf(writer, "LF:%d\nLH:%d\nend_of_record\n", lines, linesHit)
+		c.mutex.Unlock()
+	}
+	return writer.Flush()
+}
+
+// ReadLCOV adds the counts of an LCOV tracefile, as written by WriteLCOV,
+// to the coverage.
+func (c *Coverage) ReadLCOV(r io.Reader) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var file *FileCoverage
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		record, data, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		fields := strings.Split(data, ",")
+		switch record {
+		case "SF":
+			file = c.file(data)
+			continue
+		case "end_of_record":
+			file = nil
+			continue
+		case "DA", "BRDA":
+		default:
+			continue
+		}
+
+		if file == nil {
+			return fmt.Errorf("line %d: %s record outside of a file", number, record)
+		}
+		values := make([]int, len(fields))
+		for i, field := range fields {
+			if field == "-" {
+				continue
+			}
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid %s record: %s", number, record, data)
+			}
+			values[i] = value
+		}
+
+		if record == "DA" && len(values) >= 2 {
+			file.Lines[values[0]] += values[1]
+		} else if record == "BRDA" && len(values) == 4 {
+			line, block := values[0], values[1]
+			for len(file.Branches[line]) <= block {
+				file.Branches[line] = append(file.Branches[line], &Branch{})
+			}
+			if branch := file.Branches[line][block]; values[2] == 0 {
+				branch.Taken += values[3]
+			} else {
+				branch.Skipped += values[3]
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// source returns the file's source, reading it from disk when the file
+// was only known from a tracefile.
+func (f *FileCoverage) source() string {
+	if f.Source == "" {
+		if content, err := os.ReadFile(f.Path); err == nil {
+			f.Source = string(content)
+		}
+	}
+	return f.Source
+}
+
+// walkStatements calls visit for every statement of block, including the
+// ones in code blocks and in the bodies of actions and lambdas.
+func walkStatements(block *BlockNode, visit func(Statement)) {
+	if block == nil {
+		return
+	}
+	for _, statement := range block.Statements {
+		visit(statement)
+		switch node := statement.(type) {
+		case *CallStatementNode:
+			walkLambdas(node.Call, visit)
+			walkStatements(node.Body, visit)
+		case *ActionDeclarationNode:
+			walkStatements(node.Body, visit)
+		case *DeclarationNode:
+			walkLambdas(node.Value, visit)
+		case *AssignmentNode:
+			walkLambdas(node.Value, visit)
+		case *AugmentedAssignmentNode:
+			walkLambdas(node.Value, visit)
+		}
+	}
+}
+
+func walkLambdas(expr Expression, visit func(Statement)) {
+	switch node := expr.(type) {
+	case *LambdaNode:
+		walkStatements(node.Body, visit)
+		walkLambdas(node.Result, visit)
+	case *CallNode:
+		walkLambdas(node.Callee, visit)
+		for _, argument := range node.Arguments {
+			walkLambdas(argument.Value, visit)
+		}
+	case *UnaryNode:
+		walkLambdas(node.Operand, visit)
+	case *BinaryNode:
+		walkLambdas(node.Left, visit)
+		walkLambdas(node.Right, visit)
+	case *IndexNode:
+		walkLambdas(node.Target, visit)
+		walkLambdas(node.Index, visit)
+	case *FieldNode:
+		walkLambdas(node.Target, visit)
+	}
+}
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.source { border-collapse: collapse; font-family: monospace; white-space: pre; }
+table.source td { padding: 0 0.5em; }
+td.number, td.hits { color: #888; text-align: right; }
+tr.covered td.code { background: #dfd; }
+tr.uncovered td.code { background: #fdd; }
+tr.partial td.code { background: #ffd; }
+td.branches { color: #a60; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<table>
+<tr><th>File</th><th>Lines</th><th>Branches</th></tr>
+{{range .}}<tr><td><a href="#{{.Anchor}}">{{.Path}}</a></td><td>{{.Lines}}</td><td>{{.Branches}}</td></tr>
+{{end}}</table>
+{{range .}}<h2 id="{{.Anchor}}">{{.Path}}</h2>
+<table class="source">
+{{range .Source}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="hits">{{.Hits}}</td><td class="code">{{.Code}}</td><td class="branches">{{.Branches}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+type coverageReportFile struct {
+	Anchor   string
+	Path     string
+	Lines    string
+	Branches string
+	Source   []coverageReportLine
+}
+
+type coverageReportLine struct {
+	Number   int
+	Hits     string
+	Code     string
+	Class    string
+	Branches string
+}
+
+// WriteHTML writes a report annotating the source of every file with how
+// often each line ran and which way its code blocks went.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	var report []coverageReportFile
+	for i, file := range c.Files() {
+		c.mutex.Lock()
+		lines, linesHit, branches, branchesHit := file.Summary()
+		reportFile := coverageReportFile{
+			Anchor:   fmt.Sprintf("file%d", i),
+			Path:     file.Path,
+			Lines:    coveragePercent(linesHit, lines),
+			Branches: coveragePercent(branchesHit, branches),
+		}
+
+		for number, code := range strings.Split(file.source(), string(NewLineSymbol)) {
+			line := coverageReportLine{Number: number + 1, Code: strings.TrimRight(code, string(ReturnSymbol))}
+			if hits, ok := file.Lines[line.Number]; ok {
+				line.Hits = strconv.Itoa(hits)
+				line.Class = "uncovered"
+				if hits > 0 {
+					line.Class = "covered"
+				}
+			}
+
+			var outcomes []string
+			for _, branch := range file.Branches[line.Number] {
+				outcomes = append(outcomes, fmt.Sprintf("ran %d, skipped %d", branch.Taken, branch.Skipped))
+				if line.Class == "covered" && (branch.Taken == 0 || branch.Skipped == 0) {
+					line.Class = "partial"
+				}
+			}
+			line.Branches = strings.Join(outcomes, "; ")
+			reportFile.Source = append(reportFile.Source, line)
+		}
+		c.mutex.Unlock()
+		report = append(report, reportFile)
+	}
+	return coverageTemplate.Execute(w, report)
+}
+
+func coveragePercent(hit, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", float64(hit)*100/float64(total), hit, total)
+}
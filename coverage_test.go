@@ -0,0 +1,83 @@
+// coverage_test.go
+package taskwrappr
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const coveredSource = `check := action(n) {
+	if(n > 10) {
+		print("big")
+	}
+	elseIf(n > 5) {
+		print("medium")
+	}
+	else() {
+		print("small")
+	}
+}
+check(7)
+check(1)
+`
+
+func TestCoverage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "covered.tw")
+	if err := os.WriteFile(path, []byte(coveredSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	coverage := NewCoverage()
+	for i := 0; i < 2; i++ {
+		s, err := NewScript(path, GetBuiltIn())
+		if err != nil {
+			t.Fatalf("NewScript returned an error: %s", err)
+		}
+		s.Engine = BytecodeEngine
+		s.Coverage = coverage
+		s.Stdout = io.Discard
+		if err := s.Run(); err != nil {
+			t.Errorf("Run returned an error: %s", err)
+		}
+	}
+
+	var lcov strings.Builder
+	if err := coverage.WriteLCOV(&lcov); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{
+		"SF:" + path,
+		"BRDA:2,0,0,0\nBRDA:2,0,1,4\n",
+		"BRDA:5,0,0,2\nBRDA:5,0,1,2\n",
+		"DA:3,0\n", "DA:6,2\n", "DA:9,2\n", "DA:12,2\n",
+		"BRF:6\nBRH:5\n", "LF:9\nLH:8\n",
+	} {
+		if !strings.Contains(lcov.String(), record) {
+			t.Errorf("expected %q in the tracefile:\n%s", record, lcov.String())
+		}
+	}
+
+	merged := NewCoverage()
+	if err := merged.ReadLCOV(strings.NewReader(lcov.String())); err != nil {
+		t.Fatalf("ReadLCOV returned an error: %s", err)
+	}
+	if err := merged.ReadLCOV(strings.NewReader(lcov.String())); err != nil {
+		t.Fatalf("ReadLCOV returned an error: %s", err)
+	}
+	file := merged.Files()[0]
+	if file.Lines[12] != 4 || file.Branches[2][0].Skipped != 8 {
+		t.Errorf("expected the tracefiles to add up, got lines %v", file.Lines)
+	}
+
+	var report strings.Builder
+	if err := coverage.WriteHTML(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), `<tr class="partial"><td class="number">2</td>`) ||
+		!strings.Contains(report.String(), `<tr class="uncovered"><td class="number">3</td>`) {
+		t.Errorf("expected the report to mark the branch never taken, got:\n%s", report.String())
+	}
+}
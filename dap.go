@@ -0,0 +1,414 @@
+// dap.go
+package taskwrappr
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const dapThreadID = 1
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type debugAdapter struct {
+	memory   *MemoryMap
+	in       *bufio.Reader
+	out      io.Writer
+	debugger *Debugger
+
+	writing sync.Mutex
+	seq     int
+
+	state      sync.Mutex
+	stop       *Stop
+	references []interface{}
+	resume     chan StepAction
+	closing    chan struct{}
+
+	program    string
+	launched   bool
+	configured bool
+	done       chan struct{}
+}
+
+// ServeDebugAdapter speaks the Debug Adapter Protocol over in and out. The
+// script named by the launch request runs against memory, and whatever it
+// prints is sent to the client as output events.
+func ServeDebugAdapter(in io.Reader, out io.Writer, memory *MemoryMap) error {
+	adapter := &debugAdapter{
+		memory:  memory,
+		in:      bufio.NewReader(in),
+		out:     out,
+		resume:  make(chan StepAction),
+		closing: make(chan struct{}),
+	}
+	adapter.debugger = NewDebugger(adapter.stopped)
+
+	for {
+		body, err := readMessage(adapter.in)
+		if err == io.EOF {
+			adapter.terminate()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		request := &dapRequest{}
+		if err := json.Unmarshal(body, request); err != nil {
+			return err
+		}
+		if request.Command == "disconnect" || request.Command == "terminate" {
+			adapter.terminate()
+			return adapter.respond(request, nil, nil)
+		}
+		if err := adapter.handle(request); err != nil {
+			return err
+		}
+	}
+}
+
+func (da *debugAdapter) write(message interface{}) error {
+	da.writing.Lock()
+	defer da.writing.Unlock()
+
+	da.seq++
+	switch m := message.(type) {
+	case *dapResponse:
+		m.Seq = da.seq
+	case *dapEvent:
+		m.Seq = da.seq
+	}
+	return writeMessage(da.out, message)
+}
+
+func (da *debugAdapter) respond(request *dapRequest, body interface{}, err error) error {
+	response := &dapResponse{Type: "response", RequestSeq: request.Seq, Success: err == nil, Command: request.Command, Body: body}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	return da.write(response)
+}
+
+func (da *debugAdapter) event(event string, body interface{}) error {
+	return da.write(&dapEvent{Type: "event", Event: event, Body: body})
+}
+
+func (da *debugAdapter) handle(request *dapRequest) error {
+	var arguments struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+		Source      struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line      int    `json:"line"`
+			Condition string `json:"condition"`
+		} `json:"breakpoints"`
+		FrameID            int    `json:"frameId"`
+		VariablesReference int    `json:"variablesReference"`
+		Expression         string `json:"expression"`
+	}
+	if len(request.Arguments) > 0 {
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			return da.respond(request, nil, err)
+		}
+	}
+
+	switch request.Command {
+	case "initialize":
+		if err := da.respond(request, map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsTerminateRequest":         true,
+		}, nil); err != nil {
+			return err
+		}
+		return da.event("initialized", nil)
+	case "launch":
+		if arguments.Program == "" {
+			return da.respond(request, nil, errors.New("launch needs a program"))
+		}
+		da.program, da.launched = arguments.Program, true
+		da.debugger.StopOnEntry = arguments.StopOnEntry
+		if err := da.respond(request, nil, nil); err != nil {
+			return err
+		}
+		return da.start()
+	case "configurationDone":
+		da.configured = true
+		if err := da.respond(request, nil, nil); err != nil {
+			return err
+		}
+		return da.start()
+	case "setBreakpoints":
+		path := arguments.Source.Path
+		da.debugger.ClearBreakpoints(path)
+		breakpoints := make([]map[string]interface{}, len(arguments.Breakpoints))
+		for i, requested := range arguments.Breakpoints {
+			breakpoint := da.debugger.SetBreakpoint(path, requested.Line, requested.Condition)
+			breakpoints[i] = map[string]interface{}{"id": breakpoint.ID, "verified": true, "line": breakpoint.Line}
+		}
+		return da.respond(request, map[string]interface{}{"breakpoints": breakpoints}, nil)
+	case "threads":
+		return da.respond(request, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThreadID, "name": "main"}},
+		}, nil)
+	case "stackTrace":
+		var frames []map[string]interface{}
+		for i, frame := range da.frames() {
+			frames = append(frames, map[string]interface{}{
+				"id":     i,
+				"name":   frame.Name,
+				"source": dapSource{Name: filepath.Base(frame.Pos.File), Path: frame.Pos.File},
+				"line":   frame.Pos.Line,
+				"column": frame.Pos.Column,
+			})
+		}
+		return da.respond(request, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil)
+	case "scopes":
+		frame, err := da.frame(arguments.FrameID)
+		if err != nil {
+			return da.respond(request, nil, err)
+		}
+		var scopes []map[string]interface{}
+		for _, scope := range frame.Scopes() {
+			scopes = append(scopes, map[string]interface{}{
+				"name":               scope.Name,
+				"variablesReference": da.reference(scope.Memory),
+				"expensive":          false,
+			})
+		}
+		return da.respond(request, map[string]interface{}{"scopes": scopes}, nil)
+	case "variables":
+		return da.respond(request, map[string]interface{}{"variables": da.variables(arguments.VariablesReference)}, nil)
+	case "evaluate":
+		frame, err := da.frame(arguments.FrameID)
+		if err != nil {
+			return da.respond(request, nil, err)
+		}
+		value, err := frame.Evaluate(arguments.Expression)
+		if err != nil {
+			return da.respond(request, nil, err)
+		}
+		variable := da.variable("", value)
+		return da.respond(request, map[string]interface{}{
+			"result":             variable.Value,
+			"type":               variable.Type,
+			"variablesReference": variable.VariablesReference,
+		}, nil)
+	case "continue", "next", "stepIn", "stepOut":
+		action := map[string]StepAction{"continue": Continue, "next": StepOver, "stepIn": StepInto, "stepOut": StepOut}[request.Command]
+		var body interface{}
+		if action == Continue {
+			body = map[string]bool{"allThreadsContinued": true}
+		}
+		if err := da.respond(request, body, nil); err != nil {
+			return err
+		}
+		da.proceed(action)
+		return nil
+	case "pause":
+		da.debugger.Pause()
+		return da.respond(request, nil, nil)
+	}
+	return da.respond(request, nil, fmt.Errorf("unsupported request: %s", request.Command))
+}
+
+// start runs the program once it is launched and configured. Anything the
+// script prints is forwarded as output events meanwhile.
+func (da *debugAdapter) start() error {
+	if !da.launched || !da.configured || da.done != nil {
+		return nil
+	}
+	da.done = make(chan struct{})
+
+	go func() {
+		defer close(da.done)
+
+		exitCode := 0
+		s, err := NewScript(da.program, da.memory)
+		if err == nil {
+			s.Debugger = da.debugger
+			s.Stdout = &dapOutput{adapter: da, category: "stdout"}
+			s.Stderr = &dapOutput{adapter: da, category: "stderr"}
+			s.Stdin = strings.NewReader("")
+			err = s.Run()
+		}
+
+		if err != nil && !errors.Is(err, ErrDebugAborted) {
+			exitCode = 1
+			da.event("output", map[string]string{"category": "stderr", "output": err.Error() + string(NewLineSymbol)})
+		}
+		da.event("exited", map[string]int{"exitCode": exitCode})
+		da.event("terminated", nil)
+	}()
+	return nil
+}
+
+// dapOutput forwards what a script writes to one of its streams as output
+// events.
+type dapOutput struct {
+	adapter  *debugAdapter
+	category string
+}
+
+func (o *dapOutput) Write(p []byte) (int, error) {
+	if err := o.adapter.event("output", map[string]string{"category": o.category, "output": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stopped runs on the script's goroutine and waits for the client to say
+// how to go on.
+func (da *debugAdapter) stopped(stop *Stop) StepAction {
+	da.state.Lock()
+	da.stop, da.references = stop, nil
+	da.state.Unlock()
+
+	body := map[string]interface{}{"reason": stop.Reason, "threadId": dapThreadID, "allThreadsStopped": true}
+	if stop.Breakpoint != nil {
+		body["hitBreakpointIds"] = []int{stop.Breakpoint.ID}
+	}
+	da.event("stopped", body)
+
+	select {
+	case action := <-da.resume:
+		return action
+	case <-da.closing:
+		return Abort
+	}
+}
+
+func (da *debugAdapter) proceed(action StepAction) {
+	da.state.Lock()
+	stopped := da.stop != nil
+	da.stop, da.references = nil, nil
+	da.state.Unlock()
+
+	if stopped {
+		select {
+		case da.resume <- action:
+		case <-da.closing:
+		}
+	}
+}
+
+// terminate aborts a running script and waits for it to end.
+func (da *debugAdapter) terminate() {
+	if da.done == nil {
+		return
+	}
+	da.debugger.Abort()
+	close(da.closing)
+	<-da.done
+}
+
+func (da *debugAdapter) frames() []*Frame {
+	da.state.Lock()
+	defer da.state.Unlock()
+	if da.stop == nil {
+		return nil
+	}
+	return da.stop.Frames
+}
+
+func (da *debugAdapter) frame(id int) (*Frame, error) {
+	frames := da.frames()
+	if id < 0 || id >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", id)
+	}
+	return frames[id], nil
+}
+
+// reference hands out a variablesReference for a scope or a collection,
+// valid until the script resumes.
+func (da *debugAdapter) reference(target interface{}) int {
+	da.state.Lock()
+	defer da.state.Unlock()
+	da.references = append(da.references, target)
+	return len(da.references)
+}
+
+func (da *debugAdapter) variables(reference int) []dapVariable {
+	da.state.Lock()
+	var target interface{}
+	if reference > 0 && reference <= len(da.references) {
+		target = da.references[reference-1]
+	}
+	da.state.Unlock()
+
+	variables := []dapVariable{}
+	switch target := target.(type) {
+	case *MemoryMap:
+		names := mapKeys(target.Variables)
+		sort.Strings(names)
+		for _, name := range names {
+			variables = append(variables, da.variable(name, target.Variables[name]))
+		}
+	case *Variable:
+		switch target.Type {
+		case ArrayType:
+			for i, element := range target.Value.([]*Variable) {
+				variables = append(variables, da.variable(fmt.Sprintf("[%d]", i), element))
+			}
+		case MapType:
+			entries := target.Value.(map[string]*Variable)
+			keys := mapKeys(entries)
+			sort.Strings(keys)
+			for _, key := range keys {
+				variables = append(variables, da.variable(key, entries[key]))
+			}
+		}
+	}
+	return variables
+}
+
+func (da *debugAdapter) variable(name string, value *Variable) dapVariable {
+	variable := dapVariable{Name: name, Value: formatValue(value), Type: value.Type.String()}
+	if value.Type == ArrayType || value.Type == MapType {
+		variable.VariablesReference = da.reference(value)
+	}
+	return variable
+}
@@ -0,0 +1,347 @@
+// debugger.go
+package taskwrappr
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+type StepAction int
+
+const (
+	Continue StepAction = iota
+	StepOver
+	StepInto
+	StepOut
+	Abort
+)
+
+const (
+	StopEntry      = "entry"
+	StopBreakpoint = "breakpoint"
+	StopStep       = "step"
+	StopPause      = "pause"
+)
+
+const conditionPath = "<condition>"
+
+var ErrDebugAborted = errors.New("debugging aborted")
+
+// Breakpoint stops a script before any statement starting on Line of File.
+// A breakpoint with a Condition only stops when the condition evaluates to
+// true in the scope of the statement.
+type Breakpoint struct {
+	ID        int
+	File      string
+	Line      int
+	Condition string
+	Hits      int
+}
+
+// Frame is an action being run, or the main script at the bottom of the
+// stack. Pos is the statement the frame is at and Memory its innermost
+// scope there.
+type Frame struct {
+	Name   string
+	Pos    Position
+	Memory *MemoryMap
+	script *Script
+}
+
+type DebugScope struct {
+	Name   string
+	Memory *MemoryMap
+}
+
+// Stop describes where a script paused. Frames are ordered from the
+// innermost one out.
+type Stop struct {
+	Reason     string
+	Breakpoint *Breakpoint
+	Frames     []*Frame
+}
+
+// Debugger pauses a script at breakpoints and steps and hands control to
+// OnStop, which decides how to go on. Scripts being debugged always run on
+// the tree engine and are not optimized, so every statement can be stopped
+// at and every scope is a MemoryMap.
+type Debugger struct {
+	OnStop      func(stop *Stop) StepAction
+	StopOnEntry bool
+
+	mutex       sync.Mutex
+	breakpoints []*Breakpoint
+	nextID      int
+	files       map[string]string
+	frames      []*Frame
+	step        StepAction
+	stepDepth   int
+	started     bool
+	pausing     bool
+	aborted     bool
+	evaluating  bool
+}
+
+func NewDebugger(onStop func(stop *Stop) StepAction) *Debugger {
+	return &Debugger{
+		OnStop: onStop,
+		files:  make(map[string]string),
+	}
+}
+
+func (d *Debugger) SetBreakpoint(file string, line int, condition string) *Breakpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.nextID++
+	breakpoint := &Breakpoint{ID: d.nextID, File: d.normalize(file), Line: line, Condition: condition}
+	d.breakpoints = append(d.breakpoints, breakpoint)
+	return breakpoint
+}
+
+func (d *Debugger) ClearBreakpoint(id int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for i, breakpoint := range d.breakpoints {
+		if breakpoint.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints removes the breakpoints of a file, or all of them when
+// file is empty.
+func (d *Debugger) ClearBreakpoints(file string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	file = d.normalize(file)
+	kept := d.breakpoints[:0]
+	for _, breakpoint := range d.breakpoints {
+		if file != "" && breakpoint.File != file {
+			kept = append(kept, breakpoint)
+		}
+	}
+	d.breakpoints = kept
+}
+
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]*Breakpoint(nil), d.breakpoints...)
+}
+
+// Pause stops the script before its next statement. It may be called
+// from another goroutine while the script runs.
+func (d *Debugger) Pause() {
+	d.mutex.Lock()
+	d.pausing = true
+	d.mutex.Unlock()
+}
+
+// Abort makes the running script fail with ErrDebugAborted before its
+// next statement.
+func (d *Debugger) Abort() {
+	d.mutex.Lock()
+	d.aborted = true
+	d.mutex.Unlock()
+}
+
+func (d *Debugger) reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.frames, d.step, d.started, d.pausing, d.aborted = nil, Continue, false, false, false
+}
+
+func (d *Debugger) normalize(file string) string {
+	if file == "" {
+		return ""
+	}
+	if normalized, ok := d.files[file]; ok {
+		return normalized
+	}
+	normalized := filepath.Clean(file)
+	if absolute, err := filepath.Abs(file); err == nil {
+		normalized = absolute
+	}
+	d.files[file] = normalized
+	return normalized
+}
+
+func (d *Debugger) enter(name string) {
+	if name == "" {
+		name = LambdaString
+	}
+	d.mutex.Lock()
+	d.frames = append(d.frames, &Frame{Name: name})
+	d.mutex.Unlock()
+}
+
+func (d *Debugger) leave() {
+	d.mutex.Lock()
+	d.frames = d.frames[:len(d.frames)-1]
+	d.mutex.Unlock()
+}
+
+// statement is called before every statement the tree engine runs and
+// blocks in OnStop when the script has to stop there.
+func (d *Debugger) statement(s *Script, statement Statement) error {
+	d.mutex.Lock()
+	if d.evaluating {
+		d.mutex.Unlock()
+		return nil
+	}
+	if d.aborted {
+		d.mutex.Unlock()
+		return ErrDebugAborted
+	}
+
+	if len(d.frames) == 0 {
+		d.frames = append(d.frames, &Frame{Name: "main"})
+	}
+	frame := d.frames[len(d.frames)-1]
+	pos := statement.Position()
+	sameLine := frame.Pos.File == pos.File && frame.Pos.Line == pos.Line
+	frame.Pos, frame.Memory, frame.script = pos, s.CurrentBlock.Memory, s
+
+	reason := ""
+	depth := len(d.frames)
+	switch {
+	case !d.started && d.StopOnEntry:
+		reason = StopEntry
+	case d.pausing:
+		reason = StopPause
+	case d.step == StepInto, d.step == StepOver && depth <= d.stepDepth, d.step == StepOut && depth < d.stepDepth:
+		reason = StopStep
+	}
+	d.started = true
+
+	var candidates []*Breakpoint
+	if reason == "" && !sameLine {
+		file := d.normalize(pos.File)
+		for _, breakpoint := range d.breakpoints {
+			if breakpoint.File == file && breakpoint.Line == pos.Line {
+				candidates = append(candidates, breakpoint)
+			}
+		}
+	}
+	d.mutex.Unlock()
+
+	var hit *Breakpoint
+	for _, breakpoint := range candidates {
+		if d.conditionHolds(frame, breakpoint) {
+			hit = breakpoint
+			break
+		}
+	}
+	if hit != nil {
+		reason = StopBreakpoint
+	}
+	if reason == "" {
+		return nil
+	}
+
+	d.mutex.Lock()
+	if hit != nil {
+		hit.Hits++
+	}
+	stop := &Stop{Reason: reason, Breakpoint: hit}
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		copied := *d.frames[i]
+		stop.Frames = append(stop.Frames, &copied)
+	}
+	d.pausing = false
+	d.mutex.Unlock()
+
+	action := Continue
+	if d.OnStop != nil {
+		action = d.OnStop(stop)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if action == Abort {
+		d.aborted = true
+		return ErrDebugAborted
+	}
+	d.step, d.stepDepth = action, depth
+	return nil
+}
+
+// conditionHolds evaluates the condition of a breakpoint. A condition that
+// cannot be evaluated counts as true, so the problem does not go unnoticed.
+func (d *Debugger) conditionHolds(frame *Frame, breakpoint *Breakpoint) bool {
+	if breakpoint.Condition == "" {
+		return true
+	}
+	value, err := frame.Evaluate(breakpoint.Condition)
+	if err != nil {
+		return true
+	}
+	holds, err := value.toBool()
+	return err != nil || holds
+}
+
+// Evaluate evaluates an expression in the innermost scope of the frame.
+// Statements it runs do not stop at breakpoints.
+func (f *Frame) Evaluate(source string) (*Variable, error) {
+	if f.script == nil {
+		return nil, errors.New("frame has no scope yet")
+	}
+	s := f.script
+	expression, err := s.parseExpressionSource(conditionPath, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if d := s.Debugger; d != nil {
+		d.mutex.Lock()
+		d.evaluating = true
+		d.mutex.Unlock()
+		defer func() {
+			d.mutex.Lock()
+			d.evaluating = false
+			d.mutex.Unlock()
+		}()
+	}
+
+	previousBlock, previousReturning, previousValues := s.CurrentBlock, s.returning, s.returnValues
+	s.CurrentBlock = &Block{Memory: f.Memory}
+	defer func() {
+		s.CurrentBlock, s.returning, s.returnValues = previousBlock, previousReturning, previousValues
+	}()
+	return s.evaluate(expression)
+}
+
+// Scopes lists the memory scopes visible from the frame, innermost first:
+// the local scope and the ones enclosing it, the script's own and the
+// host's.
+func (f *Frame) Scopes() []*DebugScope {
+	var scopes []*DebugScope
+	inScript := false
+	for memory := f.Memory; memory != nil; memory = memory.Parent {
+		name := "enclosing"
+		switch {
+		case f.script != nil && memory == f.script.MainBlock.Memory:
+			name, inScript = "script", true
+		case inScript:
+			name = "host"
+		case len(scopes) == 0:
+			name = "local"
+		}
+		scopes = append(scopes, &DebugScope{Name: name, Memory: memory})
+	}
+	return scopes
+}
+
+// Variables returns the names of the scope's variables, sorted.
+func (scope *DebugScope) Variables() []string {
+	names := mapKeys(scope.Memory.Variables)
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,217 @@
+// debugger_test.go
+package taskwrappr
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const debugSource = `total := 0
+add := action(n) {
+	total += n
+	return(total)
+}
+add(1)
+add(2)
+if(total > 2) {
+	add(3)
+}
+print("total", total)
+`
+
+func writeDebugScript(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "debug.tw")
+	if err := os.WriteFile(path, []byte(debugSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDebugger(t *testing.T) {
+	path := writeDebugScript(t)
+
+	actions := []StepAction{Continue, StepOut, StepOver, StepInto, StepInto, Continue}
+	var stops []string
+	debugger := NewDebugger(func(stop *Stop) StepAction {
+		frame := stop.Frames[0]
+		description := fmt.Sprintf("%s %s:%d", stop.Reason, frame.Name, frame.Pos.Line)
+		if value, err := frame.Evaluate("n"); err == nil {
+			description += fmt.Sprintf(" n=%v", value.Value)
+		}
+		stops = append(stops, description)
+
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	})
+	debugger.StopOnEntry = true
+	debugger.SetBreakpoint(path, 3, "n == 2")
+
+	s, err := NewScript(path, GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Engine = BytecodeEngine
+	s.Debugger = debugger
+	var output strings.Builder
+	s.Stdout = &output
+
+	if err := s.Run(); err != nil {
+		t.Errorf("Run returned an error: %s", err)
+	}
+
+	expected := []string{
+		"entry main:1",
+		"breakpoint add:3 n=2",
+		"step main:8",
+		"step main:9",
+		"step add:3 n=3",
+		"step add:4 n=3",
+	}
+	if !reflect.DeepEqual(stops, expected) {
+		t.Errorf("expected stops %v, got %v", expected, stops)
+	}
+	if output.String() != "total 6\n" {
+		t.Errorf("expected the script to finish, got %q", output.String())
+	}
+}
+
+func TestDebuggerScopes(t *testing.T) {
+	path := writeDebugScript(t)
+
+	memory := GetBuiltIn()
+	var scopes []string
+	debugger := NewDebugger(func(stop *Stop) StepAction {
+		for _, scope := range stop.Frames[0].Scopes() {
+			scopes = append(scopes, fmt.Sprintf("%s%v", scope.Name, scope.Variables()))
+		}
+		return Abort
+	})
+	debugger.SetBreakpoint(path, 3, "")
+
+	s, err := NewScript(path, memory)
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Debugger = debugger
+
+	if err := s.Run(); err != ErrDebugAborted {
+		t.Errorf("expected the script to be aborted, got %v", err)
+	}
+	expected := []string{"local[n]", "script[total]", "host[false nil true]"}
+	if !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("expected scopes %v, got %v", expected, scopes)
+	}
+}
+
+func TestDebugAdapter(t *testing.T) {
+	path := writeDebugScript(t)
+
+	in, client := io.Pipe()
+	server, out := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- ServeDebugAdapter(in, out, GetBuiltIn())
+		out.Close()
+	}()
+
+	seq := 0
+	send := func(command string, arguments interface{}) {
+		seq++
+		body, _ := json.Marshal(map[string]interface{}{"seq": seq, "type": "request", "command": command, "arguments": arguments})
+		fmt.Fprintf(client, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	reader := bufio.NewReader(server)
+	var output string
+	receive := func(kind, name string) map[string]interface{} {
+		t.Helper()
+		for {
+			body, err := readMessage(reader)
+			if err != nil {
+				t.Fatalf("waiting for %s %s: %s", kind, name, err)
+			}
+			var message map[string]interface{}
+			json.Unmarshal(body, &message)
+			if message["type"] == "event" && message["event"] == "output" {
+				output += message["body"].(map[string]interface{})["output"].(string)
+				continue
+			}
+			if message["type"] != kind || (message["command"] != name && message["event"] != name) {
+				t.Fatalf("expected %s %s, got %s", kind, name, body)
+			}
+			if kind == "response" && message["success"] != true {
+				t.Fatalf("%s failed: %s", name, body)
+			}
+			result, _ := message["body"].(map[string]interface{})
+			return result
+		}
+	}
+
+	send("initialize", map[string]string{"adapterID": "taskwrappr"})
+	receive("response", "initialize")
+	receive("event", "initialized")
+
+	send("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 3, "condition": "n > 1"}},
+	})
+	receive("response", "setBreakpoints")
+	send("launch", map[string]string{"program": path})
+	receive("response", "launch")
+	send("configurationDone", nil)
+	receive("response", "configurationDone")
+
+	if stopped := receive("event", "stopped"); stopped["reason"] != StopBreakpoint {
+		t.Errorf("expected to stop at the breakpoint, got %v", stopped)
+	}
+
+	send("stackTrace", map[string]int{"threadId": 1})
+	frames := receive("response", "stackTrace")["stackFrames"].([]interface{})
+	if len(frames) != 2 || frames[0].(map[string]interface{})["name"] != "add" || frames[1].(map[string]interface{})["line"] != 7.0 {
+		t.Errorf("expected add called from line 7, got %v", frames)
+	}
+
+	send("scopes", map[string]int{"frameId": 0})
+	scopes := receive("response", "scopes")["scopes"].([]interface{})
+	local := scopes[0].(map[string]interface{})
+	send("variables", map[string]interface{}{"variablesReference": local["variablesReference"]})
+	variables := receive("response", "variables")["variables"].([]interface{})
+	if len(variables) != 1 || variables[0].(map[string]interface{})["value"] != "2" {
+		t.Errorf("expected n = 2 in the local scope, got %v", variables)
+	}
+
+	send("evaluate", map[string]interface{}{"expression": "total + n", "frameId": 0})
+	if result := receive("response", "evaluate")["result"]; result != "3" {
+		t.Errorf("expected total + n to be 3, got %v", result)
+	}
+
+	send("continue", map[string]int{"threadId": 1})
+	receive("response", "continue")
+	if stopped := receive("event", "stopped"); stopped["reason"] != StopBreakpoint {
+		t.Errorf("expected to stop at the breakpoint again, got %v", stopped)
+	}
+	send("continue", map[string]int{"threadId": 1})
+	receive("response", "continue")
+	receive("event", "exited")
+	receive("event", "terminated")
+
+	send("disconnect", nil)
+	receive("response", "disconnect")
+	client.Close()
+	if err := <-done; err != nil {
+		t.Errorf("ServeDebugAdapter returned an error: %s", err)
+	}
+	if !strings.Contains(output, "total 6\n") {
+		t.Errorf("expected the script output as output events, got %q", output)
+	}
+}
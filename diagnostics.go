@@ -0,0 +1,123 @@
+// diagnostics.go
+package taskwrappr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity values match the ones used by the Language Server Protocol.
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+	SeverityInformation
+	SeverityHint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "information"
+	case SeverityHint:
+		return "hint"
+	default:
+		return "invalid"
+	}
+}
+
+type Diagnostic struct {
+	Pos      Position
+	Severity Severity
+	Message  string
+	Snippet  string
+}
+
+func NewDiagnostic(severity Severity, err error) *Diagnostic {
+	var sourceErr *SourceError
+	if errors.As(err, &sourceErr) {
+		return &Diagnostic{
+			Pos:      sourceErr.Pos,
+			Severity: severity,
+			Message:  sourceErr.Message,
+			Snippet:  sourceErr.Snippet,
+		}
+	}
+	return &Diagnostic{Severity: severity, Message: err.Error()}
+}
+
+// Error formats the diagnostic like a SourceError, with the severity
+// spelled out unless it is an error.
+func (d *Diagnostic) Error() string {
+	message := d.Message
+	if d.Severity != SeverityError {
+		message = fmt.Sprintf("%s: %s", d.Severity, message)
+	}
+	return (&SourceError{Pos: d.Pos, Message: message, Snippet: d.Snippet}).Error()
+}
+
+// Diagnostics is every problem found in a source, ordered by position.
+type Diagnostics []*Diagnostic
+
+func (d *Diagnostics) add(severity Severity, err error) {
+	*d = append(*d, NewDiagnostic(severity, err))
+}
+
+func (d Diagnostics) Sort() {
+	sort.SliceStable(d, func(i, j int) bool {
+		a, b := d[i].Pos, d[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// compact drops repeated diagnostics, which recovery can produce when
+// several statements run into the same unclosed token. It expects d to
+// be sorted.
+func (d Diagnostics) compact() Diagnostics {
+	var compacted Diagnostics
+	for i, diagnostic := range d {
+		if i > 0 && diagnostic.Pos == d[i-1].Pos && diagnostic.Message == d[i-1].Message {
+			continue
+		}
+		compacted = append(compacted, diagnostic)
+	}
+	return compacted
+}
+
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the diagnostics as an error when any of them is an error.
+func (d Diagnostics) Err() error {
+	if !d.HasErrors() {
+		return nil
+	}
+	return d
+}
+
+func (d Diagnostics) Error() string {
+	messages := make([]string, len(d))
+	for i, diagnostic := range d {
+		messages[i] = diagnostic.Error()
+	}
+	return strings.Join(messages, string(NewLineSymbol))
+}
@@ -0,0 +1,136 @@
+// errors.go
+package taskwrappr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// ErrCanceled and ErrDeadlineExceeded stop a script run with RunContext
+// once its context is canceled or its deadline passes.
+var (
+	ErrCanceled         = errors.New("script canceled")
+	ErrDeadlineExceeded = errors.New("script deadline exceeded")
+)
+
+type SourceError struct {
+	Pos     Position
+	Message string
+	Snippet string
+	Err     error
+}
+
+func NewSourceError(source string, pos Position, message string) *SourceError {
+	return &SourceError{
+		Pos:     pos,
+		Message: message,
+		Snippet: Snippet(source, pos),
+	}
+}
+
+func (e *SourceError) Error() string {
+	if e.Snippet == "" {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+	}
+	return fmt.Sprintf("%s: %s\n%s", e.Pos, e.Message, e.Snippet)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// interruptError is what a script stopped by its context fails with,
+// unless it ran out of its duration limit. It matches both its sentinel
+// and the error of the context.
+type interruptError struct {
+	sentinel error
+	cause    error
+}
+
+func (e *interruptError) Error() string {
+	return e.sentinel.Error()
+}
+
+func (e *interruptError) Unwrap() []error {
+	return []error{e.sentinel, e.cause}
+}
+
+func contextError(ctx context.Context) error {
+	var limitErr *LimitError
+	if errors.As(context.Cause(ctx), &limitErr) {
+		return limitErr
+	}
+
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &interruptError{sentinel: ErrDeadlineExceeded, cause: context.Cause(ctx)}
+	}
+	return &interruptError{sentinel: ErrCanceled, cause: context.Cause(ctx)}
+}
+
+func Snippet(source string, pos Position) string {
+	lines := strings.Split(source, string(NewLineSymbol))
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+
+	line := strings.TrimRight(lines[pos.Line-1], string(ReturnSymbol))
+	gutter := fmt.Sprintf("%d", pos.Line)
+	padding := strings.Repeat(string(SpaceSymbol), len(gutter))
+
+	var marker strings.Builder
+	for i, r := range []rune(line) {
+		if i >= pos.Column-1 {
+			break
+		}
+		if r == TabSymbol {
+			marker.WriteRune(TabSymbol)
+		} else {
+			marker.WriteRune(SpaceSymbol)
+		}
+	}
+	marker.WriteRune('^')
+
+	return fmt.Sprintf(" %s | %s\n %s | %s", gutter, line, padding, marker.String())
+}
+
+func (s *Script) errorAt(pos Position, err error) error {
+	var sourceErr *SourceError
+	if errors.As(err, &sourceErr) || errors.Is(err, ErrDebugAborted) {
+		return err
+	}
+	sourceErr = NewSourceError(s.source(pos.File), pos, err.Error())
+	sourceErr.Err = err
+	return sourceErr
+}
+
+func (s *Script) errorfAt(pos Position, format string, args ...interface{}) error {
+	return NewSourceError(s.source(pos.File), pos, fmt.Sprintf(format, args...))
+}
+
+func (s *Script) source(file string) string {
+	if s.modules != nil {
+		if source, ok := s.modules.sources[file]; ok {
+			return source
+		}
+	}
+	if file == s.Path {
+		return s.Content
+	}
+	return ""
+}
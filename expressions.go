@@ -6,264 +6,108 @@ import (
 	"math"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
-func isPotentialNegNumber(runes []rune, i int) bool {
-	return runes[i] == SubtractionSymbol && (i == 0 || isOperatorOrParen(runes[i-1])) && (i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.'))
-}
-
-func isOperator(r rune) bool {
-	return strings.ContainsRune(Operators, r)
+func castToFloat(v *Variable) (*Variable, error) {
+	value, err := v.toFloat()
+	if err != nil {
+		return nil, fmt.Errorf("could not cast %v to float: %v", v.Value, err)
+	}
+	return NewVariable(value, FloatType), nil
 }
 
-func isLogicalOperator(s string) bool {
-	return LogicalOperatorsPattern.MatchString(s)
-}
+func unquoteString(raw string) string {
+	runes := []rune(raw[1 : len(raw)-1])
+	var result strings.Builder
 
-func isOperatorOrParen(r rune) bool {
-	return isOperator(r) || r == ParenOpenSymbol || r == ParenCloseSymbol
-}
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != EscapeSymbol || i+1 == len(runes) {
+			result.WriteRune(runes[i])
+			continue
+		}
 
-func isLiteral(expr string) bool {
-	switch {
-	case IntegerPattern.MatchString(expr):
-		return true
-	case FloatPattern.MatchString(expr):
-		return true
-	case BooleanPattern.MatchString(expr):
-		return true
-	case StringPattern.MatchString(expr):
-		return true
-	case strings.HasPrefix(expr, string(SubtractionSymbol)) && len(expr) > 1 && unicode.IsDigit([]rune(expr)[1]):
-		if IntegerPattern.MatchString(expr) || FloatPattern.MatchString(expr) {
-			return true
+		i++
+		switch runes[i] {
+		case 'n':
+			result.WriteRune(NewLineSymbol)
+		case 't':
+			result.WriteRune(TabSymbol)
+		case 'r':
+			result.WriteRune(ReturnSymbol)
+		case StringSymbol, EscapeSymbol:
+			result.WriteRune(runes[i])
+		default:
+			result.WriteRune(EscapeSymbol)
+			result.WriteRune(runes[i])
 		}
-	default:
-		return false
 	}
-	return false
-}
 
-func isVariable(expr string) bool {
-	return VariableNamePattern.MatchString(expr)
-}
-
-func isAction(expr string) bool {
-	return len(ActionArgumentsPattern.FindStringSubmatch(expr)) == 3
-}
-
-func getPrecedence(token *Token) int {
-	switch token.Type {
-	case OperatorAddToken, OperatorSubtractToken:
-		return 1
-	case OperatorMultiplyToken, OperatorDivideToken, OperatorModuloToken:
-		return 2
-	case OperatorUnaryMinusToken:
-		return 3
-	case OperatorExponentToken:
-		return 4
-	case LogicalOrToken, LogicalXorToken:
-		return 0
-	case LogicalAndToken:
-		return 1
-	case LogicalNotToken:
-		return 5
-	case EqualityToken, InequalityToken, LessThanToken, LessThanOrEqualToken, GreaterThanToken, GreaterThanOrEqualToken:
-		return 1
-	}
-	return 0
+	return result.String()
 }
 
-func findClosingParen(runes []rune, start int) int {
-	n := len(runes)
-	open := 1
-	for i := start + 1; i < n; i++ {
-		switch runes[i] {
-		case ParenOpenSymbol:
-			open++
-		case ParenCloseSymbol:
-			open--
-			if open == 0 {
-				return i
-			}
+func quoteString(value string) string {
+	var result strings.Builder
+	result.WriteRune(StringSymbol)
+
+	for _, r := range value {
+		switch r {
+		case NewLineSymbol:
+			result.WriteString(string(EscapeSymbol) + "n")
+		case TabSymbol:
+			result.WriteString(string(EscapeSymbol) + "t")
+		case ReturnSymbol:
+			result.WriteString(string(EscapeSymbol) + "r")
+		case StringSymbol, EscapeSymbol:
+			result.WriteRune(EscapeSymbol)
+			result.WriteRune(r)
+		default:
+			result.WriteRune(r)
 		}
 	}
-	return start
+
+	result.WriteRune(StringSymbol)
+	return result.String()
 }
 
-func castToFloat(v *Variable) (*Variable, error) {
-	value, err := v.toFloat()
-	if err != nil {
-		return nil, fmt.Errorf("could not cast %v to float: %v", v.Value, err)
+// formatLiteral is the inverse of parseLiteral for scalar values.
+func formatLiteral(v *Variable) string {
+	switch v.Type {
+	case StringType:
+		return quoteString(v.Value.(string))
+	case FloatType:
+		raw := strconv.FormatFloat(v.Value.(float64), 'f', -1, 64)
+		if !strings.ContainsRune(raw, DecimalSymbol) {
+			raw += string(DecimalSymbol) + "0"
+		}
+		return raw
+	case NilType:
+		return NilString
 	}
-	return NewVariable(value, FloatType), nil
+	return fmt.Sprintf("%v", v.Value)
 }
 
 func parseLiteral(exprString string) (*Variable, error) {
 	exprString = strings.TrimSpace(exprString)
 
-	if IntegerPattern.MatchString(exprString) {
-		if value, err := strconv.Atoi(exprString); err == nil {
-			return NewVariable(value, IntegerType), nil
-		}
-	}
-	if FloatPattern.MatchString(exprString) {
+	switch {
+	case len(exprString) >= 2 && strings.HasPrefix(exprString, string(StringSymbol)) && strings.HasSuffix(exprString, string(StringSymbol)):
+		return NewVariable(unquoteString(exprString), StringType), nil
+	case exprString == TrueString:
+		return NewVariable(true, BooleanType), nil
+	case exprString == FalseString:
+		return NewVariable(false, BooleanType), nil
+	case strings.ContainsRune(exprString, DecimalSymbol):
 		if value, err := strconv.ParseFloat(exprString, 64); err == nil {
 			return NewVariable(value, FloatType), nil
 		}
-	}
-	if BooleanPattern.MatchString(exprString) {
-		if exprString == TrueString {
-			return NewVariable(true, BooleanType), nil
-		}
-		if exprString == FalseString {
-			return NewVariable(false, BooleanType), nil
+	default:
+		if value, err := strconv.Atoi(exprString); err == nil {
+			return NewVariable(value, IntegerType), nil
 		}
 	}
-	if StringPattern.MatchString(exprString) {
-		return NewVariable(exprString[1:len(exprString)-1], StringType), nil
-	}
 	return nil, fmt.Errorf("unable to parse literal: %s", exprString)
 }
 
-func parseExpression(exprString string) ([]string, error) {
-	var elements []string
-	var hasOperatorOrParen bool
-	runes := []rune(exprString)
-	n, i := len(runes), 0
-
-	for i < n {
-		switch {
-		case unicode.IsDigit(runes[i]) || (runes[i] == SubtractionSymbol && isPotentialNegNumber(runes, i)):
-			start := i
-			i++
-			for i < n && (unicode.IsDigit(runes[i]) || runes[i] == DecimalSymbol) {
-				i++
-			}
-			elements = append(elements, string(runes[start:i]))
-		case unicode.IsLetter(runes[i]):
-			start := i
-			i++
-			for i < n && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
-				i++
-			}
-			if i < n && runes[i] == ParenOpenSymbol {
-				i = findClosingParen(runes, i) + 1
-			}
-			elements = append(elements, string(runes[start:i]))
-		case runes[i] == ParenOpenSymbol || runes[i] == ParenCloseSymbol:
-			hasOperatorOrParen = true
-			elements = append(elements, string(runes[i]))
-			i++
-		case isOperator(runes[i]):
-			hasOperatorOrParen = true
-			if i+1 < n && runes[i] == ExponentSymbol && runes[i+1] == ExponentSymbol {
-				elements = append(elements, string(runes[i:i+2]))
-				i += 2
-			} else {
-				elements = append(elements, string(runes[i]))
-				i++
-			}
-		case runes[i] == StringSymbol:
-			start := i
-			i++
-			for i < n && (runes[i] != StringSymbol || (i > 0 && runes[i-1] == EscapeSymbol)) {
-				i++
-			}
-			i++
-			elements = append(elements, string(runes[start:i]))
-		case unicode.IsSpace(runes[i]):
-			i++
-		default:
-			start := i
-			for i < n && !unicode.IsDigit(runes[i]) && !unicode.IsLetter(runes[i]) && !unicode.IsSpace(runes[i]) && runes[i] != ParenOpenSymbol && runes[i] != ParenCloseSymbol {
-				i++
-			}
-			opStr := string(runes[start:i])
-			if isLogicalOperator(opStr) {
-				hasOperatorOrParen = true
-				elements = append(elements, opStr)
-			} else {
-				return nil, fmt.Errorf("unknown character in expression: %s", string(runes[start:i]))
-			}
-		}
-	}
-
-	if !hasOperatorOrParen && len(elements) == 1 {
-		return elements, nil
-	}
-	return elements, nil
-}
-
-func tokenizeExpression(exprs []string) ([]*Token, error) {
-	var tokens []*Token
-
-	for i, expr := range exprs {
-		switch expr {
-		case LogicalAndString:
-			tokens = append(tokens, NewToken(LogicalAndToken, expr))
-		case LogicalOrString:
-			tokens = append(tokens, NewToken(LogicalOrToken, expr))
-		case LogicalNotString:
-			tokens = append(tokens, NewToken(LogicalNotToken, expr))
-		case LogicalXorString:
-			tokens = append(tokens, NewToken(LogicalXorToken, expr))
-		case EqualityString:
-			tokens = append(tokens, NewToken(EqualityToken, expr))
-		case InequalityString:
-			tokens = append(tokens, NewToken(InequalityToken, expr))
-		case LessThanString:
-			tokens = append(tokens, NewToken(LessThanToken, expr))
-		case LessThanOrEqualString:
-			tokens = append(tokens, NewToken(LessThanOrEqualToken, expr))
-		case GreaterThanString:
-			tokens = append(tokens, NewToken(GreaterThanToken, expr))
-		case GreaterThanOrEqualString:
-			tokens = append(tokens, NewToken(GreaterThanOrEqualToken, expr))
-		default:
-			char := []rune(expr)[0]
-			if isAction(expr) {
-				tokens = append(tokens, NewToken(ActionToken, expr))
-			} else if isLiteral(expr) {
-				tokens = append(tokens, NewToken(LiteralToken, expr))
-			} else if isVariable(expr) {
-				tokens = append(tokens, NewToken(VariableToken, expr))
-			} else if isOperator(char) {
-				if char == SubtractionSymbol {
-					if i == 0 || (i > 0 && (tokens[i-1].Type == ParenOpenToken || tokens[i-1].Type == OperatorAddToken || tokens[i-1].Type == OperatorSubtractToken || tokens[i-1].Type == OperatorMultiplyToken || tokens[i-1].Type == OperatorDivideToken || tokens[i-1].Type == OperatorModuloToken || tokens[i-1].Type == OperatorExponentToken)) {
-						tokens = append(tokens, NewToken(OperatorUnaryMinusToken, expr))
-					} else {
-						tokens = append(tokens, NewToken(OperatorSubtractToken, expr))
-					}
-				} else {
-					switch char {
-					case AdditionSymbol:
-						tokens = append(tokens, NewToken(OperatorAddToken, expr))
-					case SubtractionSymbol:
-						tokens = append(tokens, NewToken(OperatorSubtractToken, expr))
-					case MultiplicationSymbol:
-						tokens = append(tokens, NewToken(OperatorMultiplyToken, expr))
-					case DivisionSymbol:
-						tokens = append(tokens, NewToken(OperatorDivideToken, expr))
-					case ModulusSymbol:
-						tokens = append(tokens, NewToken(OperatorModuloToken, expr))
-					case ExponentSymbol:
-						tokens = append(tokens, NewToken(OperatorExponentToken, expr))
-					}
-				}
-			} else if char == ParenOpenSymbol {
-				tokens = append(tokens, NewToken(ParenOpenToken, expr))
-			} else if char == ParenCloseSymbol {
-				tokens = append(tokens, NewToken(ParenCloseToken, expr))
-			} else {
-				return nil, fmt.Errorf("unknown token found: %s", expr)
-			}
-		}
-	}
-	return tokens, nil
-}
-
 func ensureCompatibleOperands(a, b *Variable) (*Variable, *Variable, error) {
 	var err error
 	if a.Type == NilType || b.Type == NilType {
@@ -275,8 +119,8 @@ func ensureCompatibleOperands(a, b *Variable) (*Variable, *Variable, error) {
 	}
 
 	if a.Type == StringType || b.Type == StringType {
-		a.Value, b.Value = fmt.Sprintf("%v", a.Value), fmt.Sprintf("%v", b.Value)
-		a.Type, b.Type = StringType, StringType
+		a = NewVariable(fmt.Sprintf("%v", a.Value), StringType)
+		b = NewVariable(fmt.Sprintf("%v", b.Value), StringType)
 	} else {
 		if a.Type != FloatType {
 			if a, err = castToFloat(a); err != nil {
@@ -292,275 +136,276 @@ func ensureCompatibleOperands(a, b *Variable) (*Variable, *Variable, error) {
 	return a, b, nil
 }
 
-func (s *Script) toRPN(tokens []*Token) []*Token {
-	var output []*Token
-	var operatorStack []*Token
-	for _, token := range tokens {
-		switch token.Type {
-		case VariableToken, ActionToken, LiteralToken:
-			output = append(output, token)
-		case OperatorAddToken, OperatorSubtractToken, OperatorMultiplyToken, OperatorDivideToken, OperatorModuloToken, OperatorUnaryMinusToken, OperatorExponentToken,
-			LogicalAndToken, LogicalOrToken, LogicalXorToken, LogicalNotToken, EqualityToken, InequalityToken, LessThanToken,
-			LessThanOrEqualToken, GreaterThanToken, GreaterThanOrEqualToken:
-			for len(operatorStack) > 0 {
-				top := operatorStack[len(operatorStack)-1]
-				if top.Type == ParenOpenToken {
-					break
-				}
-				if getPrecedence(top) >= getPrecedence(token) {
-					output = append(output, top)
-					operatorStack = operatorStack[:len(operatorStack)-1]
-				} else {
-					break
-				}
-			}
-			operatorStack = append(operatorStack, token)
-		case ParenOpenToken:
-			operatorStack = append(operatorStack, token)
-		case ParenCloseToken:
-			for len(operatorStack) > 0 {
-				top := operatorStack[len(operatorStack)-1]
-				operatorStack = operatorStack[:len(operatorStack)-1]
-				if top.Type == ParenOpenToken {
-					break
-				}
-				output = append(output, top)
-			}
-		}
+func (s *Script) resolveVariable(name string) (*Variable, error) {
+	if variable := s.CurrentBlock.Memory.GetQualifiedVariable(name); variable != nil {
+		return variable, nil
 	}
-	for len(operatorStack) > 0 {
-		output = append(output, operatorStack[len(operatorStack)-1])
-		operatorStack = operatorStack[:len(operatorStack)-1]
+	if action := s.CurrentBlock.Memory.GetAction(name); action != nil {
+		return NewVariable(action, ActionType), nil
 	}
-	return output
+	return nil, fmt.Errorf("undefined variable: %s", name)
 }
 
-func (s *Script) evaluateRPN(rpn []*Token) (*Variable, error) {
-	var stack []*Variable
-	for _, token := range rpn {
-		switch token.Type {
-		case ActionToken:
-			action, err := s.parseActionToken(token)
-			if err != nil {
-				return nil, err
-			}
-			value, err := action.Execute(s)
-			if err != nil {
-				return nil, err
-			}
-			if len(value) != 1 {
-				return nil, fmt.Errorf("action returned multiple values: %v", value)
-			}
-			stack = append(stack, value[0])
-		case VariableToken:
-			variable := s.CurrentBlock.Memory.GetVariable(token.Value)
-			if variable == nil {
-				return nil, fmt.Errorf("undefined variable: %s", token.Value)
-			}
-			stack = append(stack, variable)
-		case LiteralToken:
-			variable, err := parseLiteral(token.Value)
+func (s *Script) evaluate(expr Expression) (*Variable, error) {
+	switch node := expr.(type) {
+	case *LiteralNode:
+		return NewVariable(node.Value.Value, node.Value.Type), nil
+	case *IdentifierNode:
+		variable, err := s.resolveVariable(node.Name)
+		if err != nil {
+			return nil, s.errorAt(node.Pos, err)
+		}
+		return variable, nil
+	case *CallNode:
+		values, err := s.evaluateCall(node)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 1 {
+			return nil, s.errorfAt(node.Pos, "'%s' action returned %d values, expected one", node.Name, len(values))
+		}
+		return values[0], nil
+	case *LambdaNode:
+		return NewVariable(s.buildLambda(node), ActionType), nil
+	case *IndexNode:
+		target, err := s.evaluate(node.Target)
+		if err != nil {
+			return nil, err
+		}
+		index, err := s.evaluate(node.Index)
+		if err != nil {
+			return nil, err
+		}
+		result, err := indexVariable(target, index)
+		if err != nil {
+			return nil, s.errorAt(node.Pos, err)
+		}
+		return result, nil
+	case *FieldNode:
+		target, err := s.evaluate(node.Target)
+		if err != nil {
+			return nil, err
+		}
+		if target.Type != MapType {
+			return nil, s.errorfAt(node.Pos, "cannot access field '%s' of %v", node.Name, target.Type)
+		}
+		field, ok := target.Value.(map[string]*Variable)[node.Name]
+		if !ok {
+			return nil, s.errorfAt(node.Pos, "undefined field: %s", node.Name)
+		}
+		return field, nil
+	case *UnaryNode:
+		operand, err := s.evaluate(node.Operand)
+		if err != nil {
+			return nil, err
+		}
+		result, err := evaluateUnary(node.Operator, operand)
+		if err != nil {
+			return nil, s.errorAt(node.Pos, err)
+		}
+		return result, nil
+	case *BinaryNode:
+		left, err := s.evaluate(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := s.evaluate(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		result, err := evaluateBinary(node.Operator, left, right)
+		if err == nil {
+			err = s.checkSize(result)
+		}
+		if err != nil {
+			return nil, s.errorAt(node.Pos, err)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unknown expression node: %T", expr)
+}
+
+func (s *Script) evaluateCall(node *CallNode) ([]*Variable, error) {
+	var args []*Variable
+	var named map[string]*Variable
+
+	for _, argument := range node.Arguments {
+		var value *Variable
+		if call, ok := argument.Value.(*CallNode); ok {
+			values, err := s.evaluateCall(call)
 			if err != nil {
 				return nil, err
 			}
-			stack = append(stack, variable)
-		case OperatorUnaryMinusToken:
-			if len(stack) < 1 {
-				return nil, fmt.Errorf("insufficient values for unary operation")
-			}
-			a := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-			if a.Type != FloatType && a.Type != IntegerType {
-				return nil, fmt.Errorf("unary minus operand is not a number, got %s", a.Type.String())
-			}
-			castA, _ := a.toFloat()
-			stack = append(stack, NewVariable(-castA, FloatType))
-		case OperatorAddToken, OperatorSubtractToken, OperatorMultiplyToken, OperatorDivideToken:
-			if len(stack) < 2 {
-				return nil, fmt.Errorf("insufficient values in expression for %s", token.Type.String())
-			}
-			b, a := stack[len(stack)-1], stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			var err error
-			a, b, err = ensureCompatibleOperands(a, b)
-			if err != nil {
-				return nil, fmt.Errorf("ensure compatible operands: %v", err)
-			}
-			if a.Type == StringType && b.Type == StringType {
-				if token.Type == OperatorAddToken {
-					result := a.Value.(string) + b.Value.(string)
-					stack = append(stack, NewVariable(result, StringType))
-				} else {
-					return nil, fmt.Errorf("only addition '+' operator is supported for strings, got %s", token.Type.String())
-				}
-			} else if a.Type == FloatType && b.Type == FloatType {
-				castA, _ := a.toFloat()
-				castB, _ := b.toFloat()
-				var result float64
-				switch token.Type {
-				case OperatorAddToken:
-					result = castA + castB
-				case OperatorSubtractToken:
-					result = castA - castB
-				case OperatorMultiplyToken:
-					result = castA * castB
-				case OperatorDivideToken:
-					if castB == 0 {
-						return nil, fmt.Errorf("division by zero")
-					}
-					result = castA / castB
-				}
-				stack = append(stack, NewVariable(result, FloatType))
+			if len(values) == 1 {
+				value = values[0]
 			} else {
-				return nil, fmt.Errorf("type mismatch between %v (type: %s) and %v (type: %s)", a.Value, a.Type.String(), b.Value, b.Type.String())
-			}
-		case OperatorModuloToken:
-			if len(stack) < 2 {
-				return nil, fmt.Errorf("%s", token.Type.String())
-			}
-			b, a := stack[len(stack)-1], stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			a, b, err := ensureCompatibleOperands(a, b)
-			if err != nil {
-				return nil, fmt.Errorf("ensure compatible operands: %v", err)
-			}
-			castA, _ := a.toFloat()
-			castB, _ := b.toFloat()
-			stack = append(stack, NewVariable(math.Mod(castA, castB), FloatType))
-		case OperatorExponentToken:
-			if len(stack) < 2 {
-				return nil, fmt.Errorf("insufficient values in expression for %s", token.Type.String())
-			}
-			b, a := stack[len(stack)-1], stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			a, b, err := ensureCompatibleOperands(a, b)
-			if err != nil {
-				return nil, fmt.Errorf("ensure compatible operands: %v", err)
-			}
-			castA, _ := a.toFloat()
-			castB, _ := b.toFloat()
-			stack = append(stack, NewVariable(math.Pow(castA, castB), FloatType))
-		case LogicalAndToken, LogicalOrToken, LogicalXorToken:
-			if len(stack) < 2 {
-				return nil, fmt.Errorf("insufficient values for %s", token.Type.String())
-			}
-			b, a := stack[len(stack)-1], stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			castA, _ := a.toBool()
-			castB, _ := b.toBool()
-			var result bool
-			switch token.Type {
-			case LogicalAndToken:
-				result = castA && castB
-			case LogicalOrToken:
-				result = castA || castB
-			case LogicalXorToken:
-				result = (castA || castB) && !(castA && castB)
+				value = NewVariable(values, ArrayType)
 			}
-			stack = append(stack, NewVariable(result, BooleanType))
-		case LogicalNotToken:
-			if len(stack) < 1 {
-				return nil, fmt.Errorf("insufficient values for %s", token.Type.String())
-			}
-			a := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-			castA, _ := a.toBool()
-			stack = append(stack, NewVariable(!castA, BooleanType))
-		case EqualityToken, InequalityToken, LessThanToken, LessThanOrEqualToken, GreaterThanToken, GreaterThanOrEqualToken:
-			if len(stack) < 2 {
-				return nil, fmt.Errorf("insufficient values for %s", token.Type.String())
-			}
-			b, a := stack[len(stack)-1], stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			a, b, err := ensureCompatibleOperands(a, b)
-			if err != nil {
+		} else {
+			var err error
+			if value, err = s.evaluate(argument.Value); err != nil {
 				return nil, err
 			}
-			var result bool
-			if a.Type == StringType && b.Type == StringType {
-				valA := a.Value.(string)
-				valB := b.Value.(string)
-				switch token.Type {
-				case EqualityToken:
-					result = (valA == valB)
-				case InequalityToken:
-					result = (valA != valB)
-				}
-			} else if a.Type == FloatType && b.Type == FloatType {
-				valA, _ := a.toFloat()
-				valB, _ := b.toFloat()
-				switch token.Type {
-				case EqualityToken:
-					result = (valA == valB)
-				case InequalityToken:
-					result = (valA != valB)
-				case LessThanToken:
-					result = (valA < valB)
-				case LessThanOrEqualToken:
-					result = (valA <= valB)
-				case GreaterThanToken:
-					result = (valA > valB)
-				case GreaterThanOrEqualToken:
-					result = (valA >= valB)
-				}
-			} else {
-				return nil, fmt.Errorf("type mismatch between %v and %v", a.Type.String(), b.Type.String())
+		}
+
+		if argument.Name != "" {
+			if named == nil {
+				named = make(map[string]*Variable)
 			}
-			stack = append(stack, NewVariable(result, BooleanType))
-		default:
-			return nil, fmt.Errorf("unknown token type: %v", token.Type)
+			named[argument.Name] = value
+		} else {
+			args = append(args, value)
 		}
 	}
-	if len(stack) != 1 {
-		return nil, fmt.Errorf("invalid expression, final stack: %v", stack)
+
+	var target *Action
+	if node.Name != "" {
+		if target = s.CurrentBlock.Memory.ResolveAction(node.Name); target == nil {
+			return nil, s.errorfAt(node.Pos, "undefined action: %s", node.Name)
+		}
+	} else {
+		callee, err := s.evaluate(node.Callee)
+		if err != nil {
+			return nil, err
+		}
+		if callee.Type != ActionType {
+			return nil, s.errorfAt(node.Pos, "cannot call %v", callee.Type)
+		}
+		target = callee.Value.(*Action)
 	}
-	return stack[0], nil
-}
 
-func (s *Script) parseExpression(exprString string) (*Action, error) {
-	exprs, err := parseExpression(exprString)
+	values, err := target.invoke(s, node.Name, args, named)
 	if err != nil {
-		return nil, err
+		return nil, s.errorAt(node.Pos, err)
 	}
+	return values, nil
+}
 
-	expressionAction := func(s *Script, args ...*Variable) ([]*Variable, error) {
-		tokens, err := tokenizeExpression(exprs)
+func indexVariable(target, index *Variable) (*Variable, error) {
+	switch target.Type {
+	case ArrayType, MapType:
+		values, err := GetAction(nil, target, index)
 		if err != nil {
 			return nil, err
 		}
+		return values[0], nil
+	case StringType:
+		runes := []rune(target.Value.(string))
+		position, err := index.toInt()
+		if err != nil {
+			return nil, err
+		}
+		if position < 0 || position >= len(runes) {
+			return nil, fmt.Errorf("index %d out of range for string of length %d", position, len(runes))
+		}
+		return NewVariable(string(runes[position]), StringType), nil
+	}
+	return nil, fmt.Errorf("cannot index %v", target.Type)
+}
 
-		if len(tokens) == 1 {
-			switch tokens[0].Type {
-			case ActionToken:
-				action, err := s.parseActionToken(tokens[0])
-				if err != nil {
-					return nil, err
-				}
-
-				value, err := action.Execute(s)
-				if err != nil {
-					return nil, err
-				}
+func evaluateUnary(operator TokenType, a *Variable) (*Variable, error) {
+	switch operator {
+	case OperatorUnaryMinusToken:
+		if a.Type != FloatType && a.Type != IntegerType {
+			return nil, fmt.Errorf("unary minus operand is not a number, got %s", a.Type.String())
+		}
+		castA, _ := a.toFloat()
+		return NewVariable(-castA, FloatType), nil
+	case LogicalNotToken:
+		castA, _ := a.toBool()
+		return NewVariable(!castA, BooleanType), nil
+	}
+	return nil, fmt.Errorf("unknown unary operator: %v", operator)
+}
 
-				return value, nil
-			case VariableToken:
-				variable := s.CurrentBlock.Memory.GetVariable(tokens[0].Value)
-				if variable == nil {
-					return nil, fmt.Errorf("undefined variable: %s", tokens[0].Value)
-				}
-				return []*Variable{variable}, nil
+func evaluateBinary(operator TokenType, a, b *Variable) (*Variable, error) {
+	switch operator {
+	case OperatorAddToken, OperatorSubtractToken, OperatorMultiplyToken, OperatorDivideToken:
+		a, b, err := ensureCompatibleOperands(a, b)
+		if err != nil {
+			return nil, fmt.Errorf("ensure compatible operands: %v", err)
+		}
+		if a.Type == StringType && b.Type == StringType {
+			if operator == OperatorAddToken {
+				return NewVariable(a.Value.(string)+b.Value.(string), StringType), nil
 			}
+			return nil, fmt.Errorf("only addition '+' operator is supported for strings, got %s", operator.String())
 		}
-
-		rpn := s.toRPN(tokens)
-
-		result, err := s.evaluateRPN(rpn)
+		castA, _ := a.toFloat()
+		castB, _ := b.toFloat()
+		var result float64
+		switch operator {
+		case OperatorAddToken:
+			result = castA + castB
+		case OperatorSubtractToken:
+			result = castA - castB
+		case OperatorMultiplyToken:
+			result = castA * castB
+		case OperatorDivideToken:
+			if castB == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			result = castA / castB
+		}
+		return NewVariable(result, FloatType), nil
+	case OperatorModuloToken, OperatorExponentToken:
+		a, b, err := ensureCompatibleOperands(a, b)
+		if err != nil {
+			return nil, fmt.Errorf("ensure compatible operands: %v", err)
+		}
+		castA, _ := a.toFloat()
+		castB, _ := b.toFloat()
+		if operator == OperatorModuloToken {
+			return NewVariable(math.Mod(castA, castB), FloatType), nil
+		}
+		return NewVariable(math.Pow(castA, castB), FloatType), nil
+	case LogicalAndToken, LogicalOrToken, LogicalXorToken:
+		castA, _ := a.toBool()
+		castB, _ := b.toBool()
+		var result bool
+		switch operator {
+		case LogicalAndToken:
+			result = castA && castB
+		case LogicalOrToken:
+			result = castA || castB
+		case LogicalXorToken:
+			result = (castA || castB) && !(castA && castB)
+		}
+		return NewVariable(result, BooleanType), nil
+	case EqualityToken, InequalityToken, LessThanToken, LessThanOrEqualToken, GreaterThanToken, GreaterThanOrEqualToken:
+		a, b, err := ensureCompatibleOperands(a, b)
 		if err != nil {
 			return nil, err
 		}
-
-		return []*Variable{result}, nil
+		var result bool
+		if a.Type == StringType && b.Type == StringType {
+			valA := a.Value.(string)
+			valB := b.Value.(string)
+			switch operator {
+			case EqualityToken:
+				result = (valA == valB)
+			case InequalityToken:
+				result = (valA != valB)
+			}
+		} else {
+			valA, _ := a.toFloat()
+			valB, _ := b.toFloat()
+			switch operator {
+			case EqualityToken:
+				result = (valA == valB)
+			case InequalityToken:
+				result = (valA != valB)
+			case LessThanToken:
+				result = (valA < valB)
+			case LessThanOrEqualToken:
+				result = (valA <= valB)
+			case GreaterThanToken:
+				result = (valA > valB)
+			case GreaterThanOrEqualToken:
+				result = (valA >= valB)
+			}
+		}
+		return NewVariable(result, BooleanType), nil
 	}
-
-	return NewAction(expressionAction, nil), nil
-}
+	return nil, fmt.Errorf("unknown operator: %v", operator)
+}
\ No newline at end of file
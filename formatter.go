@@ -0,0 +1,386 @@
+// formatter.go
+package taskwrappr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type formatter struct {
+	script     *Script
+	tokens     []*Token
+	indexes    map[Position]int
+	comments   []*Token
+	out        strings.Builder
+	indent     int
+	line       int
+	blockStart bool
+}
+
+// Format parses source and prints it back in the canonical style: tab
+// indentation, opening braces on the line of their action, one statement
+// per line, single spaces around binary operators and at most one blank
+// line in a row. Comments are kept. Source with syntax errors is rejected
+// with its diagnostics, and the result is parsed again to make sure it
+// still means the same program.
+func Format(path, source string) (string, error) {
+	s := &Script{Path: path, Content: source}
+	program, diagnostics := s.Parse()
+	if err := diagnostics.Err(); err != nil {
+		return "", err
+	}
+
+	tokens, _ := NewLexer(path, source).TokenizeAll()
+	f := &formatter{script: s, tokens: tokens, indexes: make(map[Position]int)}
+	for i, token := range tokens {
+		f.indexes[token.Pos] = i
+		if token.Type == CommentToken {
+			f.comments = append(f.comments, token)
+		}
+	}
+
+	f.blockStart = true
+	f.statements(program.Statements)
+	f.leading(-1)
+	formatted := f.out.String()
+
+	if err := checkFormatted(s, path, formatted); err != nil {
+		return "", err
+	}
+	return formatted, nil
+}
+
+// checkFormatted parses the original and the formatted source again and
+// compares both programs with their positions cleared.
+func checkFormatted(original *Script, path, formatted string) error {
+	before, _ := original.Parse()
+	after, diagnostics := (&Script{Path: path, Content: formatted}).Parse()
+	if err := diagnostics.Err(); err != nil {
+		return fmt.Errorf("formatting produced invalid source: %v", err)
+	}
+
+	clearPositions(before)
+	clearPositions(after)
+	if !reflect.DeepEqual(before, after) {
+		return fmt.Errorf("formatting would change the meaning of %s", path)
+	}
+	return nil
+}
+
+func clearPositions(program *BlockNode) {
+	Walk(program, func(node Node) bool {
+		switch n := node.(type) {
+		case *BlockNode:
+			n.Pos = Position{}
+		case *LiteralNode:
+			n.Pos = Position{}
+		case *IdentifierNode:
+			n.Pos = Position{}
+		case *UnaryNode:
+			n.Pos = Position{}
+		case *BinaryNode:
+			n.Pos = Position{}
+		case *ArgumentNode:
+			n.Pos = Position{}
+		case *CallNode:
+			n.Pos = Position{}
+		case *IndexNode:
+			n.Pos = Position{}
+		case *FieldNode:
+			n.Pos = Position{}
+		case *ParameterNode:
+			n.Pos = Position{}
+		case *LambdaNode:
+			n.Pos = Position{}
+		case *CallStatementNode:
+			n.Pos = Position{}
+		case *AssignmentNode:
+			n.Pos = Position{}
+		case *DeclarationNode:
+			n.Pos = Position{}
+		case *AugmentedAssignmentNode:
+			n.Pos = Position{}
+		case *ActionDeclarationNode:
+			n.Pos = Position{}
+		case *ImportNode:
+			n.Pos = Position{}
+		}
+		return true
+	})
+}
+
+func (f *formatter) write(text string) {
+	f.out.WriteString(text)
+}
+
+func (f *formatter) newLine() {
+	f.write(string(NewLineSymbol))
+}
+
+func (f *formatter) writeIndent() {
+	f.write(strings.Repeat(string(TabSymbol), f.indent))
+}
+
+// separate keeps a single blank line before something starting at line
+// when the source had at least one.
+func (f *formatter) separate(line int) {
+	if !f.blockStart && line > f.line+1 {
+		f.newLine()
+	}
+	f.blockStart = false
+}
+
+// leading writes the comments on their own lines before line, or all of
+// the remaining ones when line is negative.
+func (f *formatter) leading(line int) {
+	for len(f.comments) > 0 && (line < 0 || f.comments[0].Pos.Line < line) {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+
+		f.separate(comment.Pos.Line)
+		f.writeIndent()
+		f.write(strings.TrimRight(comment.Value, " \t"))
+		f.newLine()
+		f.line = comment.Pos.Line
+	}
+}
+
+// trailing writes the comments up to line at the end of the current line.
+func (f *formatter) trailing(line int) {
+	for len(f.comments) > 0 && f.comments[0].Pos.Line <= line {
+		f.write(string(SpaceSymbol) + strings.TrimRight(f.comments[0].Value, " \t"))
+		f.comments = f.comments[1:]
+	}
+}
+
+func (f *formatter) statements(statements []Statement) {
+	for _, statement := range statements {
+		f.leading(statement.Position().Line)
+		f.separate(statement.Position().Line)
+		f.writeIndent()
+		f.statement(statement)
+		f.newLine()
+	}
+}
+
+func (f *formatter) statement(statement Statement) {
+	var body *BlockNode
+
+	switch node := statement.(type) {
+	case *AssignmentNode:
+		f.write(node.Name + " " + string(AssignmentSymbol) + " ")
+		f.expression(node.Value, 0)
+	case *DeclarationNode:
+		f.write(node.Name)
+		if node.TypeName != "" {
+			f.write(string(DeclarationSymbol) + " " + node.TypeName)
+		}
+		f.write(" " + DeclarationString + " ")
+		f.expression(node.Value, 0)
+	case *AugmentedAssignmentNode:
+		f.write(node.Name + " " + node.Operator + " ")
+		f.expression(node.Value, 0)
+	case *ImportNode:
+		f.write(ImportString + string(ParenOpenSymbol))
+		f.expression(node.Path, 0)
+		f.write(string(ParenCloseSymbol))
+		if node.Alias != "" {
+			f.write(" " + AliasString + " " + node.Alias)
+		}
+	case *ActionDeclarationNode:
+		f.write(node.Name + " " + DeclarationString + " " + ActionString)
+		f.parameters(node.Parameters)
+		body = node.Body
+	case *CallStatementNode:
+		f.expression(node.Call, 0)
+		body = node.Body
+	}
+
+	if body == nil {
+		end := f.statementEnd(statement)
+		f.trailing(end)
+		f.line = end
+		return
+	}
+	if f.block(body) {
+		f.trailing(f.line)
+	}
+}
+
+// block writes a code block starting on the current line and ends right
+// after its closing brace, which may be followed by more of an expression.
+// It reports whether the brace ended its line in the source.
+func (f *formatter) block(body *BlockNode) bool {
+	f.write(" " + string(CodeBlockOpenSymbol))
+	f.trailing(body.Pos.Line)
+	f.newLine()
+
+	closeLine, endsLine := f.closingLine(body)
+	f.indent++
+	f.line, f.blockStart = body.Pos.Line, true
+	f.statements(body.Statements)
+	f.leading(closeLine)
+	f.indent--
+
+	f.writeIndent()
+	f.write(string(CodeBlockCloseSymbol))
+	f.line = closeLine
+	return endsLine
+}
+
+func (f *formatter) closingLine(body *BlockNode) (int, bool) {
+	if index, ok := f.indexes[body.Pos]; ok {
+		if close := findClosingToken(f.tokens, index); close >= 0 {
+			switch next := f.tokens[close+1]; next.Type {
+			case NewLineToken, CommentToken, SeparatorToken, EOFToken:
+				return f.tokens[close].Pos.Line, true
+			}
+			return f.tokens[close].Pos.Line, false
+		}
+	}
+	return body.Pos.Line, true
+}
+
+// statementEnd is the source line of the last token of a statement
+// without a code block.
+func (f *formatter) statementEnd(statement Statement) int {
+	index, ok := f.indexes[statement.Position()]
+	if !ok {
+		return statement.Position().Line
+	}
+	p := &parser{script: f.script, tokens: f.tokens, index: index}
+	end, err := p.statementEnd()
+	if err != nil || end == 0 {
+		return statement.Position().Line
+	}
+	return f.tokens[end-1].Pos.Line
+}
+
+func (f *formatter) parameters(parameters []*ParameterNode) {
+	f.write(string(ParenOpenSymbol))
+	for i, parameter := range parameters {
+		if i > 0 {
+			f.write(string(DelimiterSymbol) + " ")
+		}
+		if parameter.Variadic {
+			f.write(VariadicString)
+		}
+		f.write(parameter.Name)
+		if parameter.TypeName != "" {
+			f.write(string(DeclarationSymbol) + " " + parameter.TypeName)
+		}
+		if parameter.Default != nil {
+			f.write(" " + string(AssignmentSymbol) + " ")
+			f.expression(parameter.Default, 0)
+		}
+	}
+	f.write(string(ParenCloseSymbol))
+}
+
+// precedence is how tightly an expression binds when it is printed
+// without parentheses. Negative number literals read like unary minus.
+func precedence(expr Expression) int {
+	switch node := expr.(type) {
+	case *BinaryNode:
+		return OperatorTable[node.Operator].Precedence
+	case *UnaryNode:
+		return PrefixPrecedence
+	case *LiteralNode:
+		if strings.HasPrefix(node.Raw, string(SubtractionSymbol)) {
+			return PrefixPrecedence
+		}
+	case *LambdaNode:
+		return 0
+	case *CallNode, *IndexNode, *FieldNode:
+		return PostfixPrecedence
+	}
+	return PostfixPrecedence + 1
+}
+
+// expression writes expr, wrapped in parentheses when it binds looser
+// than minimum.
+func (f *formatter) expression(expr Expression, minimum int) {
+	if precedence(expr) < minimum {
+		f.write(string(ParenOpenSymbol))
+		defer f.write(string(ParenCloseSymbol))
+	}
+
+	switch node := expr.(type) {
+	case *LiteralNode:
+		f.write(node.Raw)
+	case *IdentifierNode:
+		f.write(node.Name)
+	case *UnaryNode:
+		f.write(node.Symbol)
+		minimum := PrefixPrecedence
+		if node.Operator == OperatorUnaryMinusToken && startsWithMinusOrNumber(node.Operand) {
+			minimum = PostfixPrecedence + 2
+		}
+		f.expression(node.Operand, minimum)
+	case *BinaryNode:
+		info := OperatorTable[node.Operator]
+		left, right := info.Precedence, info.Precedence+1
+		if info.Associativity == RightAssociative {
+			left, right = info.Precedence+1, info.Precedence
+		}
+		if node.Operator == OperatorSubtractToken && startsWithMinus(node.Right) {
+			right = PostfixPrecedence + 2
+		}
+		f.expression(node.Left, left)
+		f.write(" " + node.Symbol + " ")
+		f.expression(node.Right, right)
+	case *CallNode:
+		f.expression(node.Callee, PostfixPrecedence)
+		f.write(string(ParenOpenSymbol))
+		for i, argument := range node.Arguments {
+			if i > 0 {
+				f.write(string(DelimiterSymbol) + " ")
+			}
+			if argument.Name != "" {
+				f.write(argument.Name + " " + DeclarationString + " ")
+			}
+			f.expression(argument.Value, 0)
+		}
+		f.write(string(ParenCloseSymbol))
+	case *IndexNode:
+		f.expression(node.Target, PostfixPrecedence)
+		f.write(string(BracketOpenSymbol))
+		f.expression(node.Index, 0)
+		f.write(string(BracketCloseSymbol))
+	case *FieldNode:
+		f.expression(node.Target, PostfixPrecedence)
+		f.write(string(DecimalSymbol) + node.Name)
+	case *LambdaNode:
+		f.parameters(node.Parameters)
+		f.write(" " + LambdaArrowString)
+		if node.Result != nil {
+			f.write(" ")
+			f.expression(node.Result, 0)
+		} else {
+			f.block(node.Body)
+		}
+	}
+}
+
+// startsWithMinusOrNumber reports whether expr would be printed starting
+// with a minus sign or a number, which a unary minus in front of it would
+// otherwise merge with.
+func startsWithMinusOrNumber(expr Expression) bool {
+	if literal, ok := expr.(*LiteralNode); ok {
+		return isNumberLiteral(&Token{Type: LiteralToken, Value: literal.Raw})
+	}
+	return startsWithMinus(expr)
+}
+
+func startsWithMinus(expr Expression) bool {
+	switch node := expr.(type) {
+	case *LiteralNode:
+		return strings.HasPrefix(node.Raw, string(SubtractionSymbol))
+	case *UnaryNode:
+		return node.Operator == OperatorUnaryMinusToken
+	case *BinaryNode:
+		return startsWithMinus(node.Left)
+	}
+	return false
+}
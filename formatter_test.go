@@ -0,0 +1,62 @@
+// formatter_test.go
+package taskwrappr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	cases := map[string]string{
+		"x:=1+2*3": "x := 1 + 2 * 3\n",
+		"a := 1;b=a^-2\n\n\n\nc  +=  (a - (-b))\n":                                                    "a := 1\nb = a ^ (-2)\n\nc += a - (-b)\n",
+		"y := -(2) + (-2)^2 - -(-x) * (1 - 2)":                                                        "y := -(2) + (-2) ^ 2 - (-(-x) * (1 - 2))\n",
+		"if (x > 0)\n{\n    print(\"a\")   # yes\n}   else() { # no\n\n\n  print(\"b\")\n}\n":         "if(x > 0) {\n\tprint(\"a\") # yes\n}\nelse() { # no\n\tprint(\"b\")\n}\n",
+		"f := (n, m := 2) => n * m\ng := action(...rest: int, sep := \"-\") {\n# only a comment\n}\n": "f := (n, m = 2) => n * m\ng := action(...rest: int, sep = \"-\") {\n\t# only a comment\n}\n",
+		"call((k) => { # body\n  print(k)\n  }, # after\n  5)\nprint(m.a[0], sep := \"\")":            "call((k) => { # body\n\tprint(k)\n}, 5) # after\nprint(m.a[0], sep := \"\")\n",
+		"#!/usr/bin/env taskwrappr\n\n\nimport(\"lib/util.tw\")   as   u\n# end":                      "#!/usr/bin/env taskwrappr\n\nimport(\"lib/util.tw\") as u\n# end\n",
+	}
+
+	for source, expected := range cases {
+		formatted, err := Format("test.tw", source)
+		if err != nil {
+			t.Errorf("%q: Format returned an error: %s", source, err)
+			continue
+		}
+		if formatted != expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", source, expected, formatted)
+		}
+	}
+}
+
+func TestFormatIsStable(t *testing.T) {
+	paths, err := filepath.Glob("scripts/*.tw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := Format(path, string(source))
+		if err != nil {
+			t.Errorf("%s: Format returned an error: %s", path, err)
+			continue
+		}
+		again, err := Format(path, formatted)
+		if err != nil || again != formatted {
+			t.Errorf("%s: formatting is not stable (%v):\n%s\n%s", path, err, formatted, again)
+		}
+	}
+}
+
+func TestFormatRejectsSyntaxErrors(t *testing.T) {
+	_, err := Format("test.tw", "x := 1 +\ny := (2\n")
+	diagnostics, ok := err.(Diagnostics)
+	if !ok || len(diagnostics) != 2 {
+		t.Errorf("expected the two syntax errors as diagnostics, got %v", err)
+	}
+}
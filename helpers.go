@@ -4,88 +4,8 @@ package taskwrappr
 import (
 	"fmt"
 	"math"
-	"strings"
 )
 
-func splitTopLevelArgs(argsString string) []string {
-	var args []string
-	var currentArg strings.Builder
-	openBrackets := 0
-	inQuotes := false
-	escaped := false
-
-	for _, ch := range argsString {
-		switch ch {
-		case ParenOpenSymbol:
-			if !inQuotes && !escaped {
-				openBrackets++
-			}
-		case ParenCloseSymbol:
-			if !inQuotes && !escaped {
-				openBrackets--
-			}
-		case StringSymbol:
-			if !escaped {
-				inQuotes = !inQuotes
-			}
-		case DelimiterSymbol:
-			if openBrackets == 0 && !inQuotes && !escaped {
-				args = append(args, strings.TrimSpace(currentArg.String()))
-				currentArg.Reset()
-				continue
-			}
-		}
-
-		currentArg.WriteRune(ch)
-
-		if ch == EscapeSymbol {
-			escaped = !escaped
-		} else {
-			escaped = false
-		}
-	}
-
-	if currentArg.Len() > 0 {
-		args = append(args, strings.TrimSpace(currentArg.String()))
-	}
-
-	return args
-}
-
-func tokenizeLine(line string) (*Token, error) {
-	line = strings.TrimSpace(line)
-	if line == "" {
-		return NewToken(IgnoreToken, line), nil
-	}
-
-	switch line[0] {
-	case CommentSymbol:
-		return NewToken(IgnoreToken, line), nil
-	case CodeBlockOpenSymbol:
-		return NewToken(CodeBlockOpenToken, line), nil
-	case CodeBlockCloseSymbol:
-		return NewToken(CodeBlockCloseToken, line), nil
-	}
-
-	if AssignmentPattern.MatchString(line) {
-		return NewToken(AssignmentToken, line), nil
-	}
-
-	if DeclarationPattern.MatchString(line) {
-		return NewToken(DeclarationToken, line), nil
-	}
-
-	if ActionCallPattern.MatchString(line) {
-		return NewToken(ActionToken, line), nil
-	}
-
-	if AugmentedAssignementPattern.MatchString(line) {
-		return NewToken(AugmentedAssignmentToken, line), nil
-	}
-
-	return NewToken(InvalidToken, line), fmt.Errorf("invalid line: %s", line)
-}
-
 func ensureArithmeticOperands(a, b *Variable) (*Variable, *Variable, error) {
 	var err error
 	switch a.Type {
@@ -105,245 +25,254 @@ func ensureArithmeticOperands(a, b *Variable) (*Variable, *Variable, error) {
 	return a, b, nil
 }
 
-func (s *Script) parseActionToken(token *Token) (*Action, error) {
-	match := ActionArgumentsPattern.FindStringSubmatch(token.Value)
-	if len(match) != 3 {
-		return nil, fmt.Errorf("invalid action call format: %s", token.Value)
+func (s *Script) buildCall(node *CallNode) *Action {
+	if node.Name == "" {
+		return newInternalAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+			return s.evaluateCall(node)
+		})
 	}
 
-	actionName := match[1]
-	argsString := match[2]
+	var action *Action
+	if actionFound := s.CurrentBlock.Memory.GetAction(node.Name); actionFound != nil {
+		action = CloneAction(actionFound)
+	} else {
+		action = NewAction(nil, nil)
+	}
+	action.Name = node.Name
 
-	actionFound := s.CurrentBlock.Memory.GetAction(actionName)
-	if actionFound == nil {
-		return nil, fmt.Errorf("undefined action: %s", actionName)
+	args := make([]*Action, len(node.Arguments))
+	names := make([]string, len(node.Arguments))
+	for i, argument := range node.Arguments {
+		args[i] = s.expressionAction(argument.Value)
+		names[i] = argument.Name
 	}
-	action := CloneAction(actionFound)
+	action.SetNamedArguments(args, names)
 
-	var parsedArgs []*Action
-	rawArgs := splitTopLevelArgs(argsString)
+	return action
+}
 
-	for _, arg := range rawArgs {
-		arg = strings.TrimSpace(arg)
-		if arg == "" {
-			continue
-		}
+func (s *Script) expressionAction(expr Expression) *Action {
+	if call, ok := expr.(*CallNode); ok {
+		return newInternalAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+			return s.evaluateCall(call)
+		})
+	}
 
-		parsedArg, err := s.parseExpression(arg)
+	return newInternalAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+		value, err := s.evaluate(expr)
 		if err != nil {
 			return nil, err
 		}
-
-		parsedArgs = append(parsedArgs, parsedArg)
-	}
-
-	action.SetArguments(parsedArgs)
-
-	return action, nil
+		return []*Variable{value}, nil
+	})
 }
 
-func (s *Script) parseAssignmentToken(token *Token) (*Action, error) {
-	match := AssignmentPattern.FindStringSubmatch(token.Value)
-	if len(match) != 3 {
-		return nil, fmt.Errorf("invalid assignment format: %s", token.Value)
-	}
+// newInternalAction builds an action the tree engine runs for its own
+// statements and expressions, which interceptors do not see.
+func newInternalAction(executeFunc func(s *Script, args ...*Variable) ([]*Variable, error)) *Action {
+	action := NewAction(executeFunc, nil)
+	action.internal = true
+	return action
+}
 
-	varName := match[1]
-	exprString := match[2]
+func (s *Script) buildAssignment(node *AssignmentNode) *Action {
+	varName := node.Name
 
 	assignmentAction := func(s *Script, args ...*Variable) ([]*Variable, error) {
-		parseExprAction, err := s.parseExpression(exprString)
+		exprVar, err := s.evaluate(node.Value)
 		if err != nil {
 			return nil, err
 		}
 
-		parsedExpr, err := parseExprAction.Execute(s)
+		variable, err := assignVariable(s.CurrentBlock.Memory, varName, exprVar)
 		if err != nil {
 			return nil, err
 		}
-
-		if len(parsedExpr) != 1 {
-			return nil, fmt.Errorf("invalid assignment expression: %s", exprString)
-		}
-
-		exprVar := parsedExpr[0]
-		variable := s.CurrentBlock.Memory.SetVariable(varName, exprVar.Value, exprVar.Type)
-
 		return []*Variable{variable}, nil
 	}
 
-	return NewAction(assignmentAction, nil), nil
+	return newInternalAction(assignmentAction)
 }
 
-func (s *Script) parseDeclarationToken(token *Token) (*Action, error) {
-    match := DeclarationPattern.FindStringSubmatch(token.Value)
-    if len(match) != 3 {
-        return nil, fmt.Errorf("invalid declaration format: %s", token.Value)
-    }
-    varName := match[1]
-    exprString := match[2]
-    
+func assignVariable(memory *MemoryMap, name string, value *Variable) (*Variable, error) {
+	if declaredType, ok := memory.GetVariableType(name); ok {
+		var err error
+		if value, err = value.Coerce(declaredType); err != nil {
+			return nil, fmt.Errorf("cannot assign to '%s': %v", name, err)
+		}
+	}
+	return memory.SetVariable(name, value.Value, value.Type), nil
+}
+
+func (s *Script) buildDeclaration(node *DeclarationNode) *Action {
+    varName := node.Name
+
     declarationAction := func(s *Script, args ...*Variable) ([]*Variable, error) {
-		s.CurrentBlock.Memory.MakeVariable(varName, nil)
+		declareVariable(s.CurrentBlock.Memory, varName, node.TypeName != "", node.Type)
 
-        parseExprAction, err := s.parseExpression(exprString)
+        value, err := s.evaluate(node.Value)
         if err != nil {
             return nil, err
         }
-        parsedExpr, err := parseExprAction.Execute(s)
+        variable, err := defineVariable(s.CurrentBlock.Memory, varName, node.Type, value)
         if err != nil {
             return nil, err
         }
-        if len(parsedExpr) != 1 {
-            return nil, fmt.Errorf("invalid declaration expression: %s", exprString)
-        }
-        exprVar := parsedExpr[0]
-        variable := s.CurrentBlock.Memory.SetVariable(varName, exprVar.Value, exprVar.Type)
         return []*Variable{variable}, nil
     }
 
-    return NewAction(declarationAction, nil), nil
+    return newInternalAction(declarationAction)
 }
 
-func (s *Script) parseAugmentedAssignmentToken(token *Token) (*Action, error) {
-	match := AugmentedAssignementPattern.FindStringSubmatch(token.Value)
-	if len(match) != 4 {
-		return nil, fmt.Errorf("invalid augmented assignment format: %s", token.Value)
+// declareVariable creates the variable before its value is evaluated,
+// so the value expression already sees the new, still nil, variable.
+func declareVariable(memory *MemoryMap, name string, typed bool, variableType VariableType) {
+	memory.MakeVariable(name, nil)
+	if typed {
+		memory.DeclareVariableType(name, variableType)
+	} else {
+		delete(memory.Types, name)
 	}
-	varName := match[1]
-	augmentedOperator := match[2]
-	exprString := match[3]
-	
+}
+
+func defineVariable(memory *MemoryMap, name string, variableType VariableType, value *Variable) (*Variable, error) {
+	value, err := value.Coerce(variableType)
+	if err != nil {
+		return nil, fmt.Errorf("cannot declare '%s': %v", name, err)
+	}
+	return memory.SetVariable(name, value.Value, value.Type), nil
+}
+
+func (s *Script) buildAugmentedAssignment(node *AugmentedAssignmentNode) *Action {
+	varName := node.Name
+
 	assignmentAction := func(s *Script, args ...*Variable) ([]*Variable, error) {
 		variable := s.CurrentBlock.Memory.GetVariable(varName)
 		if variable == nil {
 			return nil, fmt.Errorf("undefined variable: %s", varName)
 		}
 
-		parseExprAction, err := s.parseExpression(exprString)
+		exprVar, err := s.evaluate(node.Value)
 		if err != nil {
 			return nil, err
 		}
 
-		parsedExpr, err := parseExprAction.Execute(s)
-		if err != nil {
+		declaredType, ok := s.CurrentBlock.Memory.GetVariableType(varName)
+		if !ok {
+			declaredType = AnyType
+		}
+		if err := augmentVariable(variable, varName, node.Operator, exprVar, declaredType); err != nil {
 			return nil, err
 		}
 
-		if len(parsedExpr) != 1 {
-			return nil, fmt.Errorf("invalid assignment expression: %s", exprString)
-		}
+		return []*Variable{variable}, nil
+	}
 
-		var (
-			result       interface{}
-			castA, castB float64
-			castErr      error
-		)
+	return newInternalAction(assignmentAction)
+}
 
-		exprVar := parsedExpr[0]
-		variable, exprVar, castErr = ensureArithmeticOperands(variable, exprVar)
-		if castErr != nil {
-			return nil, fmt.Errorf("type mismatch in augmented assignment: %v", castErr)
-		}
+func augmentVariable(variable *Variable, name, augmentedOperator string, exprVar *Variable, declaredType VariableType) error {
+	var (
+		result       interface{}
+		castA, castB float64
+		castErr      error
+	)
+
+	operand := variable
+	operand, exprVar, castErr = ensureArithmeticOperands(operand, exprVar)
+	if castErr != nil {
+		return fmt.Errorf("type mismatch in augmented assignment: %v", castErr)
+	}
 
-		castA, castErr = variable.toFloat()
-		if castErr != nil {
-			return nil, fmt.Errorf("failed to cast %s to float: %v", variable.Type.String(), castErr)
-		}
+	castA, castErr = operand.toFloat()
+	if castErr != nil {
+		return fmt.Errorf("failed to cast %s to float: %v", operand.Type.String(), castErr)
+	}
 
-		castB, castErr = exprVar.toFloat()
-		if castErr != nil {
-			return nil, fmt.Errorf("failed to cast %s to float: %v", exprVar.Type.String(), castErr)
-		}
+	castB, castErr = exprVar.toFloat()
+	if castErr != nil {
+		return fmt.Errorf("failed to cast %s to float: %v", exprVar.Type.String(), castErr)
+	}
 
-		switch augmentedOperator {
-		case AugmentedAdditionString:
-			result = castA + castB
-		case AugmentedSubtractionString:
-			result = castA - castB
-		case AugmentedMultiplicationString:
-			result = castA * castB
-		case AugmentedDivisionString:
-			if castB == 0 {
-				return nil, fmt.Errorf("division by zero")
-			}
-			result = castA / castB
-		case AugmentedModulusString:
-			result = math.Mod(castA, castB)
-		case AugmentedExponentString:
-			result = math.Pow(castA, castB)
-		default:
-			return nil, fmt.Errorf("unsupported operator for augmented assignment: %s", augmentedOperator)
+	switch augmentedOperator {
+	case AugmentedAdditionString:
+		result = castA + castB
+	case AugmentedSubtractionString:
+		result = castA - castB
+	case AugmentedMultiplicationString:
+		result = castA * castB
+	case AugmentedDivisionString:
+		if castB == 0 {
+			return fmt.Errorf("division by zero")
 		}
+		result = castA / castB
+	case AugmentedModulusString:
+		result = math.Mod(castA, castB)
+	case AugmentedExponentString:
+		result = math.Pow(castA, castB)
+	default:
+		return fmt.Errorf("unsupported operator for augmented assignment: %s", augmentedOperator)
+	}
 
-		variable.Value = result
-		variable.Type = FloatType
-
-		return []*Variable{variable}, nil
+	resultVar, castErr := NewVariable(result, FloatType).Coerce(declaredType)
+	if castErr != nil {
+		return fmt.Errorf("cannot assign to '%s': %v", name, castErr)
 	}
 
-	return NewAction(assignmentAction, nil), nil
+	variable.Value = resultVar.Value
+	variable.Type = resultVar.Type
+	return nil
 }
 
-func (s *Script) parseContent() (*Block, error) {
-    lines := strings.Split(s.Content, string(NewLineSymbol))
-    blockStack := []*Block{}
-    currentBlock := s.MainBlock // Start with the main block
+func (s *Script) parseContent() (*BlockNode, error) {
+    program, diagnostics := s.Parse()
+    if err := diagnostics.Err(); err != nil {
+        return nil, err
+    }
+    return program, nil
+}
 
-    for i := 0; i < len(lines); i++ {
-        line := lines[i]
-        token, err := tokenizeLine(line)
-        if err != nil {
-            return nil, fmt.Errorf("error analyzing line %d: %v", i+1, err)
-        }
-        switch token.Type {
-        case ActionToken:
-            action, err := s.parseActionToken(token)
-            if err != nil {
-                return nil, fmt.Errorf("error parsing action on line %d: %v", i+1, err)
-            }
-            currentBlock.Actions = append(currentBlock.Actions, action)
-        case AssignmentToken:
-            action, err := s.parseAssignmentToken(token)
-            if err != nil {
-                return nil, fmt.Errorf("error parsing assignment on line %d: %v", i+1, err)
-            }
-            currentBlock.Actions = append(currentBlock.Actions, action)
-        case DeclarationToken:
-            action, err := s.parseDeclarationToken(token)
-            if err != nil {
-                return nil, fmt.Errorf("error parsing declaration on line %d: %v", i+1, err)
-            }
-            currentBlock.Actions = append(currentBlock.Actions, action)
-        case AugmentedAssignmentToken:
-            action, err := s.parseAugmentedAssignmentToken(token)
-            if err != nil {
-                return nil, fmt.Errorf("error parsing augmented assignment on line %d: %v", i+1, err)
-            }
-            currentBlock.Actions = append(currentBlock.Actions, action)
-        case CodeBlockOpenToken:
-            newBlock := NewBlock(currentBlock.Memory)
-            blockStack = append(blockStack, currentBlock)
-            currentBlock = newBlock
-        case CodeBlockCloseToken:
-            if len(blockStack) == 0 {
-                return nil, fmt.Errorf("unmatched closing brace on line %d", i+1)
-            }
-            completedBlock := currentBlock
-            currentBlock = blockStack[len(blockStack)-1]
-            blockStack = blockStack[:len(blockStack)-1]
-            if len(currentBlock.Actions) > 0 {
-                lastAction := currentBlock.Actions[len(currentBlock.Actions)-1]
-                lastAction.Block = completedBlock
-            } else {
-                return nil, fmt.Errorf("code block without an action on line %d", i+1)
-            }
-        }
+// Parse parses the script's Content, recovering from syntax errors at
+// statement boundaries so that all of them are reported. The program
+// returned alongside errors only holds the statements that parsed.
+func (s *Script) Parse() (*BlockNode, Diagnostics) {
+    tokens, diagnostics := NewLexer(s.Path, s.Content).TokenizeAll()
+    program, parseDiagnostics := s.parseProgram(tokens)
+
+    diagnostics = append(diagnostics, parseDiagnostics...)
+    diagnostics.Sort()
+    return program, diagnostics.compact()
+}
+
+func (s *Script) buildBlock(node *BlockNode, block *Block) *Block {
+    for _, statement := range node.Statements {
+        action := s.buildStatement(statement, block)
+        action.Statement = statement
+        block.Actions = append(block.Actions, action)
     }
-    if len(blockStack) > 0 {
-        return nil, fmt.Errorf("unmatched opening brace")
+    return block
+}
+
+func (s *Script) buildStatement(statement Statement, block *Block) *Action {
+    switch node := statement.(type) {
+    case *AssignmentNode:
+        return s.buildAssignment(node)
+    case *DeclarationNode:
+        return s.buildDeclaration(node)
+    case *AugmentedAssignmentNode:
+        return s.buildAugmentedAssignment(node)
+    case *ImportNode:
+        return s.buildImport(node)
+    case *ActionDeclarationNode:
+        return s.buildActionDeclaration(node, block)
+    case *CallStatementNode:
+        action := s.buildCall(node.Call)
+        if node.Body != nil {
+            action.Block = s.buildBlock(node.Body, NewBlock(block.Memory))
+        }
+        return action
     }
-    return currentBlock, nil
+    return NewAction(nil, nil)
 }
 
 func (s *Script) runBlock(b *Block) error {
@@ -351,147 +280,250 @@ func (s *Script) runBlock(b *Block) error {
     s.CurrentBlock = b
 
     for _, action := range b.Actions {
-        if err := action.Validate(s); err != nil {
-            return err
+        if err := s.interrupted(); err != nil {
+            return s.statementError(action, err)
+        }
+        if err := s.step(); err != nil {
+            return s.statementError(action, err)
+        }
+        if s.Debugger != nil && action.Statement != nil {
+            if err := s.Debugger.statement(s, action.Statement); err != nil {
+                return err
+            }
+        }
+        if s.Coverage != nil && action.Statement != nil {
+            s.Coverage.statement(action.Statement.Position())
+        }
+        profiled := s.Profiler != nil && action.Statement != nil
+        if profiled {
+            s.Profiler.enterLine(action.Statement.Position())
+        }
+        err := s.runStatement(b, action)
+        if profiled {
+            s.Profiler.leave()
         }
-        result, err := action.Execute(s)
         if err != nil {
             return err
         }
-        var resultVar *Variable
-        if len(result) > 0 {
-            resultVar = result[0]
-            b.LastResult = resultVar
-        } else {
-            b.LastResult = nil
-        }
-        if action.Block != nil && resultVar != nil {
-            if resultBool, err := resultVar.toBool(); err == nil {
-				if resultBool {
-					if err := s.runBlock(action.Block); err != nil {
-						return err
-					}
-				}
-			} else {
-				return err
-			}
+        if s.returning {
+            break
         }
     }
 
-	fmt.Println("Exiting block")
-    s.CurrentBlock.Memory.Clear()
     s.CurrentBlock = previousBlock
 
     return nil
 }
 
-func normalizeContent(content string) (string, error) {
-	var result strings.Builder
-	inQuotes := false
-	escaped := false
-	lines := strings.Split(content, string(NewLineSymbol))
-	openCurlyCount := 0
-	openParenCount := 0
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if !inQuotes && (strings.HasPrefix(trimmedLine, string(CommentSymbol)) || trimmedLine == "") {
-			continue
+// runStatement runs one action of a block, and the code block that comes
+// with it when the action's result is true.
+func (s *Script) runStatement(b *Block, action *Action) error {
+    if err := action.Validate(s); err != nil {
+        return s.statementError(action, err)
+    }
+    result, err := action.Execute(s)
+    if err != nil {
+        return s.statementError(action, err)
+    }
+    var resultVar *Variable
+    if len(result) > 0 {
+        resultVar = result[0]
+        b.LastResult = resultVar
+    } else {
+        b.LastResult = nil
+    }
+    if action.Block == nil {
+        return nil
+    }
+    resultBool := false
+    if resultVar != nil {
+        if resultBool, err = resultVar.toBool(); err != nil {
+            return s.statementError(action, err)
+        }
+    }
+    if _, ok := action.Statement.(*CallStatementNode); ok && s.Coverage != nil {
+        s.Coverage.branch(action.Statement.Position(), resultBool)
+    }
+    if resultBool {
+        return s.runScope(action.Block, NewMemoryMap(b.Memory))
+    }
+    return nil
+}
+
+func (s *Script) runScope(b *Block, memory *MemoryMap) error {
+    previousMemory, previousResult := b.Memory, b.LastResult
+    b.Memory, b.LastResult = memory, nil
+
+    err := s.runBlock(b)
+
+    b.Memory, b.LastResult = previousMemory, previousResult
+    return err
+}
+
+func (s *Script) statementError(a *Action, err error) error {
+    if a.Statement == nil {
+        return err
+    }
+    return s.errorAt(a.Statement.Position(), err)
+}
+
+func (s *Script) buildParameters(nodes []*ParameterNode) []*Parameter {
+	parameters := make([]*Parameter, len(nodes))
+	for i, node := range nodes {
+		parameter := NewParameter(node.Name, node.Type)
+		parameter.Variadic = node.Variadic
+		if node.Default != nil {
+			parameter.Default = s.expressionAction(node.Default)
+			parameter.Optional = true
 		}
+		parameters[i] = parameter
+	}
+	return parameters
+}
 
-		for i := 0; i < len(line); i++ {
-			switch line[i] {
-			case EscapeSymbol:
-				if inQuotes && !escaped {
-					escaped = true
-					result.WriteByte(line[i])
-				} else {
-					result.WriteByte(line[i])
-					escaped = false
-				}
-			case StringSymbol:
-				result.WriteByte(line[i])
-				if !escaped {
-					inQuotes = !inQuotes
-				}
-			case CommentSymbol:
-				if inQuotes || escaped {
-					result.WriteByte(line[i])
-				}
-			case SpaceSymbol, TabSymbol, ReturnSymbol:
-				if inQuotes || escaped {
-					result.WriteByte(line[i])
-				}
-				escaped = false
-			case CodeBlockOpenSymbol:
-				if !inQuotes && !escaped {
-					openCurlyCount++
-					result.WriteByte(NewLineSymbol)
-					result.WriteByte(line[i])
-					result.WriteByte(NewLineSymbol)
-				} else {
-					result.WriteByte(line[i])
-				}
-				escaped = false
-			case CodeBlockCloseSymbol:
-				if !inQuotes && !escaped {
-					openCurlyCount--
-					result.WriteByte(NewLineSymbol)
-					result.WriteByte(line[i])
-					result.WriteByte(NewLineSymbol)
-				} else {
-					result.WriteByte(line[i])
-				}
-				escaped = false
-			case ParenOpenSymbol:
-				if !inQuotes && !escaped {
-					openParenCount++
-					result.WriteByte(line[i])
-				} else {
-					result.WriteByte(line[i])
-				}
-				escaped = false
-			case ParenCloseSymbol:
-				if !inQuotes && !escaped {
-					openParenCount--
-					result.WriteByte(line[i])
-				} else {
-					result.WriteByte(line[i])
+func (s *Script) buildActionDeclaration(node *ActionDeclarationNode, block *Block) *Action {
+	name := node.Name
+	signature := NewSignature(AnyType, s.buildParameters(node.Parameters)...)
+
+	declaration := NewAction(nil, ActionDeclarationValidator)
+	declaration.internal = true
+	if node.Body != nil {
+		declaration.Block = s.buildBlock(node.Body, NewBlock(block.Memory))
+	}
+	declaration.executeFunc = func(s *Script, args ...*Variable) ([]*Variable, error) {
+		memory := s.CurrentBlock.Memory
+		memory.Actions[name] = newUserAction(name, signature, declaration.Block, memory)
+		return nil, nil
+	}
+
+	return declaration
+}
+
+func ActionDeclarationValidator(s *Script, a *Action) error {
+	if a.Block == nil {
+		return fmt.Errorf("'action' declaration must have a code block")
+	}
+	return nil
+}
+
+func newUserAction(name string, signature *Signature, body *Block, closure *MemoryMap) *Action {
+	fixed := signature.FixedParameters()
+	variadic := signature.VariadicParameter()
+
+	userAction := func(s *Script, args ...*Variable) ([]*Variable, error) {
+		memory := NewMemoryMap(closure)
+		for i, parameter := range fixed {
+			var value *Variable
+			if i < len(args) && args[i] != nil {
+				value = args[i]
+			} else if parameter.Default != nil {
+				defaultValue, err := s.evaluateIn(memory, parameter.Default)
+				if err != nil {
+					return nil, err
 				}
-				escaped = false
-			default:
-				result.WriteByte(line[i])
-				escaped = false
+				value = defaultValue
+			} else {
+				return nil, fmt.Errorf("'%s' action is missing required argument(s): %s", name, parameter.Name)
+			}
+
+			if err := bindParameter(memory, name, parameter, value); err != nil {
+				return nil, err
+			}
+		}
+
+		if variadic != nil {
+			var rest []*Variable
+			if len(args) > len(fixed) {
+				rest = args[len(fixed):]
 			}
-			if line[i] == CommentSymbol && !inQuotes && !escaped {
-				break
+
+			values, err := collectVariadic(name, variadic, rest)
+			if err != nil {
+				return nil, err
 			}
+			memory.Variables[variadic.Name] = values
 		}
-		if result.Len() > 0 && result.String()[result.Len()-1] != NewLineSymbol {
-			result.WriteByte(NewLineSymbol)
+
+		if s.Debugger != nil {
+			s.Debugger.enter(name)
+			defer s.Debugger.leave()
 		}
+		err := s.enterCall()
+		defer s.leaveCall()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.runScope(body, memory); err != nil {
+			return nil, err
+		}
+
+		values := s.returnValues
+		s.returning, s.returnValues = false, nil
+		if len(values) == 0 {
+			values = []*Variable{NewVariable(nil, NilType)}
+		}
+
+		return values, nil
 	}
 
-	if inQuotes {
-		return "", fmt.Errorf("unclosed string literal")
+	action := NewAction(userAction, nil)
+	action.Name = name
+	action.Signature = signature
+	return action
+}
+
+func bindParameter(memory *MemoryMap, actionName string, parameter *Parameter, value *Variable) error {
+	value, err := coerceParameter(actionName, parameter, value)
+	if err != nil {
+		return err
 	}
-	if openCurlyCount != 0 {
-		return "", fmt.Errorf("unbalanced curly braces")
+
+	memory.Variables[parameter.Name] = value
+	if parameter.Type != AnyType {
+		memory.DeclareVariableType(parameter.Name, parameter.Type)
 	}
-	if openParenCount != 0 {
-		return "", fmt.Errorf("unbalanced parentheses")
+	return nil
+}
+
+// coerceParameter returns a copy of value converted to the parameter type,
+// so the action body never aliases the caller's variable.
+func coerceParameter(actionName string, parameter *Parameter, value *Variable) (*Variable, error) {
+	value, err := value.Coerce(parameter.Type)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' action parameter '%s': %v", actionName, parameter.Name, err)
 	}
+	return NewVariable(value.Value, value.Type), nil
+}
 
-	cleaned := strings.TrimSpace(result.String())
-	lines = strings.Split(cleaned, string(NewLineSymbol))
-	cleanedResult := strings.Builder{}
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if trimmedLine != "" {
-			cleanedResult.WriteString(trimmedLine)
-			cleanedResult.WriteByte(NewLineSymbol)
+func collectVariadic(actionName string, parameter *Parameter, rest []*Variable) (*Variable, error) {
+	elements := make([]*Variable, len(rest))
+	for i, value := range rest {
+		value, err := coerceParameter(actionName, parameter, value)
+		if err != nil {
+			return nil, err
 		}
+		elements[i] = value
 	}
+	return NewVariable(elements, ArrayType), nil
+}
 
-	return strings.TrimSpace(cleanedResult.String()), nil
+func (s *Script) buildLambda(node *LambdaNode) *Action {
+	memory := s.CurrentBlock.Memory
+	body := s.buildBlock(node.Body, NewBlock(memory))
+	return newUserAction(LambdaString, NewSignature(AnyType, s.buildParameters(node.Parameters)...), body, memory)
 }
+
+func (s *Script) evaluateIn(memory *MemoryMap, expression *Action) (*Variable, error) {
+	previousBlock := s.CurrentBlock
+	s.CurrentBlock = &Block{Memory: memory}
+	values, err := expression.Execute(s)
+	s.CurrentBlock = previousBlock
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != 1 {
+		return nil, fmt.Errorf("expression returned %d values", len(values))
+	}
+	return values[0], nil
+}
\ No newline at end of file
@@ -0,0 +1,36 @@
+// interceptor.go
+package taskwrappr
+
+// Invocation runs the rest of an interceptor chain, ending with the action
+// itself, on the given arguments.
+type Invocation func(args []*Variable) ([]*Variable, error)
+
+// Interceptor wraps every action invocation of a script: builtins, host
+// actions and actions declared in the script alike. It gets the name of the
+// action and its arguments once they are bound to the signature, and calls
+// next to go on, possibly with different arguments. Returning without
+// calling next skips the action.
+type Interceptor func(s *Script, name string, args []*Variable, next Invocation) ([]*Variable, error)
+
+// Use adds an interceptor to the script. Interceptors run in the order they
+// were added, the first one outermost. Calls to pure actions are not folded
+// while the script has interceptors, so every call is seen when it runs.
+func (s *Script) Use(interceptor Interceptor) {
+	s.interceptors = append(s.interceptors, interceptor)
+}
+
+// intercept runs an action called as name through the script's
+// interceptors. The internal actions the tree engine builds for its own
+// statements never get here, they are not calls made by the script.
+func (s *Script) intercept(a *Action, name string, args []*Variable) ([]*Variable, error) {
+	var next func(index int, args []*Variable) ([]*Variable, error)
+	next = func(index int, args []*Variable) ([]*Variable, error) {
+		if index == len(s.interceptors) {
+			return a.executeFunc(s, args...)
+		}
+		return s.interceptors[index](s, name, args, func(args []*Variable) ([]*Variable, error) {
+			return next(index+1, args)
+		})
+	}
+	return next(0, args)
+}
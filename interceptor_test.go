@@ -0,0 +1,81 @@
+// interceptor_test.go
+package taskwrappr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const interceptedSource = `greet := action(name) {
+	print("hello", name)
+}
+greet(string(len("abc")))
+double(2)
+print(double(triple(1)))
+wait(1)
+`
+
+// hostMultiplier is an action a host registers without naming it.
+func hostMultiplier(factor int) *Action {
+	return NewAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+		return []*Variable{NewVariable(args[0].Value.(int)*factor, IntegerType)}, nil
+	}, nil).WithSignature(NewSignature(IntegerType, NewParameter("value", IntegerType)))
+}
+
+func TestInterceptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intercepted.tw")
+	if err := os.WriteFile(path, []byte(interceptedSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Actions["double"] = hostMultiplier(2)
+		memory.Variables["triple"] = NewVariable(hostMultiplier(3), ActionType)
+		s, err := NewScript(path, memory)
+		if err != nil {
+			t.Fatalf("NewScript returned an error: %s", err)
+		}
+		s.Engine = engine
+
+		var calls []string
+		s.Use(func(s *Script, name string, args []*Variable, next Invocation) ([]*Variable, error) {
+			var values []string
+			for _, arg := range args {
+				values = append(values, formatValue(arg))
+			}
+			calls = append(calls, fmt.Sprintf("%s(%s)", name, strings.Join(values, ", ")))
+			return next(args)
+		})
+		s.Use(func(s *Script, name string, args []*Variable, next Invocation) ([]*Variable, error) {
+			switch name {
+			case "wait":
+				return nil, errors.New("wait is not allowed")
+			case "print":
+				args[0] = NewVariable("-", StringType)
+			}
+			return next(args)
+		})
+
+		var output strings.Builder
+		s.Stdout = &output
+
+		runErr := s.Run()
+		if runErr == nil || !strings.Contains(runErr.Error(), "wait is not allowed") {
+			t.Errorf("expected wait to be denied, got %v", runErr)
+		}
+		if output.String() != "hello-3\n6\n" {
+			t.Errorf("expected the rewritten greeting, got %q", output.String())
+		}
+		expected := []string{`len("abc")`, `string(3)`, `greet("3")`, `print(" ", "\n", "hello", "3")`,
+			`double(2)`, `triple(1)`, `double(3)`, `print(" ", "\n", 6)`, `wait(1)`}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("expected calls %v, got %v", expected, calls)
+		}
+	})
+}
@@ -1,11 +1,6 @@
 // interpreter.go
 package taskwrappr
 
-import (
-	"fmt"
-	"regexp"
-)
-
 type TokenType    int
 
 const (
@@ -37,6 +32,7 @@ const (
 	ExponentSymbol       = '^'
 	SelfReferenceSymbol  = '~'
 	DeclarationSymbol	 = ':'
+	StatementSeparatorSymbol = ';'
 )
 
 const (
@@ -60,6 +56,16 @@ const (
 	ParenCloseToken
 	DelimiterToken
 	DecimalToken
+	IdentifierToken
+	ColonToken
+	BracketOpenToken
+	BracketCloseToken
+	ArrowToken
+	EllipsisToken
+	SeparatorToken
+	NewLineToken
+	CommentToken
+	EOFToken
 	LogicalAndToken
     LogicalOrToken
     LogicalNotToken
@@ -77,6 +83,17 @@ const (
 	TrueString                    = "true"
 	FalseString                   = "false"
 	NilString                     = "nil"
+	ActionString                  = "action"
+	MapString                     = "map"
+	ReturnString                  = "return"
+	DeleteString                  = "delete"
+	IfString                      = "if"
+	ElseIfString                  = "elseIf"
+	ElseString                    = "else"
+	LambdaString                  = "lambda"
+	ImportString                  = "import"
+	AliasString                   = "as"
+	ModuleExtension               = ".tw"
 	LogicalAndString              = "&&"
 	LogicalOrString               = "||"
 	LogicalNotString              = "!"
@@ -94,33 +111,46 @@ const (
 	AugmentedDivisionString       = string(DivisionSymbol) + string(AssignmentSymbol)
 	AugmentedModulusString        = string(ModulusSymbol) + string(AssignmentSymbol)
 	AugmentedExponentString       = string(ExponentSymbol) + string(AssignmentSymbol)
+	LambdaArrowString             = string(AssignmentSymbol) + GreaterThanString
+	VariadicString                = string(DecimalSymbol) + string(DecimalSymbol) + string(DecimalSymbol)
 )
 
-var (
-	ActionCallPattern             = regexp.MustCompile(fmt.Sprintf(`\w+\%c[^%c]*\%c`, ParenOpenSymbol, ParenCloseSymbol, ParenCloseSymbol))
-	ActionArgumentsPattern        = regexp.MustCompile(fmt.Sprintf(`^(\w+)\%c(.*)\%c$`, ParenOpenSymbol, ParenCloseSymbol))
-	AssignmentPattern             = regexp.MustCompile(fmt.Sprintf(`^\s*([a-zA-Z_]\w*)\s*%c\s*(.+)\s*$`, AssignmentSymbol))
-	DeclarationPattern 		      = regexp.MustCompile(fmt.Sprintf(`^\s*([a-zA-Z_]\w*)\s*%s\s*(.+)\s*$`, DeclarationString))
-	VariableNamePattern           = regexp.MustCompile(fmt.Sprintf(`^[a-zA-Z_][a-zA-Z0-9_]*[^%c]$`, ParenOpenSymbol))
-	IntegerPattern                = regexp.MustCompile(`^-?\d+$`)
-	FloatPattern                  = regexp.MustCompile(`^-?\d*\.\d+$`)
-	BooleanPattern                = regexp.MustCompile(fmt.Sprintf(`^(%s|%s)$`, TrueString, FalseString))
-	StringPattern                 = regexp.MustCompile(fmt.Sprintf(`^%c.*%c$`, StringSymbol, StringSymbol))
-	AugmentedAssignementPattern   = regexp.MustCompile(fmt.Sprintf(
-		`^\s*(\w+)\s*([\%c\%c\%c\%c\%c\%c]%c)\s*(.*)\s*$`,
-		AdditionSymbol, SubtractionSymbol, MultiplicationSymbol, DivisionSymbol, ModulusSymbol, ExponentSymbol, AssignmentSymbol,
-	))
-	LogicalOperatorsPattern       = regexp.MustCompile(fmt.Sprintf(
-		`^(%s|%s|%s|%s|%s|%s|%s|%s|%s|%s)$`,
-		EqualityString, InequalityString, LessThanString, LessThanOrEqualString, GreaterThanString, GreaterThanOrEqualString, LogicalAndString, LogicalOrString, LogicalNotString, LogicalXorString,
-	))
+type Associativity int
+
+const (
+	LeftAssociative Associativity = iota
+	RightAssociative
 )
 
-var Operators = string([]rune{
-	AdditionSymbol,
-	SubtractionSymbol,
-	MultiplicationSymbol,
-	DivisionSymbol,
-	ModulusSymbol,
-	ExponentSymbol,
-})
\ No newline at end of file
+type OperatorInfo struct {
+	Precedence    int
+	Associativity Associativity
+}
+
+// OperatorTable is the single source of binding power for the binary
+// operators, a higher precedence binds tighter. Prefix operators (unary
+// minus and logical not) bind at PrefixPrecedence and postfix operators
+// (calls, indexing and field access) at PostfixPrecedence, so -2^2 is
+// -(2^2) and -f(x)[0] negates the indexed result.
+var OperatorTable = map[TokenType]OperatorInfo{
+	LogicalOrToken:          {1, LeftAssociative},
+	LogicalXorToken:         {2, LeftAssociative},
+	LogicalAndToken:         {3, LeftAssociative},
+	EqualityToken:           {4, LeftAssociative},
+	InequalityToken:         {4, LeftAssociative},
+	LessThanToken:           {5, LeftAssociative},
+	LessThanOrEqualToken:    {5, LeftAssociative},
+	GreaterThanToken:        {5, LeftAssociative},
+	GreaterThanOrEqualToken: {5, LeftAssociative},
+	OperatorAddToken:        {6, LeftAssociative},
+	OperatorSubtractToken:   {6, LeftAssociative},
+	OperatorMultiplyToken:   {7, LeftAssociative},
+	OperatorDivideToken:     {7, LeftAssociative},
+	OperatorModuloToken:     {7, LeftAssociative},
+	OperatorExponentToken:   {9, RightAssociative},
+}
+
+const (
+	PrefixPrecedence  = 8
+	PostfixPrecedence = 10
+)
\ No newline at end of file
@@ -0,0 +1,243 @@
+// lexer.go
+package taskwrappr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type Lexer struct {
+	file   string
+	source []rune
+	offset int
+	line   int
+	column int
+	tokens []*Token
+}
+
+func NewLexer(file, source string) *Lexer {
+	return &Lexer{
+		file:   file,
+		source: []rune(source),
+		line:   1,
+		column: 1,
+	}
+}
+
+func (l *Lexer) Tokenize() ([]*Token, error) {
+	tokens, diagnostics := l.TokenizeAll()
+	if err := diagnostics.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// TokenizeAll scans past invalid input and reports every problem it finds
+// instead of stopping at the first one.
+func (l *Lexer) TokenizeAll() ([]*Token, Diagnostics) {
+	var diagnostics Diagnostics
+	for {
+		token, err := l.next()
+		if err != nil {
+			diagnostics.add(SeverityError, err)
+		}
+		if token == nil {
+			continue
+		}
+		l.tokens = append(l.tokens, token)
+		if token.Type == EOFToken {
+			return l.tokens, diagnostics
+		}
+	}
+}
+
+func (l *Lexer) position() Position {
+	return Position{File: l.file, Line: l.line, Column: l.column}
+}
+
+func (l *Lexer) peek(ahead int) rune {
+	if l.offset+ahead >= len(l.source) {
+		return 0
+	}
+	return l.source[l.offset+ahead]
+}
+
+func (l *Lexer) advance() rune {
+	r := l.source[l.offset]
+	l.offset++
+	if r == NewLineSymbol {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return r
+}
+
+func (l *Lexer) errorf(pos Position, format string, args ...interface{}) error {
+	return NewSourceError(string(l.source), pos, fmt.Sprintf(format, args...))
+}
+
+func (l *Lexer) next() (*Token, error) {
+	for l.offset < len(l.source) {
+		if r := l.peek(0); r == SpaceSymbol || r == TabSymbol || r == ReturnSymbol {
+			l.advance()
+			continue
+		}
+		break
+	}
+
+	pos := l.position()
+	if l.offset >= len(l.source) {
+		return &Token{Type: EOFToken, Pos: pos}, nil
+	}
+
+	r := l.peek(0)
+	switch {
+	case r == NewLineSymbol:
+		l.advance()
+		return &Token{Type: NewLineToken, Value: string(r), Pos: pos}, nil
+	case r == CommentSymbol:
+		start := l.offset
+		for l.offset < len(l.source) && l.peek(0) != NewLineSymbol {
+			l.advance()
+		}
+		value := strings.TrimRight(string(l.source[start:l.offset]), string(ReturnSymbol))
+		return &Token{Type: CommentToken, Value: value, Pos: pos}, nil
+	case r == StringSymbol:
+		return l.scanString(pos)
+	case unicode.IsDigit(r) || (r == DecimalSymbol && unicode.IsDigit(l.peek(1)) && !l.followsOperand()):
+		return l.scanNumber(pos), nil
+	case unicode.IsLetter(r) || r == '_':
+		return l.scanIdentifier(pos), nil
+	}
+
+	return l.scanSymbol(pos)
+}
+
+func (l *Lexer) followsOperand() bool {
+	if len(l.tokens) == 0 {
+		return false
+	}
+	switch l.tokens[len(l.tokens)-1].Type {
+	case IdentifierToken, LiteralToken, ParenCloseToken, BracketCloseToken:
+		return true
+	}
+	return false
+}
+
+// scanString stops before the end of the line when the literal is left
+// unclosed and still returns it, closed, so parsing can go on.
+func (l *Lexer) scanString(pos Position) (*Token, error) {
+	start := l.offset
+	l.advance()
+
+	for l.offset < len(l.source) && l.peek(0) != NewLineSymbol {
+		switch l.advance() {
+		case EscapeSymbol:
+			if l.offset < len(l.source) && l.peek(0) != NewLineSymbol {
+				l.advance()
+			}
+		case StringSymbol:
+			return &Token{Type: LiteralToken, Value: string(l.source[start:l.offset]), Pos: pos}, nil
+		}
+	}
+
+	value := strings.TrimRight(string(l.source[start:l.offset]), string(ReturnSymbol)) + string(StringSymbol)
+	return &Token{Type: LiteralToken, Value: value, Pos: pos}, l.errorf(pos, "unclosed string literal")
+}
+
+func (l *Lexer) scanNumber(pos Position) *Token {
+	start := l.offset
+	for unicode.IsDigit(l.peek(0)) {
+		l.advance()
+	}
+	if l.peek(0) == DecimalSymbol && unicode.IsDigit(l.peek(1)) {
+		l.advance()
+		for unicode.IsDigit(l.peek(0)) {
+			l.advance()
+		}
+	}
+	return &Token{Type: LiteralToken, Value: string(l.source[start:l.offset]), Pos: pos}
+}
+
+func (l *Lexer) scanIdentifier(pos Position) *Token {
+	start := l.offset
+	for r := l.peek(0); unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'; r = l.peek(0) {
+		l.advance()
+	}
+
+	value := string(l.source[start:l.offset])
+	if value == TrueString || value == FalseString {
+		return &Token{Type: LiteralToken, Value: value, Pos: pos}
+	}
+	return &Token{Type: IdentifierToken, Value: value, Pos: pos}
+}
+
+var symbolTokens = []struct {
+	value     string
+	tokenType TokenType
+}{
+	{VariadicString, EllipsisToken},
+	{DeclarationString, DeclarationToken},
+	{LambdaArrowString, ArrowToken},
+	{EqualityString, EqualityToken},
+	{InequalityString, InequalityToken},
+	{LessThanOrEqualString, LessThanOrEqualToken},
+	{GreaterThanOrEqualString, GreaterThanOrEqualToken},
+	{LogicalAndString, LogicalAndToken},
+	{LogicalOrString, LogicalOrToken},
+	{LogicalXorString, LogicalXorToken},
+	{AugmentedAdditionString, AugmentedAssignmentToken},
+	{AugmentedSubtractionString, AugmentedAssignmentToken},
+	{AugmentedMultiplicationString, AugmentedAssignmentToken},
+	{AugmentedDivisionString, AugmentedAssignmentToken},
+	{AugmentedModulusString, AugmentedAssignmentToken},
+	{AugmentedExponentString, AugmentedAssignmentToken},
+	{string(AssignmentSymbol), AssignmentToken},
+	{string(DeclarationSymbol), ColonToken},
+	{LessThanString, LessThanToken},
+	{GreaterThanString, GreaterThanToken},
+	{LogicalNotString, LogicalNotToken},
+	{string(AdditionSymbol), OperatorAddToken},
+	{string(SubtractionSymbol), OperatorSubtractToken},
+	{string(MultiplicationSymbol), OperatorMultiplyToken},
+	{string(DivisionSymbol), OperatorDivideToken},
+	{string(ModulusSymbol), OperatorModuloToken},
+	{string(ExponentSymbol), OperatorExponentToken},
+	{string(ParenOpenSymbol), ParenOpenToken},
+	{string(ParenCloseSymbol), ParenCloseToken},
+	{string(BracketOpenSymbol), BracketOpenToken},
+	{string(BracketCloseSymbol), BracketCloseToken},
+	{string(CodeBlockOpenSymbol), CodeBlockOpenToken},
+	{string(CodeBlockCloseSymbol), CodeBlockCloseToken},
+	{string(DelimiterSymbol), DelimiterToken},
+	{string(DecimalSymbol), DecimalToken},
+	{string(StatementSeparatorSymbol), SeparatorToken},
+}
+
+func (l *Lexer) scanSymbol(pos Position) (*Token, error) {
+	rest := l.source[l.offset:]
+	for _, symbol := range symbolTokens {
+		length := len([]rune(symbol.value))
+		if length > len(rest) || string(rest[:length]) != symbol.value {
+			continue
+		}
+		for i := 0; i < length; i++ {
+			l.advance()
+		}
+		return &Token{Type: symbol.tokenType, Value: symbol.value, Pos: pos}, nil
+	}
+
+	return nil, l.errorf(pos, "unexpected character: %q", l.advance())
+}
+
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,89 @@
+// lexer_test.go
+package taskwrappr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLexerPositions(t *testing.T) {
+	tokens, err := NewLexer("test.tw", "x := 1\n  print(\"a b\", x) # done").Tokenize()
+	if err != nil {
+		t.Fatalf("Tokenize returned an error: %s", err)
+	}
+
+	expected := []struct {
+		tokenType TokenType
+		value     string
+		line      int
+		column    int
+	}{
+		{IdentifierToken, "x", 1, 1},
+		{DeclarationToken, ":=", 1, 3},
+		{LiteralToken, "1", 1, 6},
+		{NewLineToken, "\n", 1, 7},
+		{IdentifierToken, "print", 2, 3},
+		{ParenOpenToken, "(", 2, 8},
+		{LiteralToken, "\"a b\"", 2, 9},
+		{DelimiterToken, ",", 2, 14},
+		{IdentifierToken, "x", 2, 16},
+		{ParenCloseToken, ")", 2, 17},
+		{CommentToken, "# done", 2, 19},
+		{EOFToken, "", 2, 25},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, want := range expected {
+		token := tokens[i]
+		if token.Type != want.tokenType || token.Value != want.value || token.Pos.Line != want.line || token.Pos.Column != want.column {
+			t.Errorf("token %d: expected %v %q at %d:%d, got %v %q at %s", i, want.tokenType, want.value, want.line, want.column, token.Type, token.Value, token.Pos)
+		}
+	}
+}
+
+func TestErrorSnippet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.tw")
+	content := "x := 1\n\nprint(x + missing)\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScript(path, GetBuiltIn())
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+
+	err = s.Run()
+	if err == nil {
+		t.Fatalf("run should have failed on the undefined variable")
+	}
+	expected := path + ":3:11: undefined variable: missing\n 3 | print(x + missing)\n   |           ^"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error to contain:\n%s\ngot:\n%s", expected, err)
+	}
+}
+
+func TestTokenizeAllRecovers(t *testing.T) {
+	tokens, diagnostics := NewLexer("test.tw", "x := \"open\ny := 1 @ 2\n").TokenizeAll()
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d:\n%s", len(diagnostics), diagnostics)
+	}
+	if diagnostics[0].Pos.Line != 1 || diagnostics[0].Message != "unclosed string literal" {
+		t.Errorf("expected an unclosed string on line 1, got %q at %s", diagnostics[0].Message, diagnostics[0].Pos)
+	}
+	if diagnostics[1].Pos.Line != 2 || diagnostics[1].Pos.Column != 8 {
+		t.Errorf("expected an unexpected character at 2:8, got %q at %s", diagnostics[1].Message, diagnostics[1].Pos)
+	}
+
+	if tokens[2].Type != LiteralToken || tokens[2].Value != "\"open\"" || tokens[3].Type != NewLineToken {
+		t.Errorf("expected the unclosed string to end at the line break, got %v %q", tokens[2].Type, tokens[2].Value)
+	}
+	if last := tokens[len(tokens)-1]; last.Type != EOFToken {
+		t.Errorf("expected tokenizing to reach the end of the source, got %v", last.Type)
+	}
+}
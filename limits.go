@@ -0,0 +1,152 @@
+// limits.go
+package taskwrappr
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limits bound the resources a script may use, so scripts that are not
+// trusted can be run. A zero field means no limit.
+type Limits struct {
+	Steps      int           // statements run and actions called
+	CallDepth  int           // nested calls of actions declared by scripts, at most 10000
+	StringSize int           // bytes in a string
+	ArraySize  int           // elements of an array or entries of a map
+	Duration   time.Duration // wall-clock time of a run
+}
+
+// Limit names one of the fields of Limits.
+type Limit int
+
+const (
+	StepLimit Limit = iota
+	CallDepthLimit
+	StringSizeLimit
+	ArraySizeLimit
+	DurationLimit
+)
+
+func (l Limit) String() string {
+	switch l {
+	case StepLimit:
+		return "step"
+	case CallDepthLimit:
+		return "call depth"
+	case StringSizeLimit:
+		return "string size"
+	case ArraySizeLimit:
+		return "array size"
+	case DurationLimit:
+		return "duration"
+	default:
+		return "invalid"
+	}
+}
+
+// LimitError aborts a script that went past one of its Limits.
+type LimitError struct {
+	Limit Limit
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == DurationLimit {
+		return fmt.Sprintf("%s limit of %s exceeded", e.Limit, time.Duration(e.Max))
+	}
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// usage is what a run used so far of what Limits bound. A script shares
+// it with the modules it imports.
+type usage struct {
+	steps int
+	depth int
+}
+
+// limitDuration bounds the context of the script by the duration limit
+// and returns the function that releases it.
+func (s *Script) limitDuration() func() {
+	if s.Limits == nil || s.Limits.Duration <= 0 {
+		return func() {}
+	}
+
+	previous := s.ctx
+	ctx, cancel := context.WithTimeoutCause(s.Context(), s.Limits.Duration, &LimitError{Limit: DurationLimit, Max: int64(s.Limits.Duration)})
+	s.ctx = ctx
+	return func() {
+		cancel()
+		s.ctx = previous
+	}
+}
+
+// step counts a statement or a call against the step limit.
+func (s *Script) step() error {
+	if s.Limits == nil || s.Limits.Steps <= 0 {
+		return nil
+	}
+	if s.usage == nil {
+		s.usage = &usage{}
+	}
+	s.usage.steps++
+	if s.usage.steps > s.Limits.Steps {
+		return &LimitError{Limit: StepLimit, Max: int64(s.Limits.Steps)}
+	}
+	return nil
+}
+
+// enterCall counts a call of an action declared by the script against the
+// call depth limit, leaveCall ends it.
+func (s *Script) enterCall() error {
+	if s.usage == nil {
+		s.usage = &usage{}
+	}
+	s.usage.depth++
+	return s.checkDepth(s.usage.depth)
+}
+
+func (s *Script) leaveCall() {
+	s.usage.depth--
+}
+
+// maxCallDepth bounds the nesting of calls when Limits does not, so a
+// runaway recursion fails with a LimitError instead of overflowing the Go
+// stack.
+const maxCallDepth = 10000
+
+// checkDepth fails when a call would nest depth actions deep.
+func (s *Script) checkDepth(depth int) error {
+	max := maxCallDepth
+	if s.Limits != nil && s.Limits.CallDepth > 0 && s.Limits.CallDepth < max {
+		max = s.Limits.CallDepth
+	}
+	if depth <= max {
+		return nil
+	}
+	return &LimitError{Limit: CallDepthLimit, Max: int64(max)}
+}
+
+// checkSize fails when a value is a string or a collection larger than
+// the limits allow.
+func (s *Script) checkSize(v *Variable) error {
+	if s.Limits == nil || v == nil {
+		return nil
+	}
+
+	switch v.Type {
+	case StringType:
+		if max := s.Limits.StringSize; max > 0 && len(v.Value.(string)) > max {
+			return &LimitError{Limit: StringSizeLimit, Max: int64(max)}
+		}
+	case ArrayType:
+		if max := s.Limits.ArraySize; max > 0 && len(v.Value.([]*Variable)) > max {
+			return &LimitError{Limit: ArraySizeLimit, Max: int64(max)}
+		}
+	case MapType:
+		if max := s.Limits.ArraySize; max > 0 && len(v.Value.(map[string]*Variable)) > max {
+			return &LimitError{Limit: ArraySizeLimit, Max: int64(max)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// limits_test.go
+package taskwrappr
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const countdownSource = `countdown := action(n) {
+	if(n > 0) {
+		countdown(n - 1)
+	}
+}
+countdown(200)
+`
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		limits Limits
+		limit  Limit
+	}{
+		{"steps", countdownSource, Limits{Steps: 100}, StepLimit},
+		{"call depth", countdownSource, Limits{CallDepth: 50}, CallDepthLimit},
+		{"string size", "text := \"abcd\"\ntext = text + text\ntext = text + text\n", Limits{StringSize: 10}, StringSizeLimit},
+		{"array size", "values := array(1, 2, 3)\n", Limits{ArraySize: 2}, ArraySizeLimit},
+		{"array growth", "values := array(1, 2)\nset(values, 2, 3)\n", Limits{ArraySize: 2}, ArraySizeLimit},
+		{"map size", "entries := map(\"a\", 1, \"b\", 2)\n", Limits{ArraySize: 1}, ArraySizeLimit},
+		{"duration", "wait(5000)\n", Limits{Duration: 20 * time.Millisecond}, DurationLimit},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forEachEngine(t, func(t *testing.T, engine Engine) {
+				s, _ := NewScriptFromSource("limits.tw", test.source, GetBuiltIn())
+				s.Engine = engine
+				limits := test.limits
+				s.Limits = &limits
+
+				err := s.Run()
+				var limitErr *LimitError
+				if !errors.As(err, &limitErr) || limitErr.Limit != test.limit {
+					t.Fatalf("expected the %s limit to be hit, got %v", test.limit, err)
+				}
+				if errors.Is(err, ErrDeadlineExceeded) {
+					t.Errorf("expected a limit error only, got %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestLimitsNotHit(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		s, _ := NewScriptFromSource("limits.tw", countdownSource, GetBuiltIn())
+		s.Engine = engine
+		s.Limits = &Limits{Steps: 10000, CallDepth: 250, StringSize: 16, ArraySize: 4, Duration: time.Minute}
+
+		if err := s.Run(); err != nil {
+			t.Errorf("run returned an error: %s", err)
+		}
+	})
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	source := "forever := action(n) {\n\tforever(n + 1)\n}\nforever(0)\n"
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		s, _ := NewScriptFromSource("limits.tw", source, GetBuiltIn())
+		s.Engine = engine
+
+		err := s.Run()
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != CallDepthLimit || limitErr.Max != maxCallDepth {
+			t.Fatalf("expected the call depth limit of %d to be hit, got %v", maxCallDepth, err)
+		}
+	})
+}
+
+func TestLimitsSkipFoldedCalls(t *testing.T) {
+	source := "x := len(\"abc\") + len(\"de\") + len(\"f\")\n"
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		s, _ := NewScriptFromSource("limits.tw", source, GetBuiltIn())
+		s.Engine, s.Optimize = engine, true
+		s.Limits = &Limits{Steps: 1}
+
+		if err := s.Run(); err != nil {
+			t.Errorf("expected the folded calls not to count as steps, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,408 @@
+// lsp.go
+package taskwrappr
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+
+	lspCompletionFunction = 3
+	lspCompletionVariable = 6
+)
+
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   lspError        `json:"error"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity Severity `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspDocumentChange struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type document struct {
+	uri      string
+	path     string
+	lines    []string
+	analysis *analysis
+}
+
+type languageServer struct {
+	memory    *MemoryMap
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// ServeLanguageServer speaks the Language Server Protocol over in and out
+// until the client asks it to exit. Documents are checked against memory,
+// so completion and hover know about the actions and variables the host
+// provides.
+func ServeLanguageServer(in io.Reader, out io.Writer, memory *MemoryMap) error {
+	server := &languageServer{
+		memory:    memory,
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+
+	for {
+		message, err := server.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if message.Method == "exit" {
+			if !server.shutdown {
+				return fmt.Errorf("language server exited before shutdown")
+			}
+			return nil
+		}
+		if err := server.handle(message); err != nil {
+			return err
+		}
+	}
+}
+
+func (ls *languageServer) read() (*lspMessage, error) {
+	body, err := readMessage(ls.in)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &lspMessage{}
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (ls *languageServer) write(message interface{}) error {
+	return writeMessage(ls.out, message)
+}
+
+// readMessage reads the body of a message framed by a Content-Length
+// header, as used by both the language server and the debug adapter.
+func readMessage(in *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeMessage(out io.Writer, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (ls *languageServer) reply(id json.RawMessage, result interface{}) error {
+	return ls.write(&lspResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (ls *languageServer) replyError(id json.RawMessage, code int, message string) error {
+	return ls.write(&lspErrorResponse{JSONRPC: "2.0", ID: id, Error: lspError{Code: code, Message: message}})
+}
+
+func (ls *languageServer) notify(method string, params interface{}) error {
+	return ls.write(&lspNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (ls *languageServer) handle(message *lspMessage) error {
+	switch message.Method {
+	case "initialize":
+		return ls.reply(message.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1,
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "taskwrappr"},
+		})
+	case "shutdown":
+		ls.shutdown = true
+		return ls.reply(message.ID, nil)
+	case "textDocument/didOpen", "textDocument/didChange":
+		var params lspDocumentChange
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return ls.invalidParams(message, err)
+		}
+		text := params.TextDocument.Text
+		if changes := params.ContentChanges; len(changes) > 0 {
+			text = changes[len(changes)-1].Text
+		}
+		return ls.open(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var params lspDocumentChange
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return ls.invalidParams(message, err)
+		}
+		delete(ls.documents, params.TextDocument.URI)
+		return ls.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         params.TextDocument.URI,
+			"diagnostics": []lspDiagnostic{},
+		})
+	case "textDocument/definition", "textDocument/hover", "textDocument/completion":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return ls.invalidParams(message, err)
+		}
+		doc, ok := ls.documents[params.TextDocument.URI]
+		if !ok {
+			return ls.replyError(message.ID, lspInvalidParams, fmt.Sprintf("unknown document: %s", params.TextDocument.URI))
+		}
+
+		switch message.Method {
+		case "textDocument/definition":
+			return ls.reply(message.ID, doc.definition(params.Position))
+		case "textDocument/hover":
+			return ls.reply(message.ID, doc.hover(params.Position))
+		default:
+			return ls.reply(message.ID, ls.completion(doc))
+		}
+	}
+
+	if message.ID != nil {
+		return ls.replyError(message.ID, lspMethodNotFound, fmt.Sprintf("unsupported method: %s", message.Method))
+	}
+	return nil
+}
+
+// invalidParams answers a request whose params cannot be read with an
+// error. A notification gets no answer, it is dropped and the server goes
+// on with the next message.
+func (ls *languageServer) invalidParams(message *lspMessage, err error) error {
+	if message.ID == nil {
+		return nil
+	}
+	return ls.replyError(message.ID, lspInvalidParams, err.Error())
+}
+
+// open analyzes the new text of a document and publishes its diagnostics.
+func (ls *languageServer) open(uri, text string) error {
+	path := uri
+	if parsed, err := url.Parse(uri); err == nil && parsed.Scheme == "file" {
+		path = parsed.Path
+	}
+
+	s, err := NewScript(path, ls.memory)
+	if err != nil {
+		return err
+	}
+	s.Content = text
+
+	doc := &document{uri: uri, path: path, lines: strings.Split(text, string(NewLineSymbol)), analysis: s.analyze()}
+	ls.documents[uri] = doc
+
+	diagnostics := make([]lspDiagnostic, len(doc.analysis.Diagnostics))
+	for i, diagnostic := range doc.analysis.Diagnostics {
+		start := doc.position(diagnostic.Pos)
+		diagnostics[i] = lspDiagnostic{
+			Range:    lspRange{Start: start, End: lspPosition{Line: start.Line, Character: start.Character + 1}},
+			Severity: diagnostic.Severity,
+			Source:   "taskwrappr",
+			Message:  diagnostic.Message,
+		}
+	}
+	return ls.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diagnostics,
+	})
+}
+
+func (doc *document) definition(position lspPosition) interface{} {
+	reference := doc.analysis.referenceAt(doc.sourcePosition(position))
+	if reference == nil || reference.Symbol.Pos.Line == 0 {
+		return nil
+	}
+	return &lspLocation{URI: doc.uri, Range: doc.nameRange(reference.Symbol.Pos, reference.Symbol.Name)}
+}
+
+func (doc *document) hover(position lspPosition) interface{} {
+	reference := doc.analysis.referenceAt(doc.sourcePosition(position))
+	if reference == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": "```taskwrappr\n" + reference.describe() + "\n```",
+		},
+		"range": doc.nameRange(reference.Pos, reference.Symbol.Name),
+	}
+}
+
+// completion offers every action and variable the host memory provides
+// along with the names the document declares.
+func (ls *languageServer) completion(doc *document) []lspCompletionItem {
+	items := make(map[string]lspCompletionItem)
+	for memory := ls.memory; memory != nil; memory = memory.Parent {
+		for name, action := range memory.Actions {
+			if _, ok := items[name]; ok {
+				continue
+			}
+			item := lspCompletionItem{Label: name, Kind: lspCompletionFunction}
+			if action.Signature != nil {
+				item.Detail = name + action.Signature.String()
+			}
+			items[name] = item
+		}
+		for name, variable := range memory.Variables {
+			if _, ok := items[name]; !ok {
+				items[name] = lspCompletionItem{Label: name, Kind: lspCompletionVariable, Detail: variable.Type.String()}
+			}
+		}
+	}
+
+	for _, symbol := range doc.analysis.Symbols {
+		item := lspCompletionItem{Label: symbol.Name, Kind: lspCompletionVariable}
+		if symbol.IsAction {
+			item.Kind = lspCompletionFunction
+			item.Detail = (&reference{Symbol: symbol}).describe()
+		}
+		items[symbol.Name] = item
+	}
+
+	completions := make([]lspCompletionItem, 0, len(items))
+	for _, item := range items {
+		completions = append(completions, item)
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		return completions[i].Label < completions[j].Label
+	})
+	return completions
+}
+
+// position converts a source position, whose columns count runes, to the
+// UTF-16 based one used by the protocol.
+func (doc *document) position(pos Position) lspPosition {
+	if pos.Line < 1 || pos.Line > len(doc.lines) {
+		return lspPosition{}
+	}
+
+	runes := []rune(doc.lines[pos.Line-1])
+	column := pos.Column - 1
+	if column > len(runes) {
+		column = len(runes)
+	}
+	if column < 0 {
+		column = 0
+	}
+	return lspPosition{Line: pos.Line - 1, Character: len(utf16.Encode(runes[:column]))}
+}
+
+func (doc *document) sourcePosition(position lspPosition) Position {
+	pos := Position{File: doc.path, Line: position.Line + 1, Column: 1}
+	if position.Line < 0 || position.Line >= len(doc.lines) {
+		return pos
+	}
+
+	units := 0
+	for _, r := range doc.lines[position.Line] {
+		if units >= position.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		pos.Column++
+	}
+	return pos
+}
+
+func (doc *document) nameRange(pos Position, name string) lspRange {
+	start := doc.position(pos)
+	return lspRange{Start: start, End: lspPosition{Line: start.Line, Character: start.Character + len(utf16.Encode([]rune(name)))}}
+}
@@ -0,0 +1,143 @@
+// lsp_test.go
+package taskwrappr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func lspSession(t *testing.T, memory *MemoryMap, requests ...string) map[string]json.RawMessage {
+	t.Helper()
+
+	var in bytes.Buffer
+	for _, request := range requests {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(request), request)
+	}
+
+	var out bytes.Buffer
+	if err := ServeLanguageServer(&in, &out, memory); err != nil {
+		t.Fatalf("ServeLanguageServer returned an error: %s", err)
+	}
+
+	responses := make(map[string]json.RawMessage)
+	reader := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(reader)
+		if err != nil {
+			break
+		}
+
+		var message struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatalf("invalid message from the server: %s", err)
+		}
+		if message.Error != nil {
+			responses[string(message.ID)] = message.Error
+		} else if message.ID != nil {
+			responses[string(message.ID)] = message.Result
+		} else {
+			responses[message.Method] = message.Params
+		}
+	}
+	return responses
+}
+
+func TestLanguageServer(t *testing.T) {
+	memory := GetBuiltIn()
+	memory.Actions["hostAction"] = NewAction(nil, nil).WithSignature(NewSignature(IntegerType, NewParameter("value", StringType)))
+
+	source := "count := 2\ndouble := action(n: int) {\n\treturn(n * count)\n}\nprint(double(count))\nx := 1 +\n"
+	text, _ := json.Marshal(source)
+	uri := `{"uri":"file:///tmp/test.tw"}`
+	at := func(line, character int) string {
+		return fmt.Sprintf(`{"textDocument":%s,"position":{"line":%d,"character":%d}}`, uri, line, character)
+	}
+
+	responses := lspSession(t, memory,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///tmp/test.tw","text":`+string(text)+`}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/definition","params":`+at(4, 14)+`}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":`+at(4, 7)+`}`,
+		`{"jsonrpc":"2.0","id":4,"method":"textDocument/hover","params":`+at(4, 2)+`}`,
+		`{"jsonrpc":"2.0","id":5,"method":"textDocument/hover","params":`+at(2, 9)+`}`,
+		`{"jsonrpc":"2.0","id":6,"method":"textDocument/completion","params":`+at(5, 0)+`}`,
+		`{"jsonrpc":"2.0","id":7,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	var published struct {
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	json.Unmarshal(responses["textDocument/publishDiagnostics"], &published)
+	if len(published.Diagnostics) != 1 || published.Diagnostics[0].Range.Start != (lspPosition{Line: 5, Character: 7}) || published.Diagnostics[0].Message != "expected operand after +" {
+		t.Errorf("expected a single syntax error at 5:7, got %+v", published.Diagnostics)
+	}
+
+	var location lspLocation
+	json.Unmarshal(responses["2"], &location)
+	if location.URI != "file:///tmp/test.tw" || location.Range.Start != (lspPosition{}) || location.Range.End != (lspPosition{Character: 5}) {
+		t.Errorf("expected the definition of 'count' on the first line, got %+v", location)
+	}
+
+	hovers := map[string]string{
+		"3": "double := action(n: int)",
+		"4": `print(...values, sep: string = " ", end: string = "\n") -> nil`,
+		"5": "n: integer",
+	}
+	for id, expected := range hovers {
+		var hover struct {
+			Contents struct {
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		json.Unmarshal(responses[id], &hover)
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("hover %s: expected %q, got %q", id, expected, hover.Contents.Value)
+		}
+	}
+
+	var items []lspCompletionItem
+	json.Unmarshal(responses["6"], &items)
+	found := make(map[string]lspCompletionItem)
+	for _, item := range items {
+		found[item.Label] = item
+	}
+	if found["print"].Kind != lspCompletionFunction || found["double"].Kind != lspCompletionFunction || found["count"].Kind != lspCompletionVariable {
+		t.Errorf("expected builtins and declared names among the completions, got %+v", items)
+	}
+	if found["hostAction"].Detail != "hostAction(value: string) -> integer" {
+		t.Errorf("expected the host action with its signature, got %+v", found["hostAction"])
+	}
+}
+
+func TestLanguageServerInvalidParams(t *testing.T) {
+	responses := lspSession(t, GetBuiltIn(),
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":"file:///tmp/test.tw"}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":[1, 2]}`,
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":"nowhere"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	var invalid lspError
+	if err := json.Unmarshal(responses["1"], &invalid); err != nil || invalid.Code != lspInvalidParams {
+		t.Errorf("expected an invalid params error, got %s", responses["1"])
+	}
+	if !strings.Contains(string(responses["2"]), `"capabilities"`) {
+		t.Errorf("expected the server to go on serving, got %s", responses["2"])
+	}
+	if _, ok := responses["textDocument/publishDiagnostics"]; ok {
+		t.Errorf("expected the malformed notifications to be dropped")
+	}
+}
@@ -1,10 +1,15 @@
 // memory.go
 package taskwrappr
 
+import (
+	"strings"
+)
+
 type MemoryMap struct {
 	Parent    *MemoryMap
 	Actions   map[string]*Action
 	Variables map[string]*Variable
+	Types     map[string]VariableType
 }
 
 func NewMemoryMap(parent *MemoryMap) *MemoryMap {
@@ -12,6 +17,7 @@ func NewMemoryMap(parent *MemoryMap) *MemoryMap {
 		Parent:    parent,
 		Actions:   make(map[string]*Action),
 		Variables: make(map[string]*Variable),
+		Types:     make(map[string]VariableType),
 	}
 }
 
@@ -24,6 +30,16 @@ func (m *MemoryMap) GetAction(name string) *Action {
 	return nil
 }
 
+func (m *MemoryMap) ResolveAction(name string) *Action {
+	if action := m.GetAction(name); action != nil {
+		return action
+	}
+	if variable := m.GetQualifiedVariable(name); variable != nil && variable.Type == ActionType {
+		return variable.Value.(*Action)
+	}
+	return nil
+}
+
 func (m *MemoryMap) GetVariable(name string) *Variable {
 	for scope := m; scope != nil; scope = scope.Parent {
 		if variable, ok := scope.Variables[name]; ok {
@@ -33,6 +49,35 @@ func (m *MemoryMap) GetVariable(name string) *Variable {
 	return nil
 }
 
+func (m *MemoryMap) GetQualifiedVariable(name string) *Variable {
+	parts := strings.Split(name, string(DecimalSymbol))
+	variable := m.GetVariable(parts[0])
+	for _, part := range parts[1:] {
+		if variable == nil || variable.Type != MapType {
+			return nil
+		}
+		variable = variable.Value.(map[string]*Variable)[part]
+	}
+	return variable
+}
+
+func (m *MemoryMap) GetVariableType(name string) (VariableType, bool) {
+	for scope := m; scope != nil; scope = scope.Parent {
+		if _, ok := scope.Variables[name]; ok {
+			variableType, ok := scope.Types[name]
+			return variableType, ok
+		}
+	}
+	return AnyType, false
+}
+
+func (m *MemoryMap) DeclareVariableType(name string, variableType VariableType) {
+	if m.Types == nil {
+		m.Types = make(map[string]VariableType)
+	}
+	m.Types[name] = variableType
+}
+
 func (m *MemoryMap) MakeVariable(name string, value interface{}) *Variable {
 	variable := NewVariable(value, DetermineVariableType(value))
 	m.Variables[name] = variable
@@ -57,9 +102,11 @@ func (m *MemoryMap) DeleteAction(name string) {
 
 func (m *MemoryMap) DeleteVariable(name string) {
     delete(m.Variables, name)
+    delete(m.Types, name)
 }
 
 func (m *MemoryMap) Clear() {
 	m.Actions = make(map[string]*Action)
 	m.Variables = make(map[string]*Variable)
+	m.Types = make(map[string]VariableType)
 }
\ No newline at end of file
@@ -0,0 +1,195 @@
+// modules.go
+package taskwrappr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type moduleCache struct {
+	modules map[string]*Variable
+	sources map[string]string
+	loading []string
+}
+
+func newModuleCache(rootPath string) *moduleCache {
+	cache := &moduleCache{
+		modules: make(map[string]*Variable),
+		sources: make(map[string]string),
+	}
+	if path, err := filepath.Abs(rootPath); err == nil {
+		cache.loading = append(cache.loading, path)
+	}
+	return cache
+}
+
+func (s *Script) resolveModulePath(path string) (string, error) {
+	if filepath.Ext(path) == "" {
+		path += ModuleExtension
+	}
+
+	var candidates []string
+	if filepath.IsAbs(path) {
+		candidates = append(candidates, path)
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(s.Path), path))
+		for _, searchPath := range s.SearchPaths {
+			candidates = append(candidates, filepath.Join(searchPath, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return filepath.Abs(candidate)
+		}
+	}
+
+	return "", fmt.Errorf("module not found: %s (searched %s)", path, strings.Join(candidates, ", "))
+}
+
+func (s *Script) importModule(path string) (*Variable, error) {
+	if s.modules == nil {
+		s.modules = newModuleCache(s.Path)
+	}
+
+	modulePath, err := s.resolveModulePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace, ok := s.modules.modules[modulePath]; ok {
+		return namespace, nil
+	}
+
+	for i, loading := range s.modules.loading {
+		if loading == modulePath {
+			cycle := append(append([]string{}, s.modules.loading[i:]...), modulePath)
+			for j := range cycle {
+				cycle[j] = filepath.Base(cycle[j])
+			}
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	s.modules.loading = append(s.modules.loading, modulePath)
+	defer func() {
+		s.modules.loading = s.modules.loading[:len(s.modules.loading)-1]
+	}()
+
+	module, err := NewScript(modulePath, s.rootMemory())
+	if err != nil {
+		return nil, err
+	}
+	module.SearchPaths = s.SearchPaths
+	module.Engine = s.Engine
+	module.Optimize = s.Optimize
+	module.Debugger = s.Debugger
+	module.Profiler = s.Profiler
+	module.Coverage = s.Coverage
+	module.Args = s.Args
+	module.Stdout, module.Stderr, module.Stdin = s.Stdout, s.Stderr, s.Stdin
+	module.input = s.stdin()
+	module.Logger = s.Logger
+	module.ctx = s.ctx
+	module.Limits = s.Limits
+	module.Policy = s.Policy
+	module.usage = s.usage
+	module.interceptors = s.interceptors
+	module.modules = s.modules
+
+	if err := module.load(); err != nil {
+		return nil, fmt.Errorf("error loading module %s: %w", path, err)
+	}
+	if s.Debugger != nil {
+		s.Debugger.enter(filepath.Base(modulePath))
+		defer s.Debugger.leave()
+	}
+	if err := module.runMain(); err != nil {
+		return nil, fmt.Errorf("error running module %s: %w", path, err)
+	}
+	module.returning, module.returnValues = false, nil
+
+	namespace := NewVariable(exportModule(module.MainBlock.Memory), MapType)
+	s.modules.modules[modulePath] = namespace
+
+	return namespace, nil
+}
+
+func exportModule(memory *MemoryMap) map[string]*Variable {
+	exports := make(map[string]*Variable)
+	for name, action := range memory.Actions {
+		if !strings.HasPrefix(name, "_") {
+			exports[name] = NewVariable(action, ActionType)
+		}
+	}
+	for name, variable := range memory.Variables {
+		if !strings.HasPrefix(name, "_") {
+			exports[name] = NewVariable(variable.Value, variable.Type)
+		}
+	}
+	return exports
+}
+
+func (s *Script) rootMemory() *MemoryMap {
+	if s.MainBlock == nil || s.MainBlock.Memory.Parent == nil {
+		return GetBuiltIn()
+	}
+	return s.MainBlock.Memory.Parent
+}
+
+func moduleName(path string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if !isIdentifier(name) {
+		return "", fmt.Errorf("cannot derive a namespace from %s, use '%s' to name it", path, AliasString)
+	}
+	return name, nil
+}
+
+func (s *Script) buildImport(node *ImportNode) *Action {
+	importAction := func(s *Script, args ...*Variable) ([]*Variable, error) {
+		value, err := s.evaluate(node.Path)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.bindImport(value, node.Alias)
+	}
+
+	return newInternalAction(importAction)
+}
+
+func (s *Script) bindImport(value *Variable, alias string) error {
+	if value.Type != StringType {
+		return fmt.Errorf("'%s' requires a module path string", ImportString)
+	}
+	path := value.Value.(string)
+
+	name := alias
+	if name == "" {
+		var err error
+		if name, err = moduleName(path); err != nil {
+			return err
+		}
+	}
+
+	namespace, err := s.importModule(path)
+	if err != nil {
+		return err
+	}
+	s.CurrentBlock.Memory.Variables[name] = namespace
+
+	return nil
+}
+
+func ImportAction(s *Script, args ...*Variable) ([]*Variable, error) {
+	if len(args) != 1 || args[0].Type != StringType {
+		return nil, fmt.Errorf("'%s' action requires a module path string", ImportString)
+	}
+
+	namespace, err := s.importModule(args[0].Value.(string))
+	if err != nil {
+		return nil, err
+	}
+	return []*Variable{namespace}, nil
+}
@@ -0,0 +1,284 @@
+// optimizer.go
+package taskwrappr
+
+import (
+	"strings"
+)
+
+type optimizer struct {
+	script *Script
+	bound  map[string]bool
+}
+
+// optimize rewrites the program in place before it is built or compiled.
+// Operators and pure actions applied to literals are folded into a single
+// literal, and if/elseIf/else chains whose conditions are all literals are
+// reduced to the branches that run. Anything that would fail is left for
+// the engine to report at run time.
+func (s *Script) optimize(program *BlockNode) {
+	o := &optimizer{script: s, bound: boundNames(program)}
+	o.optimizeBlock(program)
+}
+
+// boundNames collects every name the program may bind, a call to any of
+// them might not reach the action in memory and is never folded.
+func boundNames(program *BlockNode) map[string]bool {
+	bound := make(map[string]bool)
+	Walk(program, func(node Node) bool {
+		switch n := node.(type) {
+		case *DeclarationNode:
+			bound[n.Name] = true
+		case *AssignmentNode:
+			bound[n.Name] = true
+		case *ActionDeclarationNode:
+			bound[n.Name] = true
+		case *ParameterNode:
+			bound[n.Name] = true
+		case *ImportNode:
+			if n.Alias != "" {
+				bound[n.Alias] = true
+			}
+		}
+		return true
+	})
+	return bound
+}
+
+func (o *optimizer) optimizeBlock(b *BlockNode) {
+	for _, statement := range b.Statements {
+		o.optimizeStatement(statement)
+	}
+	b.Statements = o.pruneBranches(b.Statements)
+}
+
+func (o *optimizer) optimizeStatement(statement Statement) {
+	switch node := statement.(type) {
+	case *AssignmentNode:
+		node.Value = o.fold(node.Value)
+	case *DeclarationNode:
+		node.Value = o.fold(node.Value)
+	case *AugmentedAssignmentNode:
+		node.Value = o.fold(node.Value)
+	case *ImportNode:
+		node.Path = o.fold(node.Path)
+	case *ActionDeclarationNode:
+		o.optimizeParameters(node.Parameters)
+		if node.Body != nil {
+			o.optimizeBlock(node.Body)
+		}
+	case *CallStatementNode:
+		o.foldArguments(node.Call)
+		if node.Body != nil {
+			o.optimizeBlock(node.Body)
+		}
+	}
+}
+
+func (o *optimizer) optimizeParameters(parameters []*ParameterNode) {
+	for _, parameter := range parameters {
+		if parameter.Default != nil {
+			parameter.Default = o.fold(parameter.Default)
+		}
+	}
+}
+
+func (o *optimizer) foldArguments(node *CallNode) {
+	if node.Name == "" {
+		node.Callee = o.fold(node.Callee)
+	}
+	for _, argument := range node.Arguments {
+		argument.Value = o.fold(argument.Value)
+	}
+}
+
+func (o *optimizer) fold(expr Expression) Expression {
+	switch node := expr.(type) {
+	case *UnaryNode:
+		node.Operand = o.fold(node.Operand)
+		if operand, ok := literalValue(node.Operand); ok {
+			if result, err := evaluateUnary(node.Operator, operand); err == nil {
+				return newLiteral(node.Pos, result)
+			}
+		}
+	case *BinaryNode:
+		node.Left = o.fold(node.Left)
+		node.Right = o.fold(node.Right)
+		left, leftOk := literalValue(node.Left)
+		right, rightOk := literalValue(node.Right)
+		if leftOk && rightOk {
+			if result, err := evaluateBinary(node.Operator, left, right); err == nil {
+				return newLiteral(node.Pos, result)
+			}
+		}
+	case *CallNode:
+		o.foldArguments(node)
+		if result := o.foldCall(node); result != nil {
+			return newLiteral(node.Pos, result)
+		}
+	case *IndexNode:
+		node.Target = o.fold(node.Target)
+		node.Index = o.fold(node.Index)
+	case *FieldNode:
+		node.Target = o.fold(node.Target)
+	case *LambdaNode:
+		o.optimizeParameters(node.Parameters)
+		o.optimizeBlock(node.Body)
+		if node.Result != nil {
+			node.Result = o.fold(node.Result)
+		}
+	}
+	return expr
+}
+
+// foldCall runs a call to a pure action whose arguments are all literals
+// and returns its single scalar result, or nil when it cannot be folded.
+func (o *optimizer) foldCall(node *CallNode) *Variable {
+	if node.Name == "" || o.bound[node.Name] || strings.ContainsRune(node.Name, DecimalSymbol) {
+		return nil
+	}
+	action := o.script.MainBlock.Memory.ResolveAction(node.Name)
+	if action == nil || !action.Pure || action.requirement != nil || len(o.script.interceptors) > 0 {
+		return nil
+	}
+
+	var args []*Variable
+	var named map[string]*Variable
+	for _, argument := range node.Arguments {
+		value, ok := literalValue(argument.Value)
+		if !ok {
+			return nil
+		}
+		if argument.Name != "" {
+			if named == nil {
+				named = make(map[string]*Variable)
+			}
+			named[argument.Name] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+
+	// The call is made here rather than through Invoke, so it counts
+	// against neither the limits nor the policy of the script: those only
+	// see the calls made when it runs. A result the limits would reject
+	// is left to fail at run time.
+	if action.Signature != nil {
+		bound, err := action.Signature.Bind(node.Name, args, named)
+		if err != nil {
+			return nil
+		}
+		args = bound
+	} else if len(named) > 0 {
+		return nil
+	}
+	values, err := action.executeFunc(o.script, args...)
+	if err != nil || len(values) != 1 || o.script.checkSize(values[0]) != nil {
+		return nil
+	}
+	switch values[0].Type {
+	case StringType, IntegerType, FloatType, BooleanType:
+		return values[0]
+	}
+	return nil
+}
+
+func literalValue(expr Expression) (*Variable, bool) {
+	literal, ok := expr.(*LiteralNode)
+	if !ok {
+		return nil, false
+	}
+	return NewVariable(literal.Value.Value, literal.Value.Type), true
+}
+
+func newLiteral(pos Position, value *Variable) *LiteralNode {
+	return &LiteralNode{Pos: pos, Raw: formatLiteral(value), Value: value}
+}
+
+// pruneBranches replaces every if/elseIf/else chain whose outcome is known
+// with the bodies that run. Each branch leaves its own result behind for
+// the next one, so a chain followed by a statement that still reads it
+// ends with an empty if carrying the same result.
+func (o *optimizer) pruneBranches(statements []Statement) []Statement {
+	pruned := make([]Statement, 0, len(statements))
+
+	for i := 0; i < len(statements); {
+		name, condition, ok := o.branch(statements[i])
+		if !ok || name != IfString {
+			pruned = append(pruned, statements[i])
+			i++
+			continue
+		}
+
+		last := condition
+		if last {
+			pruned = append(pruned, statements[i])
+		}
+		for i++; i < len(statements); i++ {
+			name, condition, ok := o.branch(statements[i])
+			if !ok || name == IfString {
+				break
+			}
+			taken := !last && (name == ElseString || condition)
+			if taken {
+				pruned = append(pruned, takenBranch(statements[i].(*CallStatementNode)))
+			}
+			last = taken
+		}
+
+		if !last && i < len(statements) && o.readsResult(statements[i]) {
+			pruned = append(pruned, newBranch(statements[i].Position(), false, &BlockNode{Pos: statements[i].Position()}))
+		}
+	}
+
+	return pruned
+}
+
+// branch reports whether statement is an if, elseIf or else with a body
+// and a literal condition, along with that condition.
+func (o *optimizer) branch(statement Statement) (string, bool, bool) {
+	node, ok := statement.(*CallStatementNode)
+	if !ok || node.Body == nil || o.bound[node.Call.Name] {
+		return "", false, false
+	}
+
+	switch name := node.Call.Name; name {
+	case IfString, ElseIfString:
+		if len(node.Call.Arguments) != 1 {
+			return "", false, false
+		}
+		value, ok := literalValue(node.Call.Arguments[0].Value)
+		if !ok || value.Type != BooleanType {
+			return "", false, false
+		}
+		return name, value.Value.(bool), true
+	case ElseString:
+		if len(node.Call.Arguments) != 0 {
+			return "", false, false
+		}
+		return name, true, true
+	}
+	return "", false, false
+}
+
+func (o *optimizer) readsResult(statement Statement) bool {
+	node, ok := statement.(*CallStatementNode)
+	return ok && (node.Call.Name == ElseIfString || node.Call.Name == ElseString)
+}
+
+func takenBranch(node *CallStatementNode) Statement {
+	return newBranch(node.Pos, true, node.Body)
+}
+
+func newBranch(pos Position, condition bool, body *BlockNode) *CallStatementNode {
+	value := NewVariable(condition, BooleanType)
+	return &CallStatementNode{
+		Pos: pos,
+		Call: &CallNode{
+			Pos:       pos,
+			Callee:    &IdentifierNode{Pos: pos, Name: IfString},
+			Name:      IfString,
+			Arguments: []*ArgumentNode{{Pos: pos, Value: newLiteral(pos, value)}},
+		},
+		Body: body,
+	}
+}
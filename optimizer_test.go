@@ -0,0 +1,116 @@
+// optimizer_test.go
+package taskwrappr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadProgram(t *testing.T, content string, optimize bool) *Script {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "optimize.tw")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScript(path, GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Optimize = optimize
+	if err := s.load(); err != nil {
+		t.Fatalf("load returned an error: %s", err)
+	}
+	return s
+}
+
+func TestConstantFolding(t *testing.T) {
+	content := "a := 3 + 5 * 2^2\nb := pass(2 + 2) * -1\nc := string(len(\"abc\")) + \"!\"\n" +
+		"d := a + 1\ne := array(1, 2)\nf := int(\"x\")\nprint(1 + 1)\n"
+	s := loadProgram(t, content, true)
+
+	expected := []interface{}{23.0, -4.0, "3!"}
+	for i, value := range expected {
+		declaration := s.Program.Statements[i].(*DeclarationNode)
+		literal, ok := declaration.Value.(*LiteralNode)
+		if !ok || literal.Value.Value != value {
+			t.Errorf("expected '%s' to fold to %v, got %#v", declaration.Name, value, declaration.Value)
+		}
+	}
+
+	for _, statement := range s.Program.Statements[3:6] {
+		declaration := statement.(*DeclarationNode)
+		if _, ok := declaration.Value.(*LiteralNode); ok {
+			t.Errorf("expected '%s' not to be folded", declaration.Name)
+		}
+	}
+
+	call := s.Program.Statements[6].(*CallStatementNode).Call
+	if literal, ok := call.Arguments[0].Value.(*LiteralNode); !ok || literal.Raw != "2.0" {
+		t.Errorf("expected the argument of print to fold to 2.0, got %#v", call.Arguments[0].Value)
+	}
+}
+
+func TestFoldingSkipsShadowedActions(t *testing.T) {
+	content := "len := action(value) {\n\treturn(0)\n}\nn := len(\"abc\")\n"
+	s := loadProgram(t, content, true)
+
+	if _, ok := s.Program.Statements[1].(*DeclarationNode).Value.(*LiteralNode); ok {
+		t.Errorf("a call to a script-defined action should not be folded")
+	}
+}
+
+func TestBranchElimination(t *testing.T) {
+	content := "if(true) {\n\tprint(\"a\")\n}\nelse() {\n\tprint(\"b\")\n}\n" +
+		"if(1 > 2) {\n\tprint(\"c\")\n}\nelseIf(false) {\n\tprint(\"d\")\n}\nelse() {\n\tprint(\"e\")\n}\n" +
+		"if(false) {\n\tprint(\"f\")\n}\n" +
+		"if(true) {\n\tprint(\"g\")\n}\nelseIf(true) {\n\tprint(\"h\")\n}\nelse() {\n\tprint(\"i\")\n}\n" +
+		"if(false) {\n\tprint(\"j\")\n}\nelseIf(result) {\n\tprint(\"k\")\n}\n"
+
+	s := loadProgram(t, content, true)
+	var bodies []string
+	for _, statement := range s.Program.Statements {
+		node := statement.(*CallStatementNode)
+		body := ""
+		if len(node.Body.Statements) > 0 {
+			body = node.Body.Statements[0].(*CallStatementNode).Call.Arguments[0].Value.(*LiteralNode).Value.Value.(string)
+		}
+		bodies = append(bodies, node.Call.Name+":"+body)
+	}
+
+	expected := []string{"if:a", "if:e", "if:g", "if:i", "if:", "elseIf:k"}
+	if len(bodies) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, bodies)
+	}
+	for i := range expected {
+		if bodies[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, bodies)
+			break
+		}
+	}
+
+	for _, engine := range engines {
+		var outputs [2]string
+		for i, optimize := range []bool{true, false} {
+			memory := GetBuiltIn()
+			memory.Variables["result"] = NewVariable(true, BooleanType)
+			run, err := NewScript(s.Path, memory)
+			if err != nil {
+				t.Fatalf("NewScript returned an error: %s", err)
+			}
+			run.Engine, run.Optimize = engine, optimize
+			var output strings.Builder
+			run.Stdout = &output
+			if err := run.Run(); err != nil {
+				t.Errorf("run returned an error: %s", err)
+			}
+			outputs[i] = output.String()
+		}
+		if outputs[0] != outputs[1] {
+			t.Errorf("%v: optimized output %q differs from %q", engine, outputs[0], outputs[1])
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// params.go
+package taskwrappr
+
+import (
+	"fmt"
+)
+
+// Param is an input a script declares at its top level with
+//
+//	param("env", "string", "staging", "target environment")
+//
+// A param without a default is required.
+type Param struct {
+	Name        string
+	Type        VariableType
+	Default     *Variable
+	Description string
+	Pos         Position
+}
+
+func (p *Param) Required() bool {
+	return p.Default == nil
+}
+
+// Cast converts value to the type of the param.
+func (p *Param) Cast(value *Variable) (*Variable, error) {
+	if value.Type == p.Type {
+		return value, nil
+	}
+	converted, err := value.CastTo(p.Type)
+	if err != nil {
+		return nil, fmt.Errorf("param '%s': %w", p.Name, err)
+	}
+	return NewVariable(converted, p.Type), nil
+}
+
+// Params parses the script and returns the params it declares, in order,
+// without running it.
+func (s *Script) Params() ([]*Param, error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	program, err := s.parseContent()
+	if err != nil {
+		return nil, err
+	}
+	return s.declaredParams(program)
+}
+
+// declaredParams collects the param calls among the top level statements
+// of program. Their arguments have to be constants, so they are known
+// before the script runs.
+func (s *Script) declaredParams(program *BlockNode) ([]*Param, error) {
+	action := s.MainBlock.Memory.GetAction("param")
+	if action == nil || action.Signature == nil {
+		return nil, nil
+	}
+
+	var params []*Param
+	seen := make(map[string]bool)
+	for _, statement := range program.Statements {
+		call := paramCall(statement)
+		if call == nil || call.Name != "param" {
+			continue
+		}
+
+		var args []*Variable
+		named := make(map[string]*Variable)
+		for _, argument := range call.Arguments {
+			value, ok := foldConstant(argument.Value)
+			if !ok {
+				return nil, s.errorfAt(argument.Value.Position(), "arguments of 'param' action must be constants")
+			}
+			if argument.Name != "" {
+				named[argument.Name] = value
+			} else {
+				args = append(args, value)
+			}
+		}
+		bound, err := action.Signature.Bind(call.Name, args, named)
+		if err != nil {
+			return nil, s.errorAt(call.Pos, err)
+		}
+
+		param, err := newParam(bound)
+		if err != nil {
+			return nil, s.errorAt(call.Pos, err)
+		}
+		if seen[param.Name] {
+			return nil, s.errorfAt(call.Pos, "param '%s' is declared more than once", param.Name)
+		}
+		seen[param.Name] = true
+		param.Pos = call.Pos
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// paramCall is the call a top level statement makes, either on its own or
+// as the value of a declaration.
+func paramCall(statement Statement) *CallNode {
+	switch node := statement.(type) {
+	case *CallStatementNode:
+		if node.Body == nil {
+			return node.Call
+		}
+	case *DeclarationNode:
+		call, _ := node.Value.(*CallNode)
+		return call
+	}
+	return nil
+}
+
+// foldConstant evaluates an expression made of literals only, the way
+// the optimizer would fold it.
+func foldConstant(expr Expression) (*Variable, bool) {
+	switch node := expr.(type) {
+	case *LiteralNode:
+		return node.Value, true
+	case *UnaryNode:
+		if operand, ok := foldConstant(node.Operand); ok {
+			result, err := evaluateUnary(node.Operator, operand)
+			return result, err == nil
+		}
+	case *BinaryNode:
+		left, leftOk := foldConstant(node.Left)
+		right, rightOk := foldConstant(node.Right)
+		if leftOk && rightOk {
+			result, err := evaluateBinary(node.Operator, left, right)
+			return result, err == nil
+		}
+	}
+	return nil, false
+}
+
+func newParam(bound []*Variable) (*Param, error) {
+	for _, arg := range []*Variable{bound[0], bound[1], bound[3]} {
+		if arg.Type != StringType {
+			return nil, fmt.Errorf("'param' action requires string name, type and description")
+		}
+	}
+
+	param := &Param{Name: bound[0].Value.(string), Description: bound[3].Value.(string)}
+	paramType, err := ParseVariableType(bound[1].Value.(string))
+	if err != nil {
+		return nil, err
+	}
+	switch paramType {
+	case StringType, IntegerType, FloatType, BooleanType:
+		param.Type = paramType
+	default:
+		return nil, fmt.Errorf("param '%s' cannot be of type %v", param.Name, paramType)
+	}
+
+	if bound[2].Type != NilType {
+		if param.Default, err = param.Cast(bound[2]); err != nil {
+			return nil, err
+		}
+	}
+	return param, nil
+}
+
+// bindParams gives every declared param its value from ParamValues or its
+// default, and fails when a required one has none.
+func (s *Script) bindParams() error {
+	params, err := s.declaredParams(s.Program)
+	if err != nil {
+		return err
+	}
+
+	s.params = make(map[string]*Variable, len(params))
+	for _, param := range params {
+		value, ok := s.ParamValues[param.Name]
+		switch {
+		case ok:
+			if value, err = param.Cast(value); err != nil {
+				return s.errorAt(param.Pos, err)
+			}
+		case param.Required():
+			return s.errorfAt(param.Pos, "missing required param '%s'", param.Name)
+		default:
+			value = NewVariable(param.Default.Value, param.Type)
+		}
+
+		s.params[param.Name] = value
+		s.MainBlock.Memory.Variables[param.Name] = value
+		s.MainBlock.Memory.DeclareVariableType(param.Name, param.Type)
+	}
+
+	for name := range s.ParamValues {
+		if _, ok := s.params[name]; !ok {
+			return fmt.Errorf("%s: unknown param '%s'", s.Path, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// params_test.go
+package taskwrappr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const paramsSource = `param("env", "string", "staging", "target environment")
+param("replicas", "int", 2)
+param("token", "string", description := "API token")
+count := param("retries", "int", -1)
+result = array(env, replicas + 1, token, count, args())
+`
+
+func TestParams(t *testing.T) {
+	s, err := NewScriptFromSource("params.tw", paramsSource, GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScriptFromSource returned an error: %s", err)
+	}
+	params, err := s.Params()
+	if err != nil {
+		t.Fatalf("Params returned an error: %s", err)
+	}
+
+	var declared []string
+	for _, param := range params {
+		declared = append(declared, param.Name+" "+param.Type.String())
+	}
+	if expected := []string{"env string", "replicas integer", "token string", "retries integer"}; !reflect.DeepEqual(declared, expected) {
+		t.Errorf("expected params %v, got %v", expected, declared)
+	}
+	if params[0].Required() || !params[2].Required() || params[2].Description != "API token" {
+		t.Errorf("unexpected params: %+v %+v", params[0], params[2])
+	}
+
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		s, _ := NewScriptFromSource("params.tw", paramsSource, memory)
+		s.Engine = engine
+		s.Args = []string{"a", "b"}
+		s.ParamValues = map[string]*Variable{
+			"replicas": NewVariable("5", StringType),
+			"token":    NewVariable("secret", StringType),
+		}
+
+		if err := s.Run(); err != nil {
+			t.Fatalf("run returned an error: %s", err)
+		}
+		if result := formatValue(memory.Variables["result"]); result != "[staging 6 secret -1 [a b]]" {
+			t.Errorf("unexpected result: %s", result)
+		}
+	})
+}
+
+func TestParamErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		values map[string]*Variable
+		err    string
+	}{
+		{`param("token", "string")`, nil, "missing required param 'token'"},
+		{`param("port", "int")`, map[string]*Variable{"port": NewVariable("http", StringType)}, "param 'port': cannot convert string to integer"},
+		{`param("port", "int", 80)`, map[string]*Variable{"host": NewVariable("x", StringType)}, "unknown param 'host'"},
+		{`param("items", "array")`, nil, "param 'items' cannot be of type array"},
+		{`param(args()[0], "string")`, nil, "arguments of 'param' action must be constants"},
+		{"param(\"env\", \"string\", \"a\")\nparam(\"env\", \"string\", \"b\")", nil, "param 'env' is declared more than once"},
+		{"if(true) {\n\tparam(\"env\", \"string\", \"a\")\n}", nil, "param 'env' must be declared at the top level of the script"},
+	}
+
+	for _, test := range tests {
+		s, _ := NewScriptFromSource("params.tw", test.source, GetBuiltIn())
+		s.ParamValues = test.values
+		err := s.Run()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected an error containing %q, got %v", test.source, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,708 @@
+// parser.go
+package taskwrappr
+
+import (
+	"strings"
+)
+
+// parser reports problems found while parsing a block to diagnostics
+// when it is set and resumes at the next statement, otherwise it stops
+// at the first one.
+type parser struct {
+	script      *Script
+	tokens      []*Token
+	index       int
+	diagnostics *Diagnostics
+}
+
+func (s *Script) parseProgram(tokens []*Token) (*BlockNode, Diagnostics) {
+	var diagnostics Diagnostics
+	p := &parser{script: s, tokens: tokens, diagnostics: &diagnostics}
+	program, _ := p.parseBlock(nil)
+	return program, diagnostics
+}
+
+func (p *parser) recover(err error) error {
+	if p.diagnostics == nil {
+		return err
+	}
+	p.diagnostics.add(SeverityError, err)
+	return nil
+}
+
+// synchronize skips the rest of a statement that failed to parse, up to
+// the separator ending it or the code block following it.
+func (p *parser) synchronize() {
+	depth := 0
+	for ; p.index < len(p.tokens); p.index++ {
+		switch token := p.tokens[p.index]; token.Type {
+		case CodeBlockOpenToken:
+			if depth == 0 && (p.index == 0 || p.tokens[p.index-1].Type != ArrowToken) {
+				return
+			}
+			depth++
+		case CodeBlockCloseToken:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case NewLineToken, SeparatorToken, EOFToken:
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *parser) peek() *Token {
+	if p.index < len(p.tokens) {
+		return p.tokens[p.index]
+	}
+	if len(p.tokens) > 0 {
+		last := p.tokens[len(p.tokens)-1]
+		return &Token{Type: EOFToken, Pos: last.Pos}
+	}
+	return &Token{Type: EOFToken, Pos: Position{File: p.script.Path, Line: 1, Column: 1}}
+}
+
+func (p *parser) skipSeparators() {
+	for p.index < len(p.tokens) {
+		switch p.tokens[p.index].Type {
+		case NewLineToken, CommentToken, SeparatorToken:
+			p.index++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseBlock(open *Token) (*BlockNode, error) {
+	block := &BlockNode{Pos: p.peek().Pos}
+	if open != nil {
+		block.Pos = open.Pos
+	}
+
+	for {
+		p.skipSeparators()
+		token := p.peek()
+
+		switch token.Type {
+		case EOFToken:
+			if open != nil {
+				if err := p.recover(p.script.errorfAt(open.Pos, "unmatched opening brace")); err != nil {
+					return nil, err
+				}
+			}
+			return block, nil
+		case CodeBlockCloseToken:
+			p.index++
+			if open == nil {
+				if err := p.recover(p.script.errorfAt(token.Pos, "unmatched closing brace")); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return block, nil
+		case CodeBlockOpenToken:
+			if err := p.recover(p.script.errorfAt(token.Pos, "code block without an action")); err != nil {
+				return nil, err
+			}
+			p.index++
+			p.parseBlock(token)
+			continue
+		}
+
+		statement, err := p.parseStatement()
+		if err != nil {
+			if err := p.recover(err); err != nil {
+				return nil, err
+			}
+			p.synchronize()
+		} else {
+			block.Statements = append(block.Statements, statement)
+		}
+
+		resume := p.index
+		p.skipSeparators()
+		if open := p.peek(); open.Type == CodeBlockOpenToken {
+			p.index++
+			body, err := p.parseBlock(open)
+			if err != nil {
+				return nil, err
+			}
+			if statement == nil {
+				continue
+			}
+			if err := p.attachBody(statement, body); err != nil {
+				if err := p.recover(err); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			p.index = resume
+		}
+	}
+}
+
+func (p *parser) attachBody(statement Statement, body *BlockNode) error {
+	switch node := statement.(type) {
+	case *CallStatementNode:
+		if node.Body == nil {
+			node.Body = body
+			return nil
+		}
+	case *ActionDeclarationNode:
+		if node.Body == nil {
+			node.Body = body
+			return nil
+		}
+	}
+	return p.script.errorfAt(body.Pos, "code block without an action")
+}
+
+func (p *parser) statementEnd() (int, error) {
+	var open []*Token
+	for i := p.index; i < len(p.tokens); i++ {
+		token := p.tokens[i]
+		switch token.Type {
+		case ParenOpenToken, BracketOpenToken:
+			open = append(open, token)
+		case CodeBlockOpenToken:
+			if len(open) == 0 && p.tokens[i-1].Type != ArrowToken {
+				return i, nil
+			}
+			open = append(open, token)
+		case ParenCloseToken, BracketCloseToken, CodeBlockCloseToken:
+			if len(open) == 0 {
+				if token.Type == CodeBlockCloseToken {
+					return i, nil
+				}
+				return 0, p.script.errorfAt(token.Pos, "unmatched '%s'", token.Value)
+			}
+			if opener := open[len(open)-1]; !closesToken(opener, token) {
+				if token.Type == CodeBlockCloseToken {
+					return 0, p.script.errorfAt(opener.Pos, "unclosed '%s'", opener.Value)
+				}
+				return 0, p.script.errorfAt(token.Pos, "'%s' does not close '%s' opened at %d:%d", token.Value, opener.Value, opener.Pos.Line, opener.Pos.Column)
+			}
+			open = open[:len(open)-1]
+		case NewLineToken, SeparatorToken, EOFToken:
+			if len(open) == 0 {
+				return i, nil
+			}
+		}
+	}
+	if len(open) > 0 {
+		return 0, p.script.errorfAt(open[len(open)-1].Pos, "unclosed '%s'", open[len(open)-1].Value)
+	}
+	return len(p.tokens), nil
+}
+
+func closesToken(opener, closer *Token) bool {
+	switch opener.Type {
+	case ParenOpenToken:
+		return closer.Type == ParenCloseToken
+	case BracketOpenToken:
+		return closer.Type == BracketCloseToken
+	case CodeBlockOpenToken:
+		return closer.Type == CodeBlockCloseToken
+	}
+	return false
+}
+
+func (p *parser) parseStatement() (Statement, error) {
+	end, err := p.statementEnd()
+	if err != nil {
+		return nil, err
+	}
+	tokens := p.tokens[p.index:end]
+	p.index = end
+
+	first := tokens[0]
+	if first.Type != IdentifierToken {
+		return nil, p.script.errorfAt(first.Pos, "expected a statement, got '%s'", first.Value)
+	}
+
+	if first.Value == ImportString && len(tokens) > 1 && tokens[1].Type == ParenOpenToken {
+		return p.parseImport(tokens)
+	}
+
+	rest := tokens[1:]
+	typeName := ""
+	if len(rest) > 0 && rest[0].Type == ColonToken {
+		if len(rest) < 3 || rest[1].Type != IdentifierToken || rest[2].Type != DeclarationToken {
+			return nil, p.script.errorfAt(rest[0].Pos, "expected a type name followed by '%s'", DeclarationString)
+		}
+		typeName = rest[1].Value
+		rest = rest[2:]
+	}
+
+	if len(rest) == 0 || (rest[0].Type != DeclarationToken && rest[0].Type != AssignmentToken && rest[0].Type != AugmentedAssignmentToken) {
+		return p.parseCallStatement(tokens)
+	}
+
+	operator, valueTokens := rest[0], rest[1:]
+	if len(trimNewLines(valueTokens)) == 0 {
+		return nil, p.script.errorfAt(operator.Pos, "expected an expression after '%s'", operator.Value)
+	}
+
+	if operator.Type == DeclarationToken {
+		if parameters, ok := actionDeclarationParameters(valueTokens); ok {
+			if typeName != "" {
+				return nil, p.script.errorfAt(first.Pos, "action declaration '%s' cannot have a type annotation", first.Value)
+			}
+			parameterNodes, err := p.parseParameters(parameters)
+			if err != nil {
+				return nil, err
+			}
+			return &ActionDeclarationNode{Pos: first.Pos, Name: first.Value, Parameters: parameterNodes}, nil
+		}
+	}
+
+	value, err := p.parseExpression(valueTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator.Type {
+	case AssignmentToken:
+		return &AssignmentNode{Pos: first.Pos, Name: first.Value, Value: value}, nil
+	case AugmentedAssignmentToken:
+		return &AugmentedAssignmentNode{Pos: first.Pos, Name: first.Value, Operator: operator.Value, Value: value}, nil
+	}
+
+	declaration := &DeclarationNode{Pos: first.Pos, Name: first.Value, TypeName: typeName, Type: AnyType, Value: value}
+	if typeName != "" {
+		if declaration.Type, err = ParseVariableType(typeName); err != nil {
+			return nil, p.script.errorAt(rest[0].Pos, err)
+		}
+	}
+	return declaration, nil
+}
+
+func (p *parser) parseImport(tokens []*Token) (Statement, error) {
+	end := findClosingToken(tokens, 1)
+	if end == 2 {
+		return nil, p.script.errorfAt(tokens[0].Pos, "'%s' requires a module path", ImportString)
+	}
+
+	node := &ImportNode{Pos: tokens[0].Pos}
+	switch rest := tokens[end+1:]; {
+	case len(rest) == 0:
+	case len(rest) == 2 && rest[0].Type == IdentifierToken && rest[0].Value == AliasString && rest[1].Type == IdentifierToken:
+		node.Alias = rest[1].Value
+	default:
+		return nil, p.script.errorfAt(rest[0].Pos, "expected '%s' followed by a name after '%s'", AliasString, ImportString)
+	}
+
+	path, err := p.parseExpression(tokens[2:end])
+	if err != nil {
+		return nil, err
+	}
+	node.Path = path
+	return node, nil
+}
+
+func (p *parser) parseCallStatement(tokens []*Token) (Statement, error) {
+	expression, err := p.parseExpression(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	call, ok := expression.(*CallNode)
+	if !ok {
+		return nil, p.script.errorfAt(tokens[0].Pos, "expected an action call, assignment or declaration")
+	}
+	return &CallStatementNode{Pos: call.Pos, Call: call}, nil
+}
+
+func actionDeclarationParameters(tokens []*Token) ([]*Token, bool) {
+	tokens = trimNewLines(tokens)
+	if len(tokens) < 3 || tokens[0].Type != IdentifierToken || tokens[0].Value != ActionString || tokens[1].Type != ParenOpenToken {
+		return nil, false
+	}
+	if findClosingToken(tokens, 1) != len(tokens)-1 {
+		return nil, false
+	}
+	return tokens[2 : len(tokens)-1], true
+}
+
+func (p *parser) parseExpression(tokens []*Token) (Expression, error) {
+	tokens = trimNewLines(tokens)
+	if len(tokens) == 0 {
+		return nil, p.script.errorfAt(p.peek().Pos, "expected an expression")
+	}
+
+	inner := &parser{script: p.script, tokens: tokens, diagnostics: p.diagnostics}
+	expression, err := inner.parseOperand(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := inner.peekExpression(); token.Type != EOFToken {
+		return nil, p.script.errorfAt(token.Pos, "unexpected '%s' in expression", token.Value)
+	}
+	return expression, nil
+}
+
+func (p *parser) peekExpression() *Token {
+	for p.index < len(p.tokens) && (p.tokens[p.index].Type == NewLineToken || p.tokens[p.index].Type == CommentToken) {
+		p.index++
+	}
+	return p.peek()
+}
+
+func (p *parser) expect(tokenType TokenType, symbol rune, after *Token) (*Token, error) {
+	token := p.peekExpression()
+	if token.Type != tokenType {
+		if token.Type == EOFToken {
+			return nil, p.script.errorfAt(after.Pos, "expected '%c' after '%s'", symbol, after.Value)
+		}
+		return nil, p.script.errorfAt(token.Pos, "expected '%c', got '%s'", symbol, token.Value)
+	}
+	p.index++
+	return token, nil
+}
+
+func (p *parser) parseOperand(precedence int, operator *Token) (Expression, error) {
+	if token := p.peekExpression(); token.Type == EOFToken || token.Type == ParenCloseToken || token.Type == BracketCloseToken || token.Type == DelimiterToken {
+		if operator != nil {
+			return nil, p.script.errorfAt(operator.Pos, "expected operand after %s", operator.Value)
+		}
+		if token.Type != EOFToken {
+			return nil, p.script.errorfAt(token.Pos, "expected an expression, got '%s'", token.Value)
+		}
+		return nil, p.script.errorfAt(token.Pos, "expected an expression")
+	}
+
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token := p.peekExpression()
+		switch token.Type {
+		case ParenOpenToken, BracketOpenToken, DecimalToken:
+			if PostfixPrecedence <= precedence {
+				return left, nil
+			}
+			if left, err = p.parsePostfix(left); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		info, ok := OperatorTable[token.Type]
+		if !ok || info.Precedence <= precedence {
+			return left, nil
+		}
+		p.index++
+
+		next := info.Precedence
+		if info.Associativity == RightAssociative {
+			next--
+		}
+		right, err := p.parseOperand(next, token)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Pos: token.Pos, Operator: token.Type, Symbol: token.Value, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parsePrefix() (Expression, error) {
+	token := p.peekExpression()
+	p.index++
+
+	switch token.Type {
+	case LiteralToken:
+		value, err := parseLiteral(token.Value)
+		if err != nil {
+			return nil, p.script.errorAt(token.Pos, err)
+		}
+		return &LiteralNode{Pos: token.Pos, Raw: token.Value, Value: value}, nil
+	case IdentifierToken:
+		return &IdentifierNode{Pos: token.Pos, Name: token.Value}, nil
+	case OperatorSubtractToken:
+		if literal := p.peekExpression(); isNumberLiteral(literal) && !p.bindsTighterThanPrefix(p.index+1) {
+			p.index++
+			value, err := parseLiteral(token.Value + literal.Value)
+			if err != nil {
+				return nil, p.script.errorAt(literal.Pos, err)
+			}
+			return &LiteralNode{Pos: token.Pos, Raw: token.Value + literal.Value, Value: value}, nil
+		}
+		operand, err := p.parseOperand(PrefixPrecedence, token)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{Pos: token.Pos, Operator: OperatorUnaryMinusToken, Symbol: token.Value, Operand: operand}, nil
+	case LogicalNotToken:
+		operand, err := p.parseOperand(PrefixPrecedence, token)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{Pos: token.Pos, Operator: LogicalNotToken, Symbol: token.Value, Operand: operand}, nil
+	case ParenOpenToken:
+		if end := findClosingToken(p.tokens, p.index-1); end > 0 && end+1 < len(p.tokens) && p.tokens[end+1].Type == ArrowToken {
+			return p.parseLambda(token, end)
+		}
+		expression, err := p.parseOperand(0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(ParenCloseToken, ParenCloseSymbol, token); err != nil {
+			return nil, err
+		}
+		return expression, nil
+	}
+
+	return nil, p.script.errorfAt(token.Pos, "unexpected '%s' in expression", token.Value)
+}
+
+func (p *parser) bindsTighterThanPrefix(index int) bool {
+	if index >= len(p.tokens) {
+		return false
+	}
+	switch token := p.tokens[index]; token.Type {
+	case ParenOpenToken, BracketOpenToken, DecimalToken:
+		return true
+	default:
+		info, ok := OperatorTable[token.Type]
+		return ok && info.Precedence > PrefixPrecedence
+	}
+}
+
+func (p *parser) parsePostfix(left Expression) (Expression, error) {
+	token := p.peekExpression()
+	p.index++
+
+	switch token.Type {
+	case BracketOpenToken:
+		index, err := p.parseOperand(0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(BracketCloseToken, BracketCloseSymbol, token); err != nil {
+			return nil, err
+		}
+		return &IndexNode{Pos: token.Pos, Target: left, Index: index}, nil
+	case DecimalToken:
+		name := p.peekExpression()
+		if name.Type != IdentifierToken {
+			return nil, p.script.errorfAt(token.Pos, "expected a field name after '%c'", DecimalSymbol)
+		}
+		p.index++
+		return &FieldNode{Pos: name.Pos, Target: left, Name: name.Value}, nil
+	}
+
+	call := &CallNode{Pos: left.Position(), Callee: left, Name: qualifiedName(left)}
+	names := make(map[string]bool)
+
+	for {
+		next := p.peekExpression()
+		if next.Type == ParenCloseToken {
+			p.index++
+			return call, nil
+		}
+		if len(call.Arguments) > 0 {
+			if next.Type != DelimiterToken {
+				if next.Type == EOFToken {
+					return nil, p.script.errorfAt(token.Pos, "unclosed '%c'", ParenOpenSymbol)
+				}
+				return nil, p.script.errorfAt(next.Pos, "expected ',' or ')' in call, got '%s'", next.Value)
+			}
+			p.index++
+			next = p.peekExpression()
+		}
+
+		argument := &ArgumentNode{Pos: next.Pos}
+		if next.Type == IdentifierToken && p.index+1 < len(p.tokens) && p.tokens[p.index+1].Type == DeclarationToken {
+			argument.Name = next.Value
+			if names[argument.Name] {
+				return nil, p.script.errorfAt(argument.Pos, "duplicate named argument: %s", argument.Name)
+			}
+			names[argument.Name] = true
+			p.index += 2
+		} else if len(call.Arguments) > 0 && call.Arguments[len(call.Arguments)-1].Name != "" {
+			return nil, p.script.errorfAt(argument.Pos, "positional argument follows a named one in call to '%s'", call.Name)
+		}
+
+		value, err := p.parseOperand(0, nil)
+		if err != nil {
+			return nil, err
+		}
+		argument.Value = value
+		call.Arguments = append(call.Arguments, argument)
+	}
+}
+
+func qualifiedName(expr Expression) string {
+	switch node := expr.(type) {
+	case *IdentifierNode:
+		return node.Name
+	case *FieldNode:
+		if target := qualifiedName(node.Target); target != "" {
+			return target + string(DecimalSymbol) + node.Name
+		}
+	}
+	return ""
+}
+
+func (p *parser) parseParameters(tokens []*Token) ([]*ParameterNode, error) {
+	var parameters []*ParameterNode
+	names := make(map[string]bool)
+	variadic := false
+
+	for _, raw := range splitArguments(tokens) {
+		if len(raw) == 0 {
+			return nil, p.script.errorfAt(tokens[0].Pos, "empty parameter")
+		}
+
+		parameter := &ParameterNode{Pos: raw[0].Pos, Type: AnyType}
+		rest := raw
+		if rest[0].Type == EllipsisToken {
+			parameter.Variadic = true
+			rest = rest[1:]
+		}
+		if len(rest) == 0 || rest[0].Type != IdentifierToken {
+			return nil, p.script.errorfAt(parameter.Pos, "invalid parameter format")
+		}
+		parameter.Name = rest[0].Value
+		rest = rest[1:]
+
+		if names[parameter.Name] {
+			return nil, p.script.errorfAt(parameter.Pos, "duplicate parameter: %s", parameter.Name)
+		}
+		names[parameter.Name] = true
+
+		if len(rest) > 0 && rest[0].Type == ColonToken {
+			if len(rest) < 2 || rest[1].Type != IdentifierToken {
+				return nil, p.script.errorfAt(rest[0].Pos, "expected a type name for parameter '%s'", parameter.Name)
+			}
+			parameterType, err := ParseVariableType(rest[1].Value)
+			if err != nil {
+				return nil, p.script.errorAt(rest[1].Pos, err)
+			}
+			parameter.TypeName, parameter.Type = rest[1].Value, parameterType
+			rest = rest[2:]
+		}
+
+		if len(rest) > 0 {
+			if (rest[0].Type != AssignmentToken && rest[0].Type != DeclarationToken) || len(rest) == 1 {
+				return nil, p.script.errorfAt(rest[0].Pos, "invalid parameter format")
+			}
+			defaultValue, err := p.parseExpression(rest[1:])
+			if err != nil {
+				return nil, err
+			}
+			parameter.Default = defaultValue
+		}
+
+		switch {
+		case parameter.Variadic:
+			if variadic {
+				return nil, p.script.errorfAt(parameter.Pos, "only one variadic parameter is allowed, got '%s'", parameter.Name)
+			}
+			if parameter.Default != nil {
+				return nil, p.script.errorfAt(parameter.Pos, "variadic parameter '%s' cannot have a default value", parameter.Name)
+			}
+			variadic = true
+		case parameter.Default == nil && !variadic && len(parameters) > 0 && parameters[len(parameters)-1].Default != nil:
+			return nil, p.script.errorfAt(parameter.Pos, "required parameter '%s' follows an optional one", parameter.Name)
+		}
+
+		parameters = append(parameters, parameter)
+	}
+
+	return parameters, nil
+}
+
+func (p *parser) parseLambda(open *Token, end int) (*LambdaNode, error) {
+	parameters, err := p.parseParameters(p.tokens[p.index:end])
+	if err != nil {
+		return nil, err
+	}
+	lambda := &LambdaNode{Pos: open.Pos, Parameters: parameters}
+	arrow := p.tokens[end+1]
+	p.index = end + 2
+
+	body := p.peekExpression()
+	if body.Type == CodeBlockOpenToken {
+		close := findClosingToken(p.tokens, p.index)
+		if close < 0 {
+			return nil, p.script.errorfAt(body.Pos, "unmatched opening brace")
+		}
+		inner := &parser{script: p.script, tokens: p.tokens[p.index+1 : close+1], diagnostics: p.diagnostics}
+		if lambda.Body, err = inner.parseBlock(body); err != nil {
+			return nil, err
+		}
+		p.index = close + 1
+		return lambda, nil
+	}
+
+	if lambda.Result, err = p.parseOperand(0, arrow); err != nil {
+		return nil, err
+	}
+	pos := lambda.Result.Position()
+	callee := &IdentifierNode{Pos: pos, Name: ReturnString}
+	lambda.Body = &BlockNode{Pos: pos, Statements: []Statement{&CallStatementNode{
+		Pos:  pos,
+		Call: &CallNode{Pos: pos, Callee: callee, Name: ReturnString, Arguments: []*ArgumentNode{{Pos: pos, Value: lambda.Result}}},
+	}}}
+	return lambda, nil
+}
+
+func isNumberLiteral(token *Token) bool {
+	return token.Type == LiteralToken && !strings.HasPrefix(token.Value, string(StringSymbol)) && token.Value != TrueString && token.Value != FalseString
+}
+
+func findClosingToken(tokens []*Token, start int) int {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case ParenOpenToken, BracketOpenToken, CodeBlockOpenToken:
+			depth++
+		case ParenCloseToken, BracketCloseToken, CodeBlockCloseToken:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func trimNewLines(tokens []*Token) []*Token {
+	for len(tokens) > 0 && (tokens[0].Type == NewLineToken || tokens[0].Type == CommentToken) {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 0 && (tokens[len(tokens)-1].Type == NewLineToken || tokens[len(tokens)-1].Type == CommentToken) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+func splitArguments(tokens []*Token) [][]*Token {
+	var args [][]*Token
+	depth, start := 0, 0
+
+	for i, token := range tokens {
+		switch token.Type {
+		case ParenOpenToken, BracketOpenToken, CodeBlockOpenToken:
+			depth++
+		case ParenCloseToken, BracketCloseToken, CodeBlockCloseToken:
+			depth--
+		case DelimiterToken:
+			if depth == 0 {
+				args = append(args, trimNewLines(tokens[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	if last := trimNewLines(tokens[start:]); len(last) > 0 || len(args) > 0 {
+		args = append(args, last)
+	}
+	return args
+}
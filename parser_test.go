@@ -0,0 +1,142 @@
+// parser_test.go
+package taskwrappr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProgram(t *testing.T) {
+	s, err := NewScript("test.tw", GetBuiltIn())
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+	s.Content = "total: int := 1 + count * 2\nif(total > 3) {\n\tprint(\"big\", sep := \"\")\n}"
+
+	program, err := s.parseContent()
+	if err != nil {
+		t.Fatalf("parseContent returned an error: %s", err)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+
+	declaration, ok := program.Statements[0].(*DeclarationNode)
+	if !ok || declaration.Name != "total" || declaration.Type != IntegerType {
+		t.Fatalf("expected an integer declaration of 'total', got %#v", program.Statements[0])
+	}
+	sum, ok := declaration.Value.(*BinaryNode)
+	if !ok || sum.Operator != OperatorAddToken {
+		t.Fatalf("expected an addition, got %#v", declaration.Value)
+	}
+	if product, ok := sum.Right.(*BinaryNode); !ok || product.Operator != OperatorMultiplyToken {
+		t.Errorf("expected the multiplication to bind tighter, got %#v", sum.Right)
+	}
+	if identifier, ok := sum.Right.(*BinaryNode).Left.(*IdentifierNode); !ok || identifier.Name != "count" || identifier.Pos.Column != 19 {
+		t.Errorf("expected identifier 'count' at column 19, got %#v", sum.Right.(*BinaryNode).Left)
+	}
+
+	statement, ok := program.Statements[1].(*CallStatementNode)
+	if !ok || statement.Call.Name != "if" || statement.Body == nil || len(statement.Body.Statements) != 1 {
+		t.Fatalf("expected an 'if' call with a body, got %#v", program.Statements[1])
+	}
+	print := statement.Body.Statements[0].(*CallStatementNode).Call
+	if len(print.Arguments) != 2 || print.Arguments[1].Name != "sep" || print.Pos.Line != 3 {
+		t.Errorf("expected print with a named 'sep' argument on line 3, got %#v", print)
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	s, err := NewScript("test.tw", GetBuiltIn())
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+	s.MainBlock.Memory.Variables["items"] = NewVariable([]*Variable{NewVariable(3, IntegerType), NewVariable(4, IntegerType)}, ArrayType)
+
+	cases := map[string]interface{}{
+		"1 + 1 == 2 && true":    true,
+		"2 ^ 3 ^ 2":             512.0,
+		"-2 ^ 2":                -4.0,
+		"10 - 4 - 3":            3.0,
+		"!false && false":       false,
+		"1 < 2 == 2 < 3":        true,
+		"2 * items[1] + 1":      9.0,
+		"-items[0]":             -3.0,
+		"true || false ^^ true": true,
+	}
+
+	p := &parser{script: s}
+	for source, expected := range cases {
+		tokens, err := NewLexer("test.tw", source).Tokenize()
+		if err != nil {
+			t.Fatalf("%s: Tokenize returned an error: %s", source, err)
+		}
+		expression, err := p.parseExpression(tokens[:len(tokens)-1])
+		if err != nil {
+			t.Errorf("%s: parseExpression returned an error: %s", source, err)
+			continue
+		}
+		result, err := s.evaluate(expression)
+		if err != nil {
+			t.Errorf("%s: evaluate returned an error: %s", source, err)
+			continue
+		}
+		if result.Value != expected {
+			t.Errorf("%s: expected %v, got %v", source, expected, result.Value)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	s, err := NewScript("test.tw", GetBuiltIn())
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+	s.Content = "x := 1\ny := (x * 2) +\n"
+
+	_, err = s.parseContent()
+	if err == nil || !strings.Contains(err.Error(), "test.tw:2:14: expected operand after +") {
+		t.Errorf("expected an operand error at 2:14, got %v", err)
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	s, err := NewScript("test.tw", GetBuiltIn())
+	if err != nil {
+		t.Errorf("NewScript returned an error: %s", err)
+	}
+	s.Content = "a := 1 +\nprint(a)\nif(a > ) {\n\tb := (2 * 3\n\tprint(b)\n}\nc := 2 ? 3\n}\nd := a\n"
+
+	program, diagnostics := s.Parse()
+	expected := []struct {
+		line, column int
+		message      string
+	}{
+		{1, 8, "expected operand after +"},
+		{3, 6, "expected operand after >"},
+		{4, 7, "unclosed '('"},
+		{7, 8, "unexpected character: '?'"},
+		{7, 10, "unexpected '3' in expression"},
+		{8, 1, "unmatched closing brace"},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %d:\n%s", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, want := range expected {
+		diagnostic := diagnostics[i]
+		if diagnostic.Severity != SeverityError || diagnostic.Pos.Line != want.line || diagnostic.Pos.Column != want.column || diagnostic.Message != want.message {
+			t.Errorf("diagnostic %d: expected %q at %d:%d, got %q at %s (%v)", i, want.message, want.line, want.column, diagnostic.Message, diagnostic.Pos, diagnostic.Severity)
+		}
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected the 2 valid statements to be kept, got %d", len(program.Statements))
+	}
+	if declaration, ok := program.Statements[1].(*DeclarationNode); !ok || declaration.Name != "d" {
+		t.Errorf("expected parsing to resume after the errors, got %#v", program.Statements[1])
+	}
+	if _, err := s.parseContent(); err == nil || !strings.Contains(err.Error(), "test.tw:8:1: unmatched closing brace") {
+		t.Errorf("expected parseContent to report every diagnostic, got %v", err)
+	}
+}
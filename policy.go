@@ -0,0 +1,223 @@
+// policy.go
+package taskwrappr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Capability groups actions are checked against.
+const (
+	CapabilityFSRead  = "fs.read"
+	CapabilityFSWrite = "fs.write"
+	CapabilityExec    = "exec"
+	CapabilityNet     = "net"
+)
+
+// Capability is something a script needs from its Policy: a group,
+// optionally narrowed to a scope. The scope is a path for the fs groups,
+// a command for exec and a host for net. A capability without a scope
+// grants the whole group.
+type Capability struct {
+	Group string
+	Scope string
+}
+
+// ParseCapability reads a capability written as group or group:scope,
+// such as fs.write:/tmp/work, exec:git or net:localhost.
+func ParseCapability(text string) (Capability, error) {
+	group, scope, scoped := strings.Cut(text, ":")
+	switch group {
+	case CapabilityFSRead, CapabilityFSWrite, CapabilityExec, CapabilityNet:
+	default:
+		return Capability{}, fmt.Errorf("unknown capability: %s", text)
+	}
+	if scoped && scope == "" {
+		return Capability{}, fmt.Errorf("capability %s has an empty scope", text)
+	}
+	return Capability{Group: group, Scope: scope}, nil
+}
+
+func (c Capability) String() string {
+	if c.Scope == "" {
+		return c.Group
+	}
+	return c.Group + ":" + c.Scope
+}
+
+// covers tells whether the granted capability c includes required.
+func (c Capability) covers(required Capability) bool {
+	switch {
+	case c.Group != required.Group:
+		return false
+	case c.Scope == "":
+		return true
+	case required.Scope == "":
+		return false
+	}
+
+	switch c.Group {
+	case CapabilityFSRead, CapabilityFSWrite:
+		return withinPath(c.Scope, required.Scope)
+	case CapabilityNet:
+		return c.Scope == required.Scope || c.Scope == hostName(required.Scope)
+	}
+	return c.Scope == required.Scope
+}
+
+// withinPath tells whether path is inside dir once the symlinks of both
+// are resolved, so a link inside dir cannot lead out of it.
+func withinPath(dir, path string) bool {
+	dir, err := resolvePath(dir)
+	if err != nil {
+		return false
+	}
+	path, err = resolvePath(path)
+	if err != nil {
+		return false
+	}
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// resolvePath makes path absolute and resolves the symlinks along it. The
+// part of the path that does not exist yet, such as a file about to be
+// written, is kept as it is after the deepest directory that does.
+func resolvePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		path = dir + string(filepath.Separator) + path
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		i := strings.LastIndexByte(path, filepath.Separator)
+		if i <= 0 {
+			return "", err
+		}
+		missing = append([]string{path[i+1:]}, missing...)
+		path = path[:i]
+	}
+}
+
+func hostName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
+	}
+	return host
+}
+
+// Policy is the set of capabilities a script is granted. Actions that
+// require a capability check it when the script is type checked, if their
+// arguments are constants, and otherwise when they are called. A script
+// without a Policy is granted everything.
+type Policy struct {
+	Capabilities []Capability
+}
+
+func NewPolicy(capabilities ...string) (*Policy, error) {
+	policy := &Policy{}
+	for _, text := range capabilities {
+		capability, err := ParseCapability(text)
+		if err != nil {
+			return nil, err
+		}
+		policy.Capabilities = append(policy.Capabilities, capability)
+	}
+	return policy, nil
+}
+
+func (p *Policy) Allows(required Capability) bool {
+	for _, granted := range p.Capabilities {
+		if granted.covers(required) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsGroup tells whether any capability of group is granted, which is
+// all that can be checked of a call whose scope is not known yet.
+func (p *Policy) allowsGroup(group string) bool {
+	for _, granted := range p.Capabilities {
+		if granted.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyError reports a call of an action the policy of the script does
+// not grant the capability for.
+type PolicyError struct {
+	Action     string
+	Capability Capability
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("'%s' action requires the %s capability", e.Action, e.Capability)
+}
+
+// requirement is the capability group an action needs, and how the scope
+// of a call is told from its bound arguments.
+type requirement struct {
+	group string
+	scope func(args []*Variable) (string, error)
+}
+
+// Requires declares that calls of the action need a capability of group.
+// scope, when given, tells the scope a call needs from its bound
+// arguments.
+func (a *Action) Requires(group string, scope func(args []*Variable) (string, error)) *Action {
+	a.requirement = &requirement{group: group, scope: scope}
+	return a
+}
+
+// checkGroup is what can be checked of a call of action before its
+// arguments are known: that the policy grants some of the group it needs.
+func (p *Policy) checkGroup(action *Action) error {
+	required := Capability{Group: action.requirement.group}
+	if !p.allowsGroup(required.Group) || action.requirement.scope == nil && !p.Allows(required) {
+		return &PolicyError{Action: action.Name, Capability: required}
+	}
+	return nil
+}
+
+// check fails unless the policy grants what a call of action with the
+// bound args needs.
+func (p *Policy) check(action *Action, args []*Variable) error {
+	if err := p.checkGroup(action); err != nil || action.requirement.scope == nil {
+		return err
+	}
+
+	scope, err := action.requirement.scope(args)
+	if err != nil {
+		return err
+	}
+	return p.checkCapability(action.Name, Capability{Group: action.requirement.group, Scope: scope})
+}
+
+// checkCapability fails unless the policy grants required, which the
+// action named name needs.
+func (p *Policy) checkCapability(name string, required Capability) error {
+	if !p.Allows(required) {
+		return &PolicyError{Action: name, Capability: required}
+	}
+	return nil
+}
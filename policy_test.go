@@ -0,0 +1,188 @@
+// policy_test.go
+package taskwrappr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		granted, required string
+		allowed           bool
+	}{
+		{"fs.read", "fs.read:/etc/passwd", true},
+		{"fs.write:/tmp/work", "fs.write:/tmp/work/out.txt", true},
+		{"fs.write:/tmp/work", "fs.write:/tmp/work/../secret", false},
+		{"fs.write:/tmp/work", "fs.write:/tmp/workers", false},
+		{"fs.write:/tmp/work", "fs.read:/tmp/work/out.txt", false},
+		{"exec:git", "exec:git", true},
+		{"exec:git", "exec:rm", false},
+		{"net:localhost", "net:localhost:8080", true},
+		{"net:localhost:8080", "net:localhost:9090", false},
+		{"net:localhost", "net:example.com", false},
+	}
+
+	for _, test := range tests {
+		policy, err := NewPolicy(test.granted)
+		if err != nil {
+			t.Fatalf("NewPolicy(%q) returned an error: %s", test.granted, err)
+		}
+		required, err := ParseCapability(test.required)
+		if err != nil {
+			t.Fatalf("ParseCapability(%q) returned an error: %s", test.required, err)
+		}
+		if allowed := policy.Allows(required); allowed != test.allowed {
+			t.Errorf("%s allows %s: expected %t, got %t", test.granted, test.required, test.allowed, allowed)
+		}
+	}
+
+	for _, text := range []string{"fs", "exec:", "disk.read"} {
+		if _, err := ParseCapability(text); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	source := `exec("git", "status")
+exec("rm", "-rf", "/")
+readFile("/etc/hostname")
+command := "rm"
+exec(command)
+fetch("http://localhost:8080/health")
+`
+	s, _ := NewScriptFromSource("policy.tw", source, GetBuiltIn())
+	s.Policy, _ = NewPolicy("exec:git", "net:localhost")
+
+	diagnostics, err := s.Check()
+	if err != nil {
+		t.Fatalf("Check returned an error: %s", err)
+	}
+	var messages []string
+	for _, diagnostic := range diagnostics {
+		messages = append(messages, diagnostic.Message)
+	}
+	expected := []string{
+		"'exec' action requires the exec:rm capability",
+		"'readFile' action requires the fs.read capability",
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected diagnostics:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(messages, "\n"))
+	}
+}
+
+func TestPolicyCallTime(t *testing.T) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	if err := os.Mkdir(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	source := `write := action(name, content) {
+	writeFile(dir + "/" + name, content)
+}
+write("work/allowed.txt", "ok")
+write("denied.txt", "no")
+`
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["dir"] = NewVariable(dir, StringType)
+		s, _ := NewScriptFromSource("policy.tw", source, memory)
+		s.Engine = engine
+		s.Policy, _ = NewPolicy("fs.write:" + work)
+
+		err := s.Run()
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) {
+			t.Fatalf("expected a policy error, got %v", err)
+		}
+		if policyErr.Action != "writeFile" || policyErr.Capability.String() != "fs.write:"+dir+"/denied.txt" {
+			t.Errorf("unexpected policy error: %s", policyErr)
+		}
+
+		if content, err := os.ReadFile(filepath.Join(work, "allowed.txt")); err != nil || string(content) != "ok" {
+			t.Errorf("expected the allowed write to happen, got %q (%v)", content, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "denied.txt")); err == nil {
+			t.Errorf("expected the denied write not to happen")
+		}
+	})
+}
+
+func TestPolicySymlinks(t *testing.T) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	etc := filepath.Join(dir, "etc")
+	for _, path := range []string{work, etc} {
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(etc, "passwd"), []byte("root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(etc, filepath.Join(work, "etc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(etc, "passwd"), filepath.Join(work, "passwd")); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, _ := NewPolicy("fs.read:"+work, "fs.write:"+work)
+	tests := []struct {
+		required string
+		allowed  bool
+	}{
+		{"fs.read:" + work + "/etc/passwd", false},
+		{"fs.write:" + work + "/etc/shadow", false},
+		{"fs.write:" + work + "/passwd", false},
+		{"fs.write:" + work + "/etc/../new.txt", false},
+		{"fs.write:" + work + "/new/out.txt", true},
+	}
+	for _, test := range tests {
+		required, _ := ParseCapability(test.required)
+		if allowed := policy.Allows(required); allowed != test.allowed {
+			t.Errorf("granted %s allows %s: expected %t, got %t", work, test.required, test.allowed, allowed)
+		}
+	}
+}
+
+func TestPolicyRedirect(t *testing.T) {
+	reached := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer target.Close()
+	granted := httptest.NewServer(http.RedirectHandler(target.URL+"/secret", http.StatusFound))
+	defer granted.Close()
+
+	grantedURL, _ := url.Parse(granted.URL)
+	targetURL, _ := url.Parse(target.URL)
+
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["address"] = NewVariable(granted.URL, StringType)
+		s, _ := NewScriptFromSource("redirect.tw", "fetch(address)\n", memory)
+		s.Engine = engine
+		s.Policy, _ = NewPolicy("net:" + grantedURL.Host)
+
+		err := s.Run()
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) {
+			t.Fatalf("expected a policy error, got %v", err)
+		}
+		if policyErr.Capability.String() != "net:"+targetURL.Host {
+			t.Errorf("unexpected policy error: %s", policyErr)
+		}
+		if reached {
+			t.Errorf("expected the redirect not to be followed")
+		}
+	})
+}
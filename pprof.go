@@ -0,0 +1,206 @@
+// pprof.go
+package taskwrappr
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Field numbers of the profile.proto messages go tool pprof reads.
+const (
+	profileSampleTypeField   = 1
+	profileSampleField       = 2
+	profileLocationField     = 4
+	profileFunctionField     = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format of
+// go tool pprof. Every sample is a call stack with the number of calls
+// made from it and the wall and wait time spent in it.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mutex.Lock()
+	encoder := newProfileEncoder()
+	sampleTypes := [][2]string{{"calls", "count"}, {"wall", "nanoseconds"}, {"wait", "nanoseconds"}}
+	for _, sampleType := range sampleTypes {
+		var valueType protoBuffer
+		valueType.int(valueTypeType, encoder.string(sampleType[0]))
+		valueType.int(valueTypeUnit, encoder.string(sampleType[1]))
+		encoder.profile.message(profileSampleTypeField, valueType)
+	}
+
+	for _, sample := range p.samples {
+		var ids []int64
+		if sample.function != "" {
+			ids = append(ids, encoder.location(profileLocation{Function: sample.function}))
+		}
+		for node := sample.node; node.parent != nil; node = node.parent {
+			ids = append(ids, encoder.node(node))
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		var message protoBuffer
+		message.packed(sampleLocationID, ids...)
+		message.packed(sampleValue, sample.calls, int64(sample.wall), int64(sample.wait))
+		encoder.profile.message(profileSampleField, message)
+	}
+
+	if !p.started.IsZero() {
+		encoder.profile.int(profileTimeNanos, p.started.UnixNano())
+	}
+	encoder.profile.int(profileDurationNanos, int64(p.duration))
+	encoder.profile.int(profileDefaultSampleType, encoder.string("wall"))
+	p.mutex.Unlock()
+
+	profile := encoder.finish()
+	compressed := gzip.NewWriter(w)
+	if _, err := compressed.Write(profile); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+type profileEncoder struct {
+	profile   protoBuffer
+	trailer   protoBuffer
+	strings   map[string]int64
+	table     []string
+	functions map[[2]string]int64
+	locations map[profileLocation]int64
+	nodes     map[*profileNode]int64
+}
+
+func newProfileEncoder() *profileEncoder {
+	return &profileEncoder{
+		strings:   map[string]int64{"": 0},
+		table:     []string{""},
+		functions: make(map[[2]string]int64),
+		locations: make(map[profileLocation]int64),
+		nodes:     make(map[*profileNode]int64),
+	}
+}
+
+func (e *profileEncoder) string(s string) int64 {
+	if index, ok := e.strings[s]; ok {
+		return index
+	}
+	index := int64(len(e.table))
+	e.strings[s] = index
+	e.table = append(e.table, s)
+	return index
+}
+
+func (e *profileEncoder) function(name, file string) int64 {
+	key := [2]string{name, file}
+	if id, ok := e.functions[key]; ok {
+		return id
+	}
+	id := int64(len(e.functions) + 1)
+	e.functions[key] = id
+
+	var message protoBuffer
+	message.int(functionID, id)
+	message.int(functionName, e.string(name))
+	message.int(functionSystemName, e.string(name))
+	message.int(functionFilename, e.string(file))
+	e.trailer.message(profileFunctionField, message)
+	return id
+}
+
+func (e *profileEncoder) location(location profileLocation) int64 {
+	if id, ok := e.locations[location]; ok {
+		return id
+	}
+	id := int64(len(e.locations) + 1)
+	e.locations[location] = id
+
+	var line protoBuffer
+	line.int(lineFunctionID, e.function(location.Function, location.File))
+	line.int(lineLine, int64(location.Line))
+
+	var message protoBuffer
+	message.int(locationID, id)
+	message.message(locationLine, line)
+	e.trailer.message(profileLocationField, message)
+	return id
+}
+
+// node returns the location of the innermost line of node, looked up once
+// for all the samples that share it.
+func (e *profileEncoder) node(node *profileNode) int64 {
+	if id, ok := e.nodes[node]; ok {
+		return id
+	}
+	id := e.location(node.location)
+	e.nodes[node] = id
+	return id
+}
+
+// finish appends the locations, functions and string table, which are
+// only complete once every sample is encoded.
+func (e *profileEncoder) finish() []byte {
+	profile := append(e.profile, e.trailer...)
+	for _, s := range e.table {
+		profile.bytes(profileStringTable, []byte(s))
+	}
+	return profile
+}
+
+// protoBuffer encodes protocol buffer fields, just the varint and length
+// delimited kinds a profile is made of.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *protoBuffer) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuffer) message(field int, message protoBuffer) {
+	b.bytes(field, message)
+}
+
+func (b *protoBuffer) packed(field int, values ...int64) {
+	var data protoBuffer
+	for _, value := range values {
+		data.varint(uint64(value))
+	}
+	b.bytes(field, data)
+}
@@ -0,0 +1,302 @@
+// profiler.go
+package taskwrappr
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mainFrameName = "main"
+
+// ProfileEntry is what a profile knows about one action or one source
+// line. Total is the wall time spent in it including what it called, Self
+// excludes that, and Wait is the part of Total spent sleeping in wait.
+type ProfileEntry struct {
+	Name  string
+	Pos   Position
+	Calls int
+	Total time.Duration
+	Self  time.Duration
+	Wait  time.Duration
+
+	active int // frames of it on the stack
+}
+
+// Profiler records where a script spends its time, per action and per
+// source line. Scripts being profiled run on the tree engine, like the
+// ones being debugged. A profiler can be shared by several runs, their
+// times add up.
+type Profiler struct {
+	mutex    sync.Mutex
+	actions  map[string]*ProfileEntry
+	lines    map[Position]*ProfileEntry
+	stack    []*profileFrame
+	root     *profileNode
+	samples  []*profileSample
+	started  time.Time
+	duration time.Duration
+	waiting  time.Duration
+	now      func() time.Time
+}
+
+type profileFrame struct {
+	entry    *ProfileEntry
+	function string
+	line     bool
+	start    time.Time
+	children time.Duration
+	node     *profileNode
+	sample   *profileSample
+}
+
+// profileNode is a stack of lines in the tree of the stacks seen so far,
+// with the samples of the stacks that end in it: at the line itself or at
+// an action called from it that has not run a line yet.
+type profileNode struct {
+	parent   *profileNode
+	location profileLocation
+	children map[profileLocation]*profileNode
+	sample   *profileSample
+	actions  map[string]*profileSample
+}
+
+// profileSample accumulates the self time of one call stack, the lines of
+// node and, when it is set, the action function called from the innermost
+// one. Lines are located in the action they belong to; an action only has
+// a location of its own while it is innermost, before it runs any line.
+type profileSample struct {
+	node     *profileNode
+	function string
+	calls    int64
+	wall     time.Duration
+	wait     time.Duration
+}
+
+type profileLocation struct {
+	Function string
+	File     string
+	Line     int
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		actions: make(map[string]*ProfileEntry),
+		lines:   make(map[Position]*ProfileEntry),
+		root:    &profileNode{},
+		now:     time.Now,
+	}
+}
+
+// Actions returns the entries of the actions called, the most expensive
+// first.
+func (p *Profiler) Actions() []*ProfileEntry {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entries := make([]*ProfileEntry, 0, len(p.actions))
+	for _, entry := range p.actions {
+		entries = append(entries, entry)
+	}
+	return sortEntries(entries)
+}
+
+// Lines returns the entries of the source lines run, the most expensive
+// first.
+func (p *Profiler) Lines() []*ProfileEntry {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entries := make([]*ProfileEntry, 0, len(p.lines))
+	for _, entry := range p.lines {
+		entries = append(entries, entry)
+	}
+	return sortEntries(entries)
+}
+
+func sortEntries(entries []*ProfileEntry) []*ProfileEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Total != entries[j].Total {
+			return entries[i].Total > entries[j].Total
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// Duration is the wall time of all the runs profiled.
+func (p *Profiler) Duration() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.duration
+}
+
+// WriteSummary writes the top n actions and lines by total time as text.
+func (p *Profiler) WriteSummary(w io.Writer, n int) error {
+	p.mutex.Lock()
+	duration, waiting := p.duration, p.waiting
+	p.mutex.Unlock()
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "wall time %v, waiting %v\n", roundDuration(duration), roundDuration(waiting))
+	for _, section := range []struct {
+		title   string
+		entries []*ProfileEntry
+	}{{"actions", p.Actions()}, {"lines", p.Lines()}} {
+		fmt.Fprintf(&summary, "\n%s\n%12s %12s %12s %8s  %s\n", section.title, "total", "self", "wait", "calls", "name")
+		for i, entry := range section.entries {
+			if i == n {
+				break
+			}
+			fmt.Fprintf(&summary, "%12v %12v %12v %8d  %s\n", roundDuration(entry.Total), roundDuration(entry.Self), roundDuration(entry.Wait), entry.Calls, entry.Name)
+		}
+	}
+
+	_, err := io.WriteString(w, summary.String())
+	return err
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func (p *Profiler) begin() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.stack = nil
+	p.started = p.now()
+}
+
+func (p *Profiler) end() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.duration += p.now().Sub(p.started)
+}
+
+// intercept is the interceptor a profiled script runs its actions through.
+func (p *Profiler) intercept(s *Script, name string, args []*Variable, next Invocation) ([]*Variable, error) {
+	p.mutex.Lock()
+	entry := p.actions[name]
+	if entry == nil {
+		entry = &ProfileEntry{Name: name}
+		p.actions[name] = entry
+	}
+	p.push(&profileFrame{entry: entry, function: name})
+	p.mutex.Unlock()
+
+	defer p.leave()
+	return next(args)
+}
+
+// enterLine starts timing the statement at pos, leave stops it.
+func (p *Profiler) enterLine(pos Position) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := Position{File: pos.File, Line: pos.Line}
+	entry := p.lines[key]
+	if entry == nil {
+		entry = &ProfileEntry{Name: fmt.Sprintf("%s:%d", pos.File, pos.Line), Pos: key}
+		p.lines[key] = entry
+	}
+
+	function := mainFrameName
+	if len(p.stack) > 0 {
+		function = p.stack[len(p.stack)-1].function
+	}
+	p.push(&profileFrame{entry: entry, function: function, line: true})
+}
+
+func (p *Profiler) push(frame *profileFrame) {
+	parent := p.root
+	if len(p.stack) > 0 {
+		parent = p.stack[len(p.stack)-1].node
+	}
+	if frame.line {
+		frame.node = p.child(parent, profileLocation{Function: frame.function, File: frame.entry.Pos.File, Line: frame.entry.Pos.Line})
+		frame.sample = frame.node.sample
+	} else {
+		frame.node = parent
+		frame.sample = p.actionSample(parent, frame.function)
+	}
+
+	frame.entry.Calls++
+	frame.entry.active++
+	frame.start = p.now()
+	p.stack = append(p.stack, frame)
+	frame.sample.calls++
+}
+
+func (p *Profiler) leave() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	frame := p.stack[len(p.stack)-1]
+	elapsed := p.now().Sub(frame.start)
+	self := elapsed - frame.children
+	frame.entry.Self += self
+	frame.sample.wall += self
+
+	p.stack = p.stack[:len(p.stack)-1]
+	if frame.entry.active--; frame.entry.active == 0 {
+		frame.entry.Total += elapsed
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+// waited adds time spent sleeping to everything on the stack.
+func (p *Profiler) waited(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.waiting += d
+	counted := make(map[*ProfileEntry]bool)
+	for _, frame := range p.stack {
+		if !counted[frame.entry] {
+			counted[frame.entry] = true
+			frame.entry.Wait += d
+		}
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].sample.wait += d
+	}
+}
+
+// child returns the node of the line at location run from parent.
+func (p *Profiler) child(parent *profileNode, location profileLocation) *profileNode {
+	node := parent.children[location]
+	if node == nil {
+		node = &profileNode{parent: parent, location: location}
+		node.sample = p.newSample(node, "")
+		if parent.children == nil {
+			parent.children = make(map[profileLocation]*profileNode)
+		}
+		parent.children[location] = node
+	}
+	return node
+}
+
+// actionSample returns the sample of the action function called from the
+// innermost line of node.
+func (p *Profiler) actionSample(node *profileNode, function string) *profileSample {
+	sample := node.actions[function]
+	if sample == nil {
+		sample = p.newSample(node, function)
+		if node.actions == nil {
+			node.actions = make(map[string]*profileSample)
+		}
+		node.actions[function] = sample
+	}
+	return sample
+}
+
+func (p *Profiler) newSample(node *profileNode, function string) *profileSample {
+	sample := &profileSample{node: node, function: function}
+	p.samples = append(p.samples, sample)
+	return sample
+}
@@ -0,0 +1,91 @@
+// profiler_test.go
+package taskwrappr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const profiledSource = `slow := action(n) {
+	wait(n)
+	return(n * 2)
+}
+total := 0
+total += slow(20)
+total += slow(30)
+print("total", total)
+`
+
+func TestProfiler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiled.tw")
+	if err := os.WriteFile(path, []byte(profiledSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScript(path, GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Engine = BytecodeEngine
+	s.Profiler = NewProfiler()
+	var output strings.Builder
+	s.Stdout = &output
+
+	if err := s.Run(); err != nil {
+		t.Errorf("Run returned an error: %s", err)
+	}
+	if output.String() != "total 100\n" {
+		t.Errorf("expected the script to run, got %q", output.String())
+	}
+
+	actions := make(map[string]*ProfileEntry)
+	for _, entry := range s.Profiler.Actions() {
+		actions[entry.Name] = entry
+	}
+	if entry := actions["slow"]; entry == nil || entry.Calls != 2 || entry.Wait < 50*time.Millisecond || entry.Total < entry.Wait {
+		t.Errorf("expected two slow calls waiting 50ms, got %+v", entry)
+	}
+	if entry := actions["wait"]; entry == nil || entry.Self < 50*time.Millisecond {
+		t.Errorf("expected wait to spend its own time, got %+v", entry)
+	}
+	if entry := actions["slow"]; entry != nil && entry.Self >= entry.Wait {
+		t.Errorf("expected the wait not to count as self time of slow, got %+v", entry)
+	}
+
+	lines := s.Profiler.Lines()
+	if len(lines) == 0 || lines[0].Pos.Line != 2 || lines[0].Calls != 2 {
+		t.Errorf("expected line 2 to be the most expensive, got %+v", lines)
+	}
+
+	var summary strings.Builder
+	if err := s.Profiler.WriteSummary(&summary, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(summary.String(), "  slow\n") || strings.Contains(summary.String(), "  print\n") {
+		t.Errorf("expected a summary of the top action only, got:\n%s", summary.String())
+	}
+
+	var profile bytes.Buffer
+	if err := s.Profiler.WritePprof(&profile); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(&profile)
+	if err != nil {
+		t.Fatalf("expected a gzipped profile: %s", err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"wall", "wait", "slow", path} {
+		if !bytes.Contains(content, []byte(name)) {
+			t.Errorf("expected %q in the profile's string table", name)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// repl.go
+package taskwrappr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	replPath           = "<repl>"
+	replPrompt         = ">>> "
+	replContinuePrompt = "... "
+	replCommandPrefix  = ":"
+)
+
+// REPL evaluates input one entry at a time in a memory that lives for
+// the whole session, so later entries see what earlier ones declared.
+// Entries always run on the tree engine.
+type REPL struct {
+	Script      *Script
+	History     []string
+	HistoryFile string
+}
+
+func NewREPL(memory *MemoryMap) (*REPL, error) {
+	s, err := NewScript(replPath, memory)
+	if err != nil {
+		return nil, err
+	}
+	s.Optimize = false
+	s.modules = newModuleCache(s.Path)
+
+	return &REPL{Script: s}, nil
+}
+
+// Run reads entries from in until it is exhausted or the :quit command,
+// writing results and errors to out, along with what the entries print
+// unless the script has a Stdout of its own. An entry continues over several
+// lines until its code blocks are closed.
+func (r *REPL) Run(in io.Reader, out io.Writer) error {
+	r.loadHistory()
+	if r.Script.Stdout == nil {
+		r.Script.Stdout = out
+		defer func() { r.Script.Stdout = nil }()
+	}
+
+	scanner := bufio.NewScanner(in)
+	var pending strings.Builder
+
+	fmt.Fprint(out, replPrompt)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), replCommandPrefix) {
+			command := strings.TrimSpace(line)
+			r.record(command)
+			if !r.command(command, out) {
+				return nil
+			}
+			fmt.Fprint(out, replPrompt)
+			continue
+		}
+
+		pending.WriteString(line + string(NewLineSymbol))
+		if openBlocks(pending.String()) > 0 {
+			fmt.Fprint(out, replContinuePrompt)
+			continue
+		}
+
+		entry := strings.TrimSpace(pending.String())
+		pending.Reset()
+		if entry != "" {
+			r.record(entry)
+			r.show(entry, out)
+		}
+		fmt.Fprint(out, replPrompt)
+	}
+	return scanner.Err()
+}
+
+// Eval runs source in the session. It returns the value of source when it
+// is a single expression, otherwise the first result of its last statement.
+func (r *REPL) Eval(source string) (*Variable, error) {
+	value, _, err := r.eval(replPath, source)
+	return value, err
+}
+
+// Load runs a script file in the session, leaving what it declares behind.
+func (r *REPL) Load(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = r.eval(path, string(content))
+	return err
+}
+
+// eval also reports whether the value is worth showing, which it is not
+// for nil results and for statements with a code block.
+func (r *REPL) eval(path, source string) (*Variable, bool, error) {
+	s := r.Script
+	defer func() { s.Path = replPath }()
+	s.Path, s.Content = path, source
+	s.CurrentBlock = s.MainBlock
+	s.returning, s.returnValues = false, nil
+
+	program, diagnostics := s.Parse()
+	if diagnostics.HasErrors() {
+		expression, err := s.parseExpressionSource(path, source)
+		if err != nil {
+			return nil, false, diagnostics
+		}
+		value, err := s.evaluate(expression)
+		return value, err == nil, err
+	}
+
+	if err := s.checkTypes(program); err != nil {
+		return nil, false, err
+	}
+	s.MainBlock.Actions = nil
+	s.MainBlock.LastResult = nil
+	s.buildBlock(program, s.MainBlock)
+	if err := s.runBlock(s.MainBlock); err != nil {
+		return nil, false, err
+	}
+
+	value := s.MainBlock.LastResult
+	show := value != nil && value.Type != NilType
+	if statements := program.Statements; len(statements) > 0 {
+		if statement, ok := statements[len(statements)-1].(*CallStatementNode); ok && statement.Body != nil {
+			show = false
+		}
+	}
+	return value, show, nil
+}
+
+// parseExpressionSource parses source as a single expression.
+func (s *Script) parseExpressionSource(path, source string) (Expression, error) {
+	tokens, diagnostics := NewLexer(path, source).TokenizeAll()
+	if err := diagnostics.Err(); err != nil {
+		return nil, err
+	}
+
+	tokens = trimNewLines(tokens[:len(tokens)-1])
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("expected an expression")
+	}
+	p := &parser{script: s, tokens: tokens}
+	return p.parseExpression(tokens)
+}
+
+func (r *REPL) show(entry string, out io.Writer) {
+	value, show, err := r.eval(replPath, entry)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+	if show {
+		fmt.Fprintf(out, "%s (%v)\n", formatValue(value), value.Type)
+	}
+}
+
+// command runs a REPL command and reports whether the session goes on.
+func (r *REPL) command(command string, out io.Writer) bool {
+	name, argument, _ := strings.Cut(strings.TrimPrefix(command, replCommandPrefix), string(SpaceSymbol))
+	argument = strings.TrimSpace(argument)
+
+	switch name {
+	case "quit", "exit":
+		return false
+	case "vars":
+		for _, name := range r.names(func(m *MemoryMap) []string { return mapKeys(m.Variables) }) {
+			variable := r.Script.MainBlock.Memory.GetVariable(name)
+			fmt.Fprintf(out, "%s%c %v = %s\n", name, DeclarationSymbol, variable.Type, formatValue(variable))
+		}
+	case "actions":
+		for _, name := range r.names(func(m *MemoryMap) []string { return mapKeys(m.Actions) }) {
+			action := r.Script.MainBlock.Memory.GetAction(name)
+			if action.Signature != nil {
+				fmt.Fprintln(out, name+action.Signature.String())
+			} else {
+				fmt.Fprintln(out, name+"(...)")
+			}
+		}
+	case "load":
+		if argument == "" {
+			fmt.Fprintln(out, "usage: :load <file>")
+		} else if err := r.Load(argument); err != nil {
+			fmt.Fprintln(out, err)
+		}
+	case "history":
+		for i, entry := range r.History {
+			fmt.Fprintf(out, "%4d  %s\n", i+1, entry)
+		}
+	case "help":
+		fmt.Fprintln(out, ":vars           list variables")
+		fmt.Fprintln(out, ":actions        list actions and their signatures")
+		fmt.Fprintln(out, ":load <file>    run a script in this session")
+		fmt.Fprintln(out, ":history        list previous entries")
+		fmt.Fprintln(out, ":quit           leave the REPL")
+	default:
+		fmt.Fprintf(out, "unknown command: %s (try :help)\n", command)
+	}
+	return true
+}
+
+// names lists the names visible from the session scope, sorted.
+func (r *REPL) names(keys func(*MemoryMap) []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for memory := r.Script.MainBlock.Memory; memory != nil; memory = memory.Parent {
+		for _, name := range keys(memory) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mapKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func formatValue(v *Variable) string {
+	if v.Type == StringType {
+		return quoteString(v.Value.(string))
+	}
+	return formatVariable(v)
+}
+
+// openBlocks counts the code blocks source leaves open.
+func openBlocks(source string) int {
+	tokens, _ := NewLexer(replPath, source).TokenizeAll()
+	depth := 0
+	for _, token := range tokens {
+		switch token.Type {
+		case CodeBlockOpenToken:
+			depth++
+		case CodeBlockCloseToken:
+			depth--
+		}
+	}
+	return depth
+}
+
+func (r *REPL) loadHistory() {
+	if r.HistoryFile == "" {
+		return
+	}
+	content, err := os.ReadFile(r.HistoryFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), string(NewLineSymbol)) {
+		if line != "" {
+			r.History = append(r.History, line)
+		}
+	}
+}
+
+// record adds an entry to the history, and to the history file when there
+// is one. Entries spanning several lines are stored line by line.
+func (r *REPL) record(entry string) {
+	r.History = append(r.History, entry)
+	if r.HistoryFile == "" {
+		return
+	}
+
+	file, err := os.OpenFile(r.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, entry)
+}
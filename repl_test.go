@@ -0,0 +1,58 @@
+// repl_test.go
+package taskwrappr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	memory := GetBuiltIn()
+	memory.Variables["base"] = NewVariable(10, IntegerType)
+
+	repl, err := NewREPL(memory)
+	if err != nil {
+		t.Fatalf("NewREPL returned an error: %s", err)
+	}
+
+	input := strings.Join([]string{
+		"x := base + 1",
+		"add := action(n: int) {",
+		"\treturn(n + x)",
+		"}",
+		"add(2)",
+		"x ^ 2 > 100",
+		"missing",
+		":vars",
+		":actions",
+		":quit",
+		"x",
+	}, "\n")
+
+	var out strings.Builder
+	if err := repl.Run(strings.NewReader(input), &out); err != nil {
+		t.Errorf("Run returned an error: %s", err)
+	}
+
+	for _, expected := range []string{
+		">>> 11 (float)\n",
+		"... ... >>> 13 (float)\n",
+		">>> true (boolean)\n",
+		"undefined variable: missing",
+		"base: integer = 10\n",
+		"x: float = 11\n",
+		"add(n: integer) -> any\n",
+		"print(...values, sep: string = \" \", end: string = \"\\n\") -> nil\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+	if strings.HasSuffix(out.String(), "11 (float)\n") || len(repl.History) != 8 {
+		t.Errorf("expected the session to end at :quit with 8 entries, got %d:\n%s", len(repl.History), out.String())
+	}
+
+	if value, err := repl.Eval("x * 2"); err != nil || value.Value != 22.0 {
+		t.Errorf("expected Eval to see the session scope, got %v (%v)", value, err)
+	}
+}
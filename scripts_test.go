@@ -0,0 +1,161 @@
+// scripts_test.go
+package taskwrappr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var engines = []Engine{TreeEngine, BytecodeEngine}
+
+func forEachEngine(t *testing.T, test func(t *testing.T, engine Engine)) {
+	for _, engine := range engines {
+		t.Run(engine.String(), func(t *testing.T) {
+			test(t, engine)
+		})
+	}
+}
+
+// runScript runs the script at path and returns what it printed.
+func runScript(t *testing.T, path string, memory *MemoryMap, engine Engine) string {
+	t.Helper()
+
+	s, err := NewScript(path, memory)
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Engine = engine
+	var output strings.Builder
+	s.Stdout = &output
+
+	if err := s.Run(); err != nil {
+		t.Errorf("run returned an error: %s", err)
+	}
+	return output.String()
+}
+
+const actionsOutput = `first-class action
+again
+again
+from map 2
+from array 3
+nested
+nested
+map[build:<action print> kind:<action type>] [<action print> <action print> <action twice>]
+`
+
+func TestFirstClassActions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		output := runScript(t, "scripts/actions.tw", memory, engine)
+		if output != actionsOutput {
+			t.Errorf("expected output:\n%s\ngot:\n%s", actionsOutput, output)
+		}
+
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		memory.Variables["hostAction"] = NewVariable(NewAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+			return []*Variable{NewVariable(len(args), IntegerType)}, nil
+		}, nil), ActionType)
+
+		runScript(t, "scripts/actions_host.tw", memory, engine)
+		if result := memory.Variables["result"]; result.Type != IntegerType || result.Value != 3 {
+			t.Errorf("expected result to be 3, got %v (%v)", result.Value, result.Type)
+		}
+	})
+}
+
+func TestLambdas(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		runScript(t, "scripts/lambdas.tw", memory, engine)
+
+		if result, err := memory.Variables["result"].toFloat(); err != nil || result != 8 {
+			t.Errorf("expected result to be 8, got %v (%v)", memory.Variables["result"].Value, err)
+		}
+	})
+}
+
+func TestParameters(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		runScript(t, "scripts/parameters.tw", memory, engine)
+
+		if result := memory.Variables["result"]; result.Type != IntegerType || result.Value != 2 {
+			t.Errorf("expected result to be 2, got %v (%v)", result.Value, result.Type)
+		}
+	})
+}
+
+func TestArgumentBinding(t *testing.T) {
+	signature := NewSignature(AnyType,
+		NewParameter("target", AnyType),
+		NewDefaultParameter("env", StringType, NewVariable("staging", StringType)),
+		NewVariadicParameter("hosts", AnyType),
+		NewDefaultParameter("sep", StringType, NewVariable(",", StringType)),
+	)
+
+	bound, err := signature.Bind("deploy", []*Variable{NewVariable("api", StringType), NewVariable("prod", StringType), NewVariable("a", StringType)}, map[string]*Variable{"sep": NewVariable("+", StringType)})
+	if err != nil {
+		t.Fatalf("Bind returned an error: %s", err)
+	}
+
+	expected := []interface{}{"api", "prod", "+", "a"}
+	if len(bound) != len(expected) {
+		t.Fatalf("expected %d bound arguments, got %d", len(expected), len(bound))
+	}
+	for i, value := range expected {
+		if bound[i].Value != value {
+			t.Errorf("argument %d: expected %v, got %v", i, value, bound[i].Value)
+		}
+	}
+
+	failures := map[string]map[string]*Variable{
+		"missing required argument(s): target": nil,
+		"no parameter named 'region'":          {"target": NewVariable("api", StringType), "region": NewVariable("eu", StringType)},
+	}
+	for expectedError, named := range failures {
+		if _, err := signature.Bind("deploy", nil, named); err == nil || !strings.Contains(err.Error(), expectedError) {
+			t.Errorf("expected error containing %q, got %v", expectedError, err)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+		runScript(t, "scripts/modules.tw", memory, engine)
+
+		if result := memory.Variables["result"]; result.Value != "*hello, again*" {
+			t.Errorf("expected result to be *hello, again*, got %v", result.Value)
+		}
+	})
+}
+
+func TestImportCycle(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dir := t.TempDir()
+		for name, content := range map[string]string{
+			"a.tw": "import(\"b.tw\")\n",
+			"b.tw": "import(\"a\")\n",
+		} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s, err := NewScript(filepath.Join(dir, "a.tw"), GetBuiltIn())
+		if err != nil {
+			t.Fatalf("NewScript returned an error: %s", err)
+		}
+		s.Engine = engine
+		if err := s.Run(); err == nil || !strings.Contains(err.Error(), "import cycle: a.tw -> b.tw -> a.tw") {
+			t.Errorf("expected an import cycle error, got %v", err)
+		}
+	})
+}
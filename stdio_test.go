@@ -0,0 +1,80 @@
+// stdio_test.go
+package taskwrappr
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStdio(t *testing.T) {
+	source := `name := input("name? ")
+print("hello", name)
+eprint("warning:", "no greeting for", input(), sep := "-")
+print(input())
+`
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		s, _ := NewScriptFromSource("stdio.tw", source, GetBuiltIn())
+		s.Engine = engine
+
+		var stdout, stderr strings.Builder
+		s.Stdout, s.Stderr = &stdout, &stderr
+		s.Stdin = strings.NewReader("ada\r\nbob\n")
+
+		if err := s.Run(); err != nil {
+			t.Fatalf("run returned an error: %s", err)
+		}
+		if expected := "name? hello ada\nnil\n"; stdout.String() != expected {
+			t.Errorf("expected stdout %q, got %q", expected, stdout.String())
+		}
+		if expected := "warning:-no greeting for-bob\n"; stderr.String() != expected {
+			t.Errorf("expected stderr %q, got %q", expected, stderr.String())
+		}
+	})
+}
+
+func TestStdinRuns(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "prompt.tw"), []byte("print(input())\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		s, _ := NewScriptFromSource(filepath.Join(dir, "main.tw"), "import(\"prompt.tw\")\nprint(input())\n", GetBuiltIn())
+		s.Engine = engine
+
+		for _, input := range []string{"ada\nbob\n", "cy\ndee\n"} {
+			var stdout strings.Builder
+			s.Stdout = &stdout
+			s.Stdin = strings.NewReader(input)
+
+			if err := s.Run(); err != nil {
+				t.Fatalf("run returned an error: %s", err)
+			}
+			if stdout.String() != input {
+				t.Errorf("expected the module and the script to read %q in turn, got %q", input, stdout.String())
+			}
+		}
+	})
+}
+
+func TestLogger(t *testing.T) {
+	s, _ := NewScriptFromSource("logger.tw", "x := 1\ndelete(x)\n", GetBuiltIn())
+	var stdout strings.Builder
+	var logs bytes.Buffer
+	s.Stdout = &stdout
+	s.Logger = log.New(&logs, "", 0)
+
+	if err := s.Run(); err != nil {
+		t.Fatalf("run returned an error: %s", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected nothing on stdout, got %q", stdout.String())
+	}
+	if !strings.HasSuffix(logs.String(), "delete: deleted x\n") {
+		t.Errorf("expected the deletion to be logged, got %q", logs.String())
+	}
+}
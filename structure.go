@@ -2,12 +2,18 @@
 package taskwrappr
 
 import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "log"
     "os"
 )
 
 type Token struct {
 	Type  TokenType
 	Value string
+	Pos   Position
 }
 
 func (t TokenType) String() string {
@@ -46,6 +52,26 @@ func (t TokenType) String() string {
 		return "DelimiterToken"
 	case DecimalToken:
 		return "DecimalToken"
+	case IdentifierToken:
+		return "IdentifierToken"
+	case ColonToken:
+		return "ColonToken"
+	case BracketOpenToken:
+		return "BracketOpenToken"
+	case BracketCloseToken:
+		return "BracketCloseToken"
+	case ArrowToken:
+		return "ArrowToken"
+	case EllipsisToken:
+		return "EllipsisToken"
+	case SeparatorToken:
+		return "SeparatorToken"
+	case NewLineToken:
+		return "NewLineToken"
+	case CommentToken:
+		return "CommentToken"
+	case EOFToken:
+		return "EOFToken"
 	case LogicalAndToken:
         return "LogicalAndToken"
     case LogicalOrToken:
@@ -80,47 +106,273 @@ func NewToken(tokenType TokenType, value string) *Token {
 	}
 }
 
+// Engine selects how a loaded script runs: TreeEngine walks the action
+// tree built from the program, BytecodeEngine compiles it and runs the
+// bytecode on a stack machine.
+type Engine int
+
+const (
+    TreeEngine Engine = iota
+    BytecodeEngine
+)
+
+func (e Engine) String() string {
+    switch e {
+    case TreeEngine:
+        return "tree"
+    case BytecodeEngine:
+        return "bytecode"
+    default:
+        return "invalid"
+    }
+}
+
+// ParseEngine reads an engine by the name String gives it.
+func ParseEngine(name string) (Engine, error) {
+    for _, engine := range []Engine{TreeEngine, BytecodeEngine} {
+        if engine.String() == name {
+            return engine, nil
+        }
+    }
+    return TreeEngine, fmt.Errorf("unknown engine: %s", name)
+}
+
 type Script struct {
     Path         string
     Content      string
+    Args         []string
+    ParamValues  map[string]*Variable
+    Stdout       io.Writer
+    Stderr       io.Writer
+    Stdin        io.Reader
+    Logger       *log.Logger
+    SearchPaths  []string
+    Engine       Engine
+    Optimize     bool
+    Debugger     *Debugger
+    Profiler     *Profiler
+    Coverage     *Coverage
+    Limits       *Limits
+    Policy       *Policy
+    Program      *BlockNode
+    Bytecode     *Function
     MainBlock    *Block
     CurrentBlock *Block
+    modules      *moduleCache
+    interceptors []Interceptor
+    params       map[string]*Variable
+    ctx          context.Context
+    usage        *usage
+    input        *bufio.Reader
+    testing      bool
+    inline       bool
+    machine      *machine
+    returning    bool
+    returnValues []*Variable
 }
 
 func NewScript(filePath string, memory *MemoryMap) (*Script, error) {
     mainBlock := NewBlock(memory)
     return &Script{
         Path:         filePath,
+        Optimize:     true,
         MainBlock:    mainBlock,
         CurrentBlock: mainBlock,
     }, nil
 }
 
-func (s *Script) Run() error {
-    content, err := os.ReadFile(s.Path)
+// NewScriptFromSource makes a script out of source instead of a file. name
+// stands for the file in errors, and imports are resolved against the
+// directory it is in.
+func NewScriptFromSource(name, source string, memory *MemoryMap) (*Script, error) {
+    s, err := NewScript(name, memory)
     if err != nil {
+        return nil, err
+    }
+    s.Content, s.inline = source, true
+    return s, nil
+}
+
+func (s *Script) Run() error {
+    return s.RunContext(context.Background())
+}
+
+// RunContext runs the script until it ends or ctx is done, in which case it
+// stops with ErrCanceled or ErrDeadlineExceeded. Actions get ctx from
+// Context.
+func (s *Script) RunContext(ctx context.Context) error {
+    s.ctx = ctx
+    defer func() { s.ctx = nil }()
+    return s.run(nil)
+}
+
+// Context is the context the script runs with, actions that block should
+// give up once it is done.
+func (s *Script) Context() context.Context {
+    if s.ctx == nil {
+        return context.Background()
+    }
+    return s.ctx
+}
+
+// stdout, stderr and stdin are the streams builtins use, the process's
+// own unless the script was given others.
+func (s *Script) stdout() io.Writer {
+    if s.Stdout == nil {
+        return os.Stdout
+    }
+    return s.Stdout
+}
+
+func (s *Script) stderr() io.Writer {
+    if s.Stderr == nil {
+        return os.Stderr
+    }
+    return s.Stderr
+}
+
+// stdin buffers Stdin the first time it is read, so lines read by one
+// action do not take input away from the next.
+func (s *Script) stdin() *bufio.Reader {
+    if s.input == nil {
+        var in io.Reader = os.Stdin
+        if s.Stdin != nil {
+            in = s.Stdin
+        }
+        s.input = bufio.NewReader(in)
+    }
+    return s.input
+}
+
+// logf writes internal debug output to Logger, if there is one.
+func (s *Script) logf(format string, args ...interface{}) {
+    if s.Logger != nil {
+        s.Logger.Printf(format, args...)
+    }
+}
+
+// interrupted fails once the context of the script is done.
+func (s *Script) interrupted() error {
+    if s.ctx == nil {
+        return nil
+    }
+    select {
+    case <-s.ctx.Done():
+        return contextError(s.ctx)
+    default:
+        return nil
+    }
+}
+
+// run loads and runs the script, then calls then, when given, while what
+// the script declared is still around.
+func (s *Script) run(then func() error) error {
+    s.modules = newModuleCache(s.Path)
+    s.usage = &usage{}
+    s.input = nil
+    defer s.limitDuration()()
+    if s.Debugger != nil {
+        s.Debugger.reset()
+    }
+    if s.Profiler != nil {
+        interceptors := s.interceptors
+        s.interceptors = append([]Interceptor{s.Profiler.intercept}, interceptors...)
+        defer func() { s.interceptors = interceptors }()
+    }
+    if err := s.load(); err != nil {
+        return err
+    }
+    if err := s.bindParams(); err != nil {
         return err
     }
 
-    cleanedContent, err := normalizeContent(string(content))
-    if err != nil {
+    s.returning, s.returnValues = false, nil
+    if s.Profiler != nil {
+        s.Profiler.begin()
+        defer s.Profiler.end()
+    }
+    if err := s.runMain(); err != nil {
+        return err
+    }
+    if then != nil {
+        if err := then(); err != nil {
+            return err
+        }
+    }
+    s.MainBlock.Memory.Clear()
+
+    return nil
+}
+
+func (s *Script) load() error {
+    if err := s.read(); err != nil {
         return err
     }
-    s.Content = cleanedContent
+    if s.modules != nil {
+        s.modules.sources[s.Path] = s.Content
+    }
 
-    mainBlock, err := s.parseContent()
+    program, err := s.parseContent()
     if err != nil {
         return err
     }
-    s.MainBlock = mainBlock
+    s.Program = program
 
-    if err := s.runBlock(s.MainBlock); err != nil {
+    if err := s.checkTypes(program); err != nil {
         return err
     }
+    if s.Coverage != nil {
+        s.Coverage.register(s.Path, s.Content, program)
+    }
+    if s.Optimize && s.Debugger == nil && s.Coverage == nil {
+        s.optimize(program)
+    }
+
+    if s.engine() == BytecodeEngine {
+        function, err := s.compile(program)
+        if err != nil {
+            return err
+        }
+        s.Bytecode = function
+        return nil
+    }
+
+    s.MainBlock.Actions = nil
+    s.CurrentBlock = s.MainBlock
+    s.buildBlock(program, s.MainBlock)
 
     return nil
 }
 
+// read loads the script's content from its file, unless it was given.
+func (s *Script) read() error {
+    if s.inline {
+        return nil
+    }
+    content, err := os.ReadFile(s.Path)
+    if err != nil {
+        return err
+    }
+    s.Content = string(content)
+    return nil
+}
+
+func (s *Script) runMain() error {
+    if s.engine() == BytecodeEngine {
+        return s.execute()
+    }
+    return s.runBlock(s.MainBlock)
+}
+
+// engine is the engine the script really runs on, debugging, profiling,
+// coverage and tests need the tree engine.
+func (s *Script) engine() Engine {
+    if s.Debugger != nil || s.Profiler != nil || s.Coverage != nil || s.testing {
+        return TreeEngine
+    }
+    return s.Engine
+}
+
 type Block struct {
     Actions    []*Action
 	Executed   bool
@@ -0,0 +1,169 @@
+// terminal.go
+package taskwrappr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const debugPrompt = "(debug) "
+
+type terminalDebugger struct {
+	debugger *Debugger
+	in       *bufio.Scanner
+	out      io.Writer
+}
+
+// NewTerminalDebugger returns a debugger driven by commands read from in,
+// one per line. It stops on entry so breakpoints can be set before the
+// script starts; type help for the list of commands.
+func NewTerminalDebugger(in io.Reader, out io.Writer) *Debugger {
+	terminal := &terminalDebugger{in: bufio.NewScanner(in), out: out}
+	terminal.debugger = NewDebugger(terminal.stopped)
+	terminal.debugger.StopOnEntry = true
+	return terminal.debugger
+}
+
+func (t *terminalDebugger) stopped(stop *Stop) StepAction {
+	frame := stop.Frames[0]
+	reason := stop.Reason
+	if stop.Breakpoint != nil {
+		reason = fmt.Sprintf("%s %d", reason, stop.Breakpoint.ID)
+	}
+	fmt.Fprintf(t.out, "stopped at %s (%s)\n", frame.Pos, reason)
+	t.list(frame, 0)
+
+	for {
+		fmt.Fprint(t.out, debugPrompt)
+		if !t.in.Scan() {
+			fmt.Fprintln(t.out)
+			return Abort
+		}
+
+		command, argument, _ := strings.Cut(strings.TrimSpace(t.in.Text()), string(SpaceSymbol))
+		argument = strings.TrimSpace(argument)
+		switch command {
+		case "c", "continue":
+			return Continue
+		case "n", "next":
+			return StepOver
+		case "s", "step":
+			return StepInto
+		case "o", "out":
+			return StepOut
+		case "q", "quit":
+			return Abort
+		case "b", "break":
+			t.setBreakpoint(frame, argument)
+		case "d", "delete":
+			id, err := strconv.Atoi(argument)
+			if err != nil || !t.debugger.ClearBreakpoint(id) {
+				fmt.Fprintf(t.out, "no breakpoint %s\n", argument)
+			}
+		case "breakpoints":
+			for _, breakpoint := range t.debugger.Breakpoints() {
+				fmt.Fprintf(t.out, "%d  %s:%d", breakpoint.ID, breakpoint.File, breakpoint.Line)
+				if breakpoint.Condition != "" {
+					fmt.Fprintf(t.out, " if %s", breakpoint.Condition)
+				}
+				fmt.Fprintf(t.out, " (hit %d times)\n", breakpoint.Hits)
+			}
+		case "bt", "where":
+			for i, frame := range stop.Frames {
+				fmt.Fprintf(t.out, "#%d  %s at %s\n", i, frame.Name, frame.Pos)
+			}
+		case "v", "vars":
+			if selected := t.frame(stop, argument); selected != nil {
+				t.vars(selected)
+			}
+		case "p", "print":
+			value, err := frame.Evaluate(argument)
+			if err != nil {
+				fmt.Fprintln(t.out, err)
+			} else {
+				fmt.Fprintf(t.out, "%s (%v)\n", formatValue(value), value.Type)
+			}
+		case "l", "list":
+			t.list(frame, 3)
+		case "h", "help":
+			fmt.Fprintln(t.out, "c, continue               run until the next breakpoint")
+			fmt.Fprintln(t.out, "n, next                   step over the current statement")
+			fmt.Fprintln(t.out, "s, step                   step into the current statement")
+			fmt.Fprintln(t.out, "o, out                    run until the current action returns")
+			fmt.Fprintln(t.out, "b, break [file:]line [if condition]")
+			fmt.Fprintln(t.out, "d, delete id              remove a breakpoint")
+			fmt.Fprintln(t.out, "breakpoints               list breakpoints")
+			fmt.Fprintln(t.out, "bt, where                 show the stack")
+			fmt.Fprintln(t.out, "v, vars [frame]           show the scopes of a frame")
+			fmt.Fprintln(t.out, "p, print expression       evaluate an expression")
+			fmt.Fprintln(t.out, "l, list                   show the source around the statement")
+			fmt.Fprintln(t.out, "q, quit                   stop the script")
+		case "":
+		default:
+			fmt.Fprintf(t.out, "unknown command: %s (try help)\n", command)
+		}
+	}
+}
+
+// setBreakpoint parses "[file:]line [if condition]", the file defaults to
+// the one of the current frame.
+func (t *terminalDebugger) setBreakpoint(frame *Frame, argument string) {
+	location, condition, _ := strings.Cut(argument, " if ")
+	location = strings.TrimSpace(location)
+
+	file := frame.Pos.File
+	if index := strings.LastIndexByte(location, byte(DeclarationSymbol)); index >= 0 {
+		file, location = location[:index], location[index+1:]
+	}
+	line, err := strconv.Atoi(location)
+	if err != nil {
+		fmt.Fprintf(t.out, "invalid breakpoint location: %s\n", argument)
+		return
+	}
+
+	breakpoint := t.debugger.SetBreakpoint(file, line, strings.TrimSpace(condition))
+	fmt.Fprintf(t.out, "breakpoint %d at %s:%d\n", breakpoint.ID, breakpoint.File, breakpoint.Line)
+}
+
+func (t *terminalDebugger) frame(stop *Stop, argument string) *Frame {
+	if argument == "" {
+		return stop.Frames[0]
+	}
+	index, err := strconv.Atoi(argument)
+	if err != nil || index < 0 || index >= len(stop.Frames) {
+		fmt.Fprintf(t.out, "no frame %s\n", argument)
+		return nil
+	}
+	return stop.Frames[index]
+}
+
+func (t *terminalDebugger) vars(frame *Frame) {
+	for _, scope := range frame.Scopes() {
+		fmt.Fprintf(t.out, "%s:\n", scope.Name)
+		for _, name := range scope.Variables() {
+			variable := scope.Memory.Variables[name]
+			fmt.Fprintf(t.out, "  %s%c %v = %s\n", name, DeclarationSymbol, variable.Type, formatValue(variable))
+		}
+	}
+}
+
+// list prints the statement's line with context lines around it.
+func (t *terminalDebugger) list(frame *Frame, context int) {
+	if frame.script == nil {
+		return
+	}
+	lines := strings.Split(frame.script.source(frame.Pos.File), string(NewLineSymbol))
+	for line := frame.Pos.Line - context; line <= frame.Pos.Line+context; line++ {
+		if line < 1 || line > len(lines) {
+			continue
+		}
+		marker := "  "
+		if line == frame.Pos.Line {
+			marker = "->"
+		}
+		fmt.Fprintf(t.out, "%s %4d | %s\n", marker, line, strings.TrimRight(lines[line-1], string(ReturnSymbol)))
+	}
+}
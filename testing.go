@@ -0,0 +1,137 @@
+// testing.go
+package taskwrappr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const testActionName = "test"
+
+// TestResult is the outcome of one test block. Err is nil when the test
+// passed.
+type TestResult struct {
+	Name     string
+	Pos      Position
+	Duration time.Duration
+	Err      error
+}
+
+func (r *TestResult) Passed() bool {
+	return r.Err == nil
+}
+
+// RunTests runs the script, then every test block at its top level, each in
+// a scope of its own on top of what the script declared. Tests whose name
+// run rejects are skipped, run may be nil to run them all. The error is
+// only set when the script itself fails; failing tests are reported in
+// their results. Tests always run on the tree engine.
+func (s *Script) RunTests(run func(name string) bool) ([]*TestResult, error) {
+	s.testing = true
+	defer func() { s.testing = false }()
+
+	var results []*TestResult
+	err := s.run(func() error {
+		for _, action := range s.MainBlock.Actions {
+			statement, ok := action.Statement.(*CallStatementNode)
+			if !ok || statement.Call.Name != testActionName || action.Block == nil {
+				continue
+			}
+
+			args, _, err := action.ProcessArgs(s)
+			if err != nil {
+				return s.statementError(action, err)
+			}
+			if len(args) != 1 || args[0].Type != StringType {
+				return s.errorfAt(statement.Pos, "'test' action requires a name")
+			}
+			name := args[0].Value.(string)
+			if run != nil && !run(name) {
+				continue
+			}
+
+			result := &TestResult{Name: name, Pos: statement.Pos}
+			start := time.Now()
+			s.returning, s.returnValues = false, nil
+			result.Err = s.runScope(action.Block, NewMemoryMap(s.MainBlock.Memory))
+			result.Duration = time.Since(start)
+			s.CurrentBlock, s.returning, s.returnValues = s.MainBlock, false, nil
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
+
+func assertionError(message string, args []*Variable) error {
+	if len(args) > 0 && args[0].Type == StringType && args[0].Value.(string) != "" {
+		message = fmt.Sprintf("%s: %s", args[0].Value.(string), message)
+	}
+	return errors.New(message)
+}
+
+// valuesDiffer describes where actual first differs from expected, path
+// being where the two values are in the ones compared at the top. It
+// returns an empty string for equal values. Integers and floats are equal
+// when their numbers are.
+func valuesDiffer(actual, expected *Variable, path string) string {
+	at := ""
+	if path != "" {
+		at = " at " + path
+	}
+
+	numeric := func(v *Variable) bool { return v.Type == IntegerType || v.Type == FloatType }
+	if numeric(actual) && numeric(expected) {
+		a, _ := actual.toFloat()
+		b, _ := expected.toFloat()
+		if a != b {
+			return fmt.Sprintf("%s: %s != %s", at, formatValue(actual), formatValue(expected))
+		}
+		return ""
+	}
+	if actual.Type != expected.Type {
+		return fmt.Sprintf("%s: %v != %v", at, actual.Type, expected.Type)
+	}
+
+	switch actual.Type {
+	case ArrayType:
+		a, b := actual.Value.([]*Variable), expected.Value.([]*Variable)
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if difference := valuesDiffer(a[i], b[i], fmt.Sprintf("%s[%d]", path, i)); difference != "" {
+				return difference
+			}
+		}
+		if len(a) != len(b) {
+			return fmt.Sprintf("%s: length %d != %d", at, len(a), len(b))
+		}
+	case MapType:
+		a, b := actual.Value.(map[string]*Variable), expected.Value.(map[string]*Variable)
+		keys := mapKeys(a)
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := fmt.Sprintf("%s[%s]", path, quoteString(key))
+			switch {
+			case a[key] == nil:
+				return fmt.Sprintf(" at %s: missing", keyPath)
+			case b[key] == nil:
+				return fmt.Sprintf(" at %s: unexpected", keyPath)
+			}
+			if difference := valuesDiffer(a[key], b[key], keyPath); difference != "" {
+				return difference
+			}
+		}
+	case NilType:
+	default:
+		if actual.Value != expected.Value {
+			return fmt.Sprintf("%s: %s != %s", at, formatValue(actual), formatValue(expected))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+// testing_test.go
+package taskwrappr
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const failingTestSource = `values := map("name", "api", "ports", array(80, 443))
+
+test("ports") {
+	assertEqual(values, map("name", "api", "ports", array(80, 8443)))
+}
+
+test("names") {
+	assertEqual(get(values, "name"), "web", "service name")
+}
+
+test("truth") {
+	assert(1 > 2)
+}
+
+test("errors") {
+	assertError((x) => x, 1)
+}
+
+test("skipped") {
+	assert(false)
+}
+`
+
+func TestScriptTests(t *testing.T) {
+	s, err := NewScript("scripts/assertions_test.tw", GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Engine = BytecodeEngine
+	s.Stdout = io.Discard
+
+	results, err := s.RunTests(nil)
+	if err != nil {
+		t.Fatalf("RunTests returned an error: %s", err)
+	}
+
+	var names []string
+	for _, result := range results {
+		names = append(names, result.Name)
+		if !result.Passed() {
+			t.Errorf("test %s failed: %s", result.Name, result.Err)
+		}
+	}
+	if strings.Join(names, " ") != "arithmetic collections errors" {
+		t.Errorf("expected every test to run, got %v", names)
+	}
+}
+
+func TestFailingScriptTests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failing_test.tw")
+	if err := os.WriteFile(path, []byte(failingTestSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScript(path, GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+
+	s.Stdout = io.Discard
+
+	results, err := s.RunTests(func(name string) bool { return name != "skipped" })
+	if err != nil {
+		t.Fatalf("RunTests returned an error: %s", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	expected := map[string]string{
+		"ports":  "values differ at [\"ports\"][1]: 443 != 8443",
+		"names":  "service name: values differ: \"api\" != \"web\"\n    actual:   \"api\"\n    expected: \"web\"",
+		"truth":  "assertion failed",
+		"errors": "expected <action lambda> to fail",
+	}
+	for _, result := range results {
+		if result.Passed() {
+			t.Errorf("expected test %s to fail", result.Name)
+			continue
+		}
+		if !strings.Contains(result.Err.Error(), expected[result.Name]) {
+			t.Errorf("expected test %s to fail with %q, got:\n%s", result.Name, expected[result.Name], result.Err)
+		}
+	}
+}
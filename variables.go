@@ -22,6 +22,9 @@ const (
 	ArrayType
 	NilType
 	InvalidType
+	AnyType
+	MapType
+	ActionType
 )
 
 func (v VariableType) String() string {
@@ -36,13 +39,56 @@ func (v VariableType) String() string {
         return "boolean"
 	case ArrayType:
 		return "array"
+	case MapType:
+		return "map"
+	case ActionType:
+		return "action"
 	case NilType:
 		return "nil"
+	case AnyType:
+		return "any"
     default:
         return "invalid"
     }
 }
 
+func ParseVariableType(name string) (VariableType, error) {
+	switch name {
+	case "string":
+		return StringType, nil
+	case "int", "integer":
+		return IntegerType, nil
+	case "float":
+		return FloatType, nil
+	case "bool", "boolean":
+		return BooleanType, nil
+	case "array":
+		return ArrayType, nil
+	case "map":
+		return MapType, nil
+	case "action":
+		return ActionType, nil
+	case "nil":
+		return NilType, nil
+	case "any":
+		return AnyType, nil
+	default:
+		return InvalidType, fmt.Errorf("unknown type: %s", name)
+	}
+}
+
+func IsAssignable(target, value VariableType) bool {
+	switch {
+	case target == AnyType || value == AnyType:
+		return true
+	case target == value:
+		return true
+	case (target == IntegerType || target == FloatType) && (value == IntegerType || value == FloatType):
+		return true
+	}
+	return false
+}
+
 func NewVariable(value interface{}, variableType VariableType) *Variable {
 	return &Variable{
 		Value: value,
@@ -54,6 +100,9 @@ func DetermineVariableType(v interface{}) VariableType {
 	if v == nil {
 		return NilType
 	}
+	if _, ok := v.(*Action); ok {
+		return ActionType
+	}
 
 	switch reflect.TypeOf(v).Kind() {
 	case reflect.String:
@@ -66,6 +115,8 @@ func DetermineVariableType(v interface{}) VariableType {
 		return BooleanType
 	case reflect.Slice:
 		return ArrayType
+	case reflect.Map:
+		return MapType
 	default:
 		return InvalidType
 	}
@@ -96,6 +147,8 @@ func (v *Variable) toString() (string, error) {
 		return fmt.Sprintf("%g", v.Value.(float64)), nil
 	case BooleanType:
 		return strconv.FormatBool(v.Value.(bool)), nil
+	case ActionType:
+		return v.Value.(*Action).String(), nil
 	default:
 		return "", fmt.Errorf("cannot convert %v to string", v.Type)
 	}
@@ -162,4 +215,23 @@ func (v *Variable) toBool() (bool, error) {
 		}
 	}
 	return false, fmt.Errorf("cannot convert %v to boolean", v.Type)
+}
+
+func (v *Variable) Coerce(targetType VariableType) (*Variable, error) {
+	if targetType == AnyType || v.Type == targetType {
+		return v, nil
+	}
+
+	switch {
+	case targetType == FloatType && v.Type == IntegerType:
+		return NewVariable(float64(v.Value.(int)), FloatType), nil
+	case targetType == IntegerType && v.Type == FloatType:
+		value := v.Value.(float64)
+		if value != float64(int(value)) {
+			return nil, fmt.Errorf("cannot use non-integral float %g as %v", value, targetType)
+		}
+		return NewVariable(int(value), IntegerType), nil
+	}
+
+	return nil, fmt.Errorf("cannot use %v as %v", v.Type, targetType)
 }
\ No newline at end of file
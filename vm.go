@@ -0,0 +1,783 @@
+// vm.go
+package taskwrappr
+
+import (
+	"fmt"
+	"math"
+)
+
+// value is an operand on the VM stack. Numbers and booleans computed by
+// the VM stay unboxed, a value read from memory or returned by an action
+// refers to its variable, so actions receive the variable itself just as
+// they do when the action tree runs.
+type value struct {
+	variable *Variable
+	kind     VariableType
+	number   float64
+	integer  int
+	object   interface{}
+}
+
+func constantValue(v *Variable) value {
+	switch v.Type {
+	case FloatType:
+		return floatValue(v.Value.(float64))
+	case IntegerType:
+		return value{kind: IntegerType, integer: v.Value.(int)}
+	case BooleanType:
+		return boolValue(v.Value.(bool))
+	}
+	return value{kind: v.Type, object: v.Value}
+}
+
+func referenceValue(v *Variable) value {
+	return value{variable: v}
+}
+
+func floatValue(f float64) value {
+	return value{kind: FloatType, number: f}
+}
+
+func boolValue(b bool) value {
+	if b {
+		return value{kind: BooleanType, integer: 1}
+	}
+	return value{kind: BooleanType}
+}
+
+func (v value) Type() VariableType {
+	if v.variable != nil {
+		return v.variable.Type
+	}
+	return v.kind
+}
+
+func (v value) Value() interface{} {
+	if v.variable != nil {
+		return v.variable.Value
+	}
+	switch v.kind {
+	case FloatType:
+		return v.number
+	case IntegerType:
+		return v.integer
+	case BooleanType:
+		return v.integer != 0
+	}
+	return v.object
+}
+
+func (v value) toVariable() *Variable {
+	if v.variable != nil {
+		return v.variable
+	}
+	return NewVariable(v.Value(), v.kind)
+}
+
+func (v value) toNumber() (float64, bool) {
+	if v.variable != nil {
+		switch v.variable.Type {
+		case FloatType:
+			return v.variable.Value.(float64), true
+		case IntegerType:
+			return float64(v.variable.Value.(int)), true
+		}
+		return 0, false
+	}
+
+	switch v.kind {
+	case FloatType:
+		return v.number, true
+	case IntegerType:
+		return float64(v.integer), true
+	}
+	return 0, false
+}
+
+func (v value) toBoolean() (bool, bool) {
+	if v.variable != nil {
+		b, ok := v.variable.Value.(bool)
+		return b, ok && v.variable.Type == BooleanType
+	}
+	return v.integer != 0, v.kind == BooleanType
+}
+
+// unaryValue and binaryValue compute numbers and booleans in place and
+// leave every other combination to the tree walker's evaluation.
+func unaryValue(operator TokenType, a value) (value, error) {
+	switch operator {
+	case OperatorUnaryMinusToken:
+		if x, ok := a.toNumber(); ok {
+			return floatValue(-x), nil
+		}
+	case LogicalNotToken:
+		if x, ok := a.toBoolean(); ok {
+			return boolValue(!x), nil
+		}
+	}
+
+	result, err := evaluateUnary(operator, a.toVariable())
+	if err != nil {
+		return value{}, err
+	}
+	return referenceValue(result), nil
+}
+
+func binaryValue(operator TokenType, a, b value) (value, error) {
+	if x, ok := a.toNumber(); ok {
+		if y, ok := b.toNumber(); ok {
+			switch operator {
+			case OperatorAddToken:
+				return floatValue(x + y), nil
+			case OperatorSubtractToken:
+				return floatValue(x - y), nil
+			case OperatorMultiplyToken:
+				return floatValue(x * y), nil
+			case OperatorDivideToken:
+				if y == 0 {
+					return value{}, fmt.Errorf("division by zero")
+				}
+				return floatValue(x / y), nil
+			case OperatorModuloToken:
+				return floatValue(math.Mod(x, y)), nil
+			case OperatorExponentToken:
+				return floatValue(math.Pow(x, y)), nil
+			case EqualityToken:
+				return boolValue(x == y), nil
+			case InequalityToken:
+				return boolValue(x != y), nil
+			case LessThanToken:
+				return boolValue(x < y), nil
+			case LessThanOrEqualToken:
+				return boolValue(x <= y), nil
+			case GreaterThanToken:
+				return boolValue(x > y), nil
+			case GreaterThanOrEqualToken:
+				return boolValue(x >= y), nil
+			}
+		}
+	}
+
+	if x, ok := a.toBoolean(); ok {
+		if y, ok := b.toBoolean(); ok {
+			switch operator {
+			case LogicalAndToken:
+				return boolValue(x && y), nil
+			case LogicalOrToken:
+				return boolValue(x || y), nil
+			case LogicalXorToken:
+				return boolValue(x != y), nil
+			}
+		}
+	}
+
+	result, err := evaluateBinary(operator, a.toVariable(), b.toVariable())
+	if err != nil {
+		return value{}, err
+	}
+	return referenceValue(result), nil
+}
+
+func augmentNumber(operator string, x, y float64) (float64, bool) {
+	switch operator {
+	case AugmentedAdditionString:
+		return x + y, true
+	case AugmentedSubtractionString:
+		return x - y, true
+	case AugmentedMultiplicationString:
+		return x * y, true
+	case AugmentedDivisionString:
+		return x / y, y != 0
+	case AugmentedModulusString:
+		return math.Mod(x, y), true
+	case AugmentedExponentString:
+		return math.Pow(x, y), true
+	}
+	return 0, false
+}
+
+type frame struct {
+	function  *Function
+	closure   *MemoryMap
+	args      []*Variable
+	site      *callSite
+	ip        int
+	start     int
+	slotBase  int
+	scopeBase int
+	stackBase int
+	boundary  bool
+}
+
+// scope is a code block being run. Its memory is only created once
+// something needs it, locals in slots and lookups don't.
+type scope struct {
+	block *Block
+	last  *Variable
+}
+
+type machine struct {
+	script *Script
+	stack  []value
+	frames []frame
+	scopes []scope
+	slots  []*Variable
+}
+
+func (s *Script) vm() *machine {
+	if s.machine == nil {
+		s.machine = &machine{script: s}
+	}
+	return s.machine
+}
+
+func (s *Script) execute() error {
+	_, err := s.vm().run(s.Bytecode, nil, nil, s.MainBlock)
+	return err
+}
+
+func newCompiledAction(function *Function, closure *MemoryMap) *Action {
+	action := NewAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+		return s.vm().run(function, closure, args, nil)
+	}, nil)
+	action.Name = function.Name
+	action.Signature = function.Signature
+	action.function = function
+	action.closure = closure
+	return action
+}
+
+// run executes function until it returns. Calls between compiled actions
+// push frames onto the running machine, run is only reentered when an
+// action written in Go calls back into a compiled one.
+func (m *machine) run(function *Function, closure *MemoryMap, args []*Variable, root *Block) ([]*Variable, error) {
+	previousBlock := m.script.CurrentBlock
+	defer func() {
+		m.script.CurrentBlock = previousBlock
+	}()
+
+	base := len(m.frames)
+	if err := m.script.checkDepth(base); err != nil {
+		return nil, err
+	}
+	m.pushFrame(function, closure, args, nil, root)
+	m.frames[base].boundary = true
+
+	values, err := m.loop()
+	if err != nil {
+		for len(m.frames) > base {
+			m.popFrame()
+		}
+	}
+	return values, err
+}
+
+func (m *machine) pushFrame(function *Function, closure *MemoryMap, args []*Variable, site *callSite, root *Block) {
+	m.frames = append(m.frames, frame{
+		function:  function,
+		closure:   closure,
+		args:      args,
+		site:      site,
+		slotBase:  len(m.slots),
+		scopeBase: len(m.scopes),
+		stackBase: len(m.stack),
+	})
+	for i := 0; i < function.Slots; i++ {
+		m.slots = append(m.slots, nil)
+	}
+	m.scopes = append(m.scopes, scope{block: root})
+}
+
+func (m *machine) popFrame() frame {
+	f := m.frames[len(m.frames)-1]
+	m.frames = m.frames[:len(m.frames)-1]
+
+	clear(m.slots[f.slotBase:])
+	m.slots = m.slots[:f.slotBase]
+	clear(m.scopes[f.scopeBase:])
+	m.scopes = m.scopes[:f.scopeBase]
+	clear(m.stack[f.stackBase:])
+	m.stack = m.stack[:f.stackBase]
+
+	return f
+}
+
+func (f *frame) operand() int {
+	operand := f.function.Chunk.operand(f.ip)
+	f.ip += 2
+	return operand
+}
+
+func (m *machine) push(v value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *machine) pop() value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+func (m *machine) setLast(variable *Variable) {
+	m.scopes[len(m.scopes)-1].last = variable
+}
+
+// memory returns the innermost memory visible from the current scope
+// without creating any.
+func (m *machine) memory(f *frame) *MemoryMap {
+	for i := len(m.scopes) - 1; i >= f.scopeBase; i-- {
+		if block := m.scopes[i].block; block != nil {
+			return block.Memory
+		}
+	}
+	return f.closure
+}
+
+func (m *machine) block(f *frame) *Block {
+	return m.materialize(f, len(m.scopes)-1)
+}
+
+func (m *machine) materialize(f *frame, i int) *Block {
+	if block := m.scopes[i].block; block != nil {
+		return block
+	}
+
+	parent := f.closure
+	if i > f.scopeBase {
+		parent = m.materialize(f, i-1).Memory
+	}
+	block := NewBlock(parent)
+	m.scopes[i].block = block
+	return block
+}
+
+// callBlock is the current block handed to actions written in Go.
+func (m *machine) callBlock(f *frame) *Block {
+	current := &m.scopes[len(m.scopes)-1]
+	block := current.block
+	if block == nil {
+		block = &Block{Memory: m.memory(f)}
+	}
+	block.LastResult = current.last
+	return block
+}
+
+// errorAt attaches the position of the failing instruction, falling back
+// to the call site for instructions without one such as argument binding.
+func (m *machine) errorAt(err error) error {
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		f := &m.frames[i]
+		if pos := f.function.Chunk.position(f.start); pos.Line > 0 {
+			return m.script.errorAt(pos, err)
+		}
+	}
+	return err
+}
+
+func (m *machine) arguments(site *callSite) ([]*Variable, map[string]*Variable) {
+	values := m.stack[len(m.stack)-site.arguments:]
+	args := make([]*Variable, 0, site.arguments)
+	var named map[string]*Variable
+
+	for i, v := range values {
+		variable := v.toVariable()
+		if site.names != nil && site.names[i] != "" {
+			if named == nil {
+				named = make(map[string]*Variable)
+			}
+			named[site.names[i]] = variable
+		} else {
+			args = append(args, variable)
+		}
+	}
+
+	clear(values)
+	m.stack = m.stack[:len(m.stack)-site.arguments]
+	return args, named
+}
+
+func (m *machine) resolve(f *frame, site *callSite, callee value) (*Action, error) {
+	switch {
+	case site.action != nil:
+		return site.action, nil
+	case site.callee:
+		if callee.Type() != ActionType {
+			return nil, fmt.Errorf("cannot call %v", callee.Type())
+		}
+		return callee.Value().(*Action), nil
+	}
+
+	memory := m.memory(f)
+	if action := memory.GetAction(site.name); action != nil {
+		return action, nil
+	}
+
+	var variable *Variable
+	if site.slot >= 0 {
+		variable = m.slots[f.slotBase+site.slot]
+	} else if site.path != nil {
+		variable = memory.GetVariable(site.path[0])
+	} else {
+		variable = memory.GetVariable(site.name)
+	}
+	for i := 1; i < len(site.path) && variable != nil; i++ {
+		if variable.Type != MapType {
+			variable = nil
+			break
+		}
+		variable = variable.Value.(map[string]*Variable)[site.path[i]]
+	}
+
+	if variable == nil || variable.Type != ActionType {
+		return nil, fmt.Errorf("undefined action: %s", site.name)
+	}
+	return variable.Value.(*Action), nil
+}
+
+// deliver hands the results of a call to its site: an expression takes
+// exactly one value, an argument packs several into an array and a
+// statement records the first as the block's last result.
+func (m *machine) deliver(site *callSite, results []*Variable) error {
+	switch site.mode {
+	case expressionResult:
+		if len(results) != 1 {
+			return fmt.Errorf("'%s' action returned %d values, expected one", site.name, len(results))
+		}
+		m.push(referenceValue(results[0]))
+	case argumentResult:
+		if len(results) == 1 {
+			m.push(referenceValue(results[0]))
+		} else {
+			m.push(referenceValue(NewVariable(results, ArrayType)))
+		}
+	case statementResult:
+		if len(results) > 0 {
+			m.setLast(results[0])
+		} else {
+			m.setLast(nil)
+		}
+	}
+	return nil
+}
+
+func (m *machine) loop() ([]*Variable, error) {
+	s := m.script
+	f := &m.frames[len(m.frames)-1]
+	chunk := f.function.Chunk
+
+	for {
+		f.start = f.ip
+		op := OpCode(chunk.Code[f.ip])
+		f.ip++
+
+		switch op {
+		case OpConstant:
+			m.push(chunk.Constants[f.operand()])
+
+		case OpGetLocal:
+			slot, name := f.operand(), f.operand()
+			variable := m.slots[f.slotBase+slot]
+			if variable == nil {
+				return nil, m.errorAt(fmt.Errorf("undefined variable: %s", chunk.Names[name]))
+			}
+			m.push(referenceValue(variable))
+
+		case OpGetName:
+			name := chunk.Names[f.operand()]
+			memory := m.memory(f)
+			if variable := memory.GetVariable(name); variable != nil {
+				m.push(referenceValue(variable))
+			} else if action := memory.GetAction(name); action != nil {
+				m.push(value{kind: ActionType, object: action})
+			} else {
+				return nil, m.errorAt(fmt.Errorf("undefined variable: %s", name))
+			}
+
+		case OpGetVariable:
+			name := chunk.Names[f.operand()]
+			variable := m.memory(f).GetVariable(name)
+			if variable == nil {
+				return nil, m.errorAt(fmt.Errorf("undefined variable: %s", name))
+			}
+			m.push(referenceValue(variable))
+
+		case OpIndex:
+			index := m.pop()
+			target := m.pop()
+			result, err := indexVariable(target.toVariable(), index.toVariable())
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.push(referenceValue(result))
+
+		case OpField:
+			name := chunk.Names[f.operand()]
+			target := m.pop()
+			if target.Type() != MapType {
+				return nil, m.errorAt(fmt.Errorf("cannot access field '%s' of %v", name, target.Type()))
+			}
+			field, ok := target.Value().(map[string]*Variable)[name]
+			if !ok {
+				return nil, m.errorAt(fmt.Errorf("undefined field: %s", name))
+			}
+			m.push(referenceValue(field))
+
+		case OpUnary:
+			result, err := unaryValue(TokenType(f.operand()), m.pop())
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.push(result)
+
+		case OpBinary:
+			operator := TokenType(f.operand())
+			b := m.pop()
+			result, err := binaryValue(operator, m.pop(), b)
+			if err == nil && s.Limits != nil && result.Type() == StringType {
+				err = s.checkSize(result.toVariable())
+			}
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.push(result)
+
+		case OpClosure:
+			function := chunk.Functions[f.operand()]
+			m.push(value{kind: ActionType, object: newCompiledAction(function, m.block(f).Memory)})
+
+		case OpCall:
+			site := chunk.sites[f.operand()]
+			if err := s.interrupted(); err != nil {
+				return nil, m.errorAt(err)
+			}
+			var callee value
+			if site.callee {
+				callee = m.pop()
+			}
+			args, named := m.arguments(site)
+
+			target, err := m.resolve(f, site, callee)
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+
+			if target.function != nil && len(s.interceptors) == 0 {
+				bound, err := target.Signature.Bind(target.Name, args, named)
+				if err == nil {
+					err = s.step()
+				}
+				if err == nil {
+					err = s.checkDepth(len(m.frames))
+				}
+				if err != nil {
+					return nil, m.errorAt(err)
+				}
+				m.pushFrame(target.function, target.closure, bound, site, nil)
+				f = &m.frames[len(m.frames)-1]
+				chunk = f.function.Chunk
+				continue
+			}
+
+			s.CurrentBlock = m.callBlock(f)
+			results, err := target.invoke(s, site.name, args, named)
+			f = &m.frames[len(m.frames)-1]
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			if err := m.deliver(site, results); err != nil {
+				return nil, m.errorAt(err)
+			}
+
+		case OpDeclareLocal:
+			m.slots[f.slotBase+f.operand()] = NewVariable(nil, NilType)
+
+		case OpDefineLocal, OpSetLocal:
+			slot, name, variableType := f.operand(), f.operand(), VariableType(f.operand())
+			v := m.pop()
+			variable := m.slots[f.slotBase+slot]
+
+			if variableType != AnyType && v.Type() != variableType {
+				coerced, err := v.toVariable().Coerce(variableType)
+				if err != nil {
+					if op == OpDefineLocal {
+						return nil, m.errorAt(fmt.Errorf("cannot declare '%s': %v", chunk.Names[name], err))
+					}
+					return nil, m.errorAt(fmt.Errorf("cannot assign to '%s': %v", chunk.Names[name], err))
+				}
+				v = referenceValue(coerced)
+			}
+			variable.Value, variable.Type = v.Value(), v.Type()
+			m.setLast(variable)
+
+		case OpDeclareName:
+			name, typed, variableType := chunk.Names[f.operand()], f.operand(), VariableType(f.operand())
+			declareVariable(m.block(f).Memory, name, typed == 1, variableType)
+
+		case OpDefineName:
+			name, variableType := chunk.Names[f.operand()], VariableType(f.operand())
+			variable, err := defineVariable(m.block(f).Memory, name, variableType, m.pop().toVariable())
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.setLast(variable)
+
+		case OpSetName:
+			name := chunk.Names[f.operand()]
+			memory := m.memory(f)
+			if memory.GetVariable(name) == nil {
+				memory = m.block(f).Memory
+			}
+			variable, err := assignVariable(memory, name, m.pop().toVariable())
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.setLast(variable)
+
+		case OpAugmentLocal, OpAugmentName:
+			name, operator := chunk.Names[f.operand()], chunk.Names[f.operand()]
+			var variableType VariableType
+			if op == OpAugmentLocal {
+				variableType = VariableType(f.operand())
+			} else if declared, ok := m.memory(f).GetVariableType(name); ok {
+				variableType = declared
+			} else {
+				variableType = AnyType
+			}
+
+			v := m.pop()
+			variable := m.pop().variable
+			if variableType == AnyType || variableType == FloatType {
+				if x, ok := referenceValue(variable).toNumber(); ok {
+					if y, ok := v.toNumber(); ok {
+						if result, ok := augmentNumber(operator, x, y); ok {
+							variable.Value, variable.Type = result, FloatType
+							m.setLast(variable)
+							continue
+						}
+					}
+				}
+			}
+			if err := augmentVariable(variable, name, operator, v.toVariable(), variableType); err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.setLast(variable)
+
+		case OpImport:
+			alias := chunk.Names[f.operand()]
+			path := m.pop().toVariable()
+			s.CurrentBlock = m.block(f)
+			err := s.bindImport(path, alias)
+			f = &m.frames[len(m.frames)-1]
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.setLast(nil)
+
+		case OpDefineAction:
+			function, name := chunk.Functions[f.operand()], chunk.Names[f.operand()]
+			memory := m.block(f).Memory
+			memory.Actions[name] = newCompiledAction(function, memory)
+			m.setLast(nil)
+
+		case OpTestResult:
+			jump := f.operand()
+			last := m.scopes[len(m.scopes)-1].last
+			if last == nil {
+				f.ip += jump
+				continue
+			}
+			taken, err := last.toBool()
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			if !taken {
+				f.ip += jump
+			}
+
+		case OpEnterScope:
+			m.scopes = append(m.scopes, scope{})
+
+		case OpExitScope:
+			m.scopes[len(m.scopes)-1] = scope{}
+			m.scopes = m.scopes[:len(m.scopes)-1]
+
+		case OpParameter:
+			index, jump := f.operand(), f.operand()
+			if index < len(f.args) && f.args[index] != nil {
+				m.push(referenceValue(f.args[index]))
+				f.ip += jump
+			}
+
+		case OpMissingArgument:
+			parameter := f.function.Signature.Parameters[f.operand()]
+			return nil, m.errorAt(fmt.Errorf("'%s' action is missing required argument(s): %s", f.function.Name, parameter.Name))
+
+		case OpVariadic:
+			parameter := f.function.Signature.Parameters[f.operand()]
+			fixed := len(f.function.Signature.Parameters) - 1
+			var rest []*Variable
+			if len(f.args) > fixed {
+				rest = f.args[fixed:]
+			}
+			values, err := collectVariadic(f.function.Name, parameter, rest)
+			if err != nil {
+				return nil, m.errorAt(err)
+			}
+			m.push(referenceValue(values))
+
+		case OpBindLocal, OpBindName:
+			parameter := f.function.Signature.Parameters[f.operand()]
+			variable := m.pop().toVariable()
+			if op == OpBindLocal {
+				slot := f.operand()
+				if !parameter.Variadic {
+					var err error
+					if variable, err = coerceParameter(f.function.Name, parameter, variable); err != nil {
+						return nil, m.errorAt(err)
+					}
+				}
+				m.slots[f.slotBase+slot] = variable
+			} else if memory := m.block(f).Memory; parameter.Variadic {
+				memory.Variables[parameter.Name] = variable
+			} else if err := bindParameter(memory, f.function.Name, parameter, variable); err != nil {
+				return nil, m.errorAt(err)
+			}
+
+		case OpEndStatement, OpReturn:
+			if op == OpEndStatement {
+				err := s.interrupted()
+				if err == nil {
+					err = s.step()
+				}
+				if err != nil {
+					return nil, m.errorAt(err)
+				}
+				if !s.returning {
+					continue
+				}
+			}
+
+			var values []*Variable
+			if f.function.Signature != nil {
+				values = s.returnValues
+				s.returning, s.returnValues = false, nil
+				if len(values) == 0 {
+					values = []*Variable{NewVariable(nil, NilType)}
+				}
+			}
+
+			done := m.popFrame()
+			if done.boundary {
+				return values, nil
+			}
+			f = &m.frames[len(m.frames)-1]
+			chunk = f.function.Chunk
+			if err := m.deliver(done.site, values); err != nil {
+				return nil, m.errorAt(err)
+			}
+
+		default:
+			return nil, m.errorAt(fmt.Errorf("unknown opcode: %v", op))
+		}
+	}
+}
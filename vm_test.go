@@ -0,0 +1,130 @@
+// vm_test.go
+package taskwrappr
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runEngine(t testing.TB, path string, engine Engine) (string, error) {
+	t.Helper()
+
+	memory := GetBuiltIn()
+	memory.Variables["result"] = NewVariable(nil, NilType)
+	memory.Variables["hostAction"] = NewVariable(NewAction(func(s *Script, args ...*Variable) ([]*Variable, error) {
+		return []*Variable{NewVariable(len(args), IntegerType)}, nil
+	}, nil), ActionType)
+
+	s, err := NewScript(path, memory)
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Engine = engine
+
+	var output strings.Builder
+	s.Stdout = &output
+	err = s.Run()
+	return output.String(), err
+}
+
+func TestEnginesAgree(t *testing.T) {
+	paths, err := filepath.Glob("scripts/*.tw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		treeOutput, treeErr := runEngine(t, path, TreeEngine)
+		bytecodeOutput, bytecodeErr := runEngine(t, path, BytecodeEngine)
+
+		if treeErr != nil || bytecodeErr != nil {
+			t.Errorf("%s: tree returned %v, bytecode returned %v", path, treeErr, bytecodeErr)
+		}
+		if treeOutput != bytecodeOutput {
+			t.Errorf("%s: outputs differ\ntree:\n%s\nbytecode:\n%s", path, treeOutput, bytecodeOutput)
+		}
+	}
+}
+
+func TestEngineErrorsAgree(t *testing.T) {
+	scripts := []string{
+		"f := action(a) {\n\tprint(a)\n}\ncall(f)\n",
+		"f := action(n: int) {\n\tprint(n)\n}\ncall(f, 1.5)\n",
+		"g := action(x) {\n\treturn(x, x)\n}\nh := action() {\n\ty := g(1) + 1\n}\nh()\n",
+		"q := action() {\n\tmissing(1)\n}\nprint(\"before\")\nq()\n",
+		"m := map(\"a\", 1)\nf := (x) => x.b\nprint(f(m))\n",
+		"total := 0\nadd := action(step) {\n\ttotal += step / 0\n}\nadd(1)\n",
+	}
+
+	dir := t.TempDir()
+	for i, content := range scripts {
+		path := filepath.Join(dir, string(rune('a'+i))+".tw")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		treeOutput, treeErr := runEngine(t, path, TreeEngine)
+		bytecodeOutput, bytecodeErr := runEngine(t, path, BytecodeEngine)
+
+		if treeErr == nil || bytecodeErr == nil || treeErr.Error() != bytecodeErr.Error() {
+			t.Errorf("script %d: errors differ\ntree: %v\nbytecode: %v", i, treeErr, bytecodeErr)
+		}
+		if treeOutput != bytecodeOutput {
+			t.Errorf("script %d: outputs differ\ntree: %q\nbytecode: %q", i, treeOutput, bytecodeOutput)
+		}
+	}
+}
+
+func TestLocalSlots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slots.tw")
+	content := "plain := action(a, b: int = 2) {\n\tc := a + b\n\tif(c > 1) {\n\t\td := c\n\t}\n\treturn(c)\n}\n" +
+		"closure := action(a) {\n\tb := 1\n\treturn((x) => x + a)\n}\n" +
+		"dynamic := action(a) {\n\timport(\"lib/util.tw\")\n}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewScript(path, GetBuiltIn())
+	if err != nil {
+		t.Fatalf("NewScript returned an error: %s", err)
+	}
+	s.Engine = BytecodeEngine
+	if err := s.load(); err != nil {
+		t.Fatalf("load returned an error: %s", err)
+	}
+
+	expected := map[string]int{"plain": 4, "closure": 1, "dynamic": 0}
+	for _, function := range s.Bytecode.Chunk.Functions {
+		if function.Slots != expected[function.Name] {
+			t.Errorf("expected '%s' to use %d slots, got %d:\n%s", function.Name, expected[function.Name], function.Slots, function.Chunk)
+		}
+	}
+}
+
+func benchmarkEngine(b *testing.B, engine Engine) {
+	for i := 0; i < b.N; i++ {
+		memory := GetBuiltIn()
+		memory.Variables["result"] = NewVariable(nil, NilType)
+
+		s, err := NewScript("scripts/bench.tw", memory)
+		if err != nil {
+			b.Fatalf("NewScript returned an error: %s", err)
+		}
+		s.Engine = engine
+		s.Stdout = io.Discard
+		if err := s.Run(); err != nil {
+			b.Fatalf("run returned an error: %s", err)
+		}
+	}
+}
+
+func BenchmarkTreeEngine(b *testing.B) {
+	benchmarkEngine(b, TreeEngine)
+}
+
+func BenchmarkBytecodeEngine(b *testing.B) {
+	benchmarkEngine(b, BytecodeEngine)
+}